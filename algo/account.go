@@ -3,20 +3,43 @@ package algo
 import (
 	"context"
 	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"fmt"
 
 	"github.com/algorand/go-algorand-sdk/crypto"
 	"github.com/algorand/go-algorand-sdk/future"
 	"github.com/algorand/go-algorand-sdk/mnemonic"
 	"github.com/algorand/go-algorand-sdk/transaction"
+	"github.com/algorand/go-algorand-sdk/types"
 )
 
+// most transactions the network accepts in one atomic group
+const MaxGroupSize = 16
+
 type (
 	AccountService struct {
 		NodeService       *NodeService
 		AccountAddress    string
 		AccountPrivateKey ed25519.PrivateKey
 	}
+
+	// one payout within a group, assetId of zero sends ALGO
+	GroupTransfer struct {
+		Receiver string
+		AssetId  uint64
+		Amount   uint64
+		Note     []byte
+	}
+
+	// a signed atomic group, either every transfer lands or none do
+	SignedGroup struct {
+		GroupID        string   // base64, empty for a single transfer
+		TxIDs          []string // in the same order as the transfers
+		LastValidRound uint64   // the group can never be confirmed after this round
+
+		stxs []byte
+	}
 )
 
 // Creates new account service instance
@@ -39,6 +62,12 @@ func NewAccountService(accountMnemonic string) (*AccountService, error) {
 	}, nil
 }
 
+// Signs data the way Algorand wallets do, ed25519 over "MX" followed by data
+// verifies with crypto.VerifyBytes against AccountAddress
+func (s *AccountService) SignBytes(data []byte) ([]byte, error) {
+	return crypto.SignBytes(s.AccountPrivateKey, data)
+}
+
 // Checks the algos balance of faucet account
 // returns amount of microAlgos balance for account
 func (s *AccountService) CheckAlgoBalance(ctx context.Context) (uint64, error) {
@@ -90,7 +119,7 @@ func (s *AccountService) SendAsset(ctx context.Context, receiver string, assetID
 
 // Sends algos from faucet account
 // returns txid on success
-func (s *AccountService) SendAlgo(ctx context.Context, toAddr string, amount uint64) (string, error) {
+func (s *AccountService) SendAlgo(ctx context.Context, toAddr string, amount uint64, note []byte) (string, error) {
 	// Construct the transaction
 	txParams, err := s.NodeService.algodClient.SuggestedParams().Do(ctx)
 	if err != nil {
@@ -105,7 +134,7 @@ func (s *AccountService) SendAlgo(ctx context.Context, toAddr string, amount uin
 	firstValidRound := uint64(txParams.FirstRoundValid)
 	lastValidRound := uint64(txParams.LastRoundValid)
 
-	txn, err := transaction.MakePaymentTxnWithFlatFee(s.AccountAddress, toAddr, minFee, amount, firstValidRound, lastValidRound, nil, "", genID, genHash)
+	txn, err := transaction.MakePaymentTxnWithFlatFee(s.AccountAddress, toAddr, minFee, amount, firstValidRound, lastValidRound, note, "", genID, genHash)
 	if err != nil {
 		fmt.Printf("Error creating transaction: %s\n", err)
 		return "", err
@@ -126,3 +155,120 @@ func (s *AccountService) SendAlgo(ctx context.Context, toAddr string, amount uin
 
 	return txID, nil
 }
+
+// Creates and signs an atomic group of transfers from the account, valid for `validRounds` rounds
+// nothing is sent, so txids can be recorded before SendSignedGroup
+func (s *AccountService) SignTransferGroup(ctx context.Context, transfers []GroupTransfer, validRounds uint64) (*SignedGroup, error) {
+	if len(transfers) == 0 || len(transfers) > MaxGroupSize {
+		return nil, fmt.Errorf("group must have between 1 and %d transfers", MaxGroupSize)
+	}
+
+	txParams, err := s.transferParams(ctx, validRounds)
+	if err != nil {
+		return nil, err
+	}
+
+	txns := make([]types.Transaction, 0, len(transfers))
+
+	for _, t := range transfers {
+		txn, err := s.makeTransferTxn(t, txParams)
+		if err != nil {
+			return nil, err
+		}
+
+		txns = append(txns, txn)
+	}
+
+	gid, err := crypto.ComputeGroupID(txns)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &SignedGroup{
+		GroupID:        base64.StdEncoding.EncodeToString(gid[:]),
+		TxIDs:          make([]string, 0, len(txns)),
+		LastValidRound: uint64(txParams.LastRoundValid),
+	}
+
+	for _, txn := range txns {
+		txn.Group = gid
+
+		txid, stx, err := crypto.SignTransaction(s.AccountPrivateKey, txn)
+		if err != nil {
+			fmt.Printf("Failed to sign transaction: %s\n", err)
+			return nil, err
+		}
+
+		group.TxIDs = append(group.TxIDs, txid)
+		group.stxs = append(group.stxs, stx...)
+	}
+
+	return group, nil
+}
+
+// Creates and signs a single transfer from the account, valid for `validRounds` rounds
+// nothing is sent, so the txid can be recorded before SendSignedGroup
+func (s *AccountService) SignTransfer(ctx context.Context, transfer GroupTransfer, validRounds uint64) (*SignedGroup, error) {
+	txParams, err := s.transferParams(ctx, validRounds)
+	if err != nil {
+		return nil, err
+	}
+
+	txn, err := s.makeTransferTxn(transfer, txParams)
+	if err != nil {
+		return nil, err
+	}
+
+	txid, stx, err := crypto.SignTransaction(s.AccountPrivateKey, txn)
+	if err != nil {
+		fmt.Printf("Failed to sign transaction: %s\n", err)
+		return nil, err
+	}
+
+	return &SignedGroup{
+		TxIDs:          []string{txid},
+		LastValidRound: uint64(txParams.LastRoundValid),
+		stxs:           stx,
+	}, nil
+}
+
+// suggested params at the default fee, valid for `validRounds` rounds
+func (s *AccountService) transferParams(ctx context.Context, validRounds uint64) (types.SuggestedParams, error) {
+	txParams, err := s.NodeService.algodClient.SuggestedParams().Do(ctx)
+	if err != nil {
+		fmt.Printf("Error getting suggested tx params: %s\n", err)
+		return txParams, err
+	}
+
+	// default fee 0.001 algos
+	txParams.FlatFee = true
+	txParams.Fee = 1000
+
+	// short validity so an unconfirmed txn can be given up on (and retried) quickly
+	txParams.LastRoundValid = txParams.FirstRoundValid + types.Round(validRounds)
+
+	return txParams, nil
+}
+
+func (s *AccountService) makeTransferTxn(t GroupTransfer, txParams types.SuggestedParams) (types.Transaction, error) {
+	if t.AssetId == 0 {
+		return future.MakePaymentTxn(s.AccountAddress, t.Receiver, t.Amount, t.Note, "", txParams)
+	}
+
+	return future.MakeAssetTransferTxn(s.AccountAddress, t.Receiver, t.Amount, t.Note, txParams, "", t.AssetId)
+}
+
+// Broadcasts a group signed by SignTransferGroup or a transfer signed by SignTransfer
+func (s *AccountService) SendSignedGroup(ctx context.Context, group *SignedGroup) error {
+	if group == nil || len(group.stxs) == 0 {
+		return errors.New("group has not been signed")
+	}
+
+	_, err := s.NodeService.algodClient.SendRawTransaction(group.stxs).Do(ctx)
+	if err != nil {
+		fmt.Printf("failed to send transaction group: %s\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -5,12 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
 	"github.com/algorand/go-algorand-sdk/client/v2/indexer"
 )
 
+// indexer has no such transaction (yet), as opposed to failing to answer
+var ErrTransactionNotFound = errors.New("transaction not found")
+
 type (
 	IndexerService struct {
 		indexerClient *indexer.Client
@@ -42,6 +46,14 @@ func (s *IndexerService) HasMinimumTransactions(ctx context.Context, address str
 	return true, nil
 }
 
+// where balances come from, *IndexerService outside of tests
+type HoldingsSource interface {
+	// every account holding assetId, opted in accounts with nothing included
+	GetAccountsWithAsset(ctx context.Context, assetId uint64) ([]models.MiniAssetHolding, error)
+}
+
+var _ HoldingsSource = (*IndexerService)(nil)
+
 func (s *IndexerService) GetAccountsWithAsset(ctx context.Context, assetId uint64) ([]models.MiniAssetHolding, error) {
 	nextToken := ""
 
@@ -71,15 +83,23 @@ func (s *IndexerService) GetAccountsWithAsset(ctx context.Context, assetId uint6
 	return res.Balances, err
 }
 
-// raw get transactions
-// must be sent to `receiver` address, match the assetId
-func (s *IndexerService) GetAssetTransactionsForAddress(ctx context.Context, receiver string, assetId uint64, afterTime, beforeTime time.Time) ([]models.Transaction, error) {
-	r, err := s.indexerClient.LookupAccountTransactions(receiver).
-		AssetID(assetId).     // must be chips ASA
-		TxType("axfer").      // only asset transfer tx
-		AfterTime(afterTime). // must be after time deposit was created
-		BeforeTime(beforeTime).
-		Do(ctx)
+// search for transfers of assetId (zero for ALGO) sent to `receiver` between the given times
+func (s *IndexerService) searchTransfers(receiver string, assetId uint64, afterTime, beforeTime time.Time) *indexer.LookupAccountTransactions {
+	q := s.indexerClient.LookupAccountTransactions(receiver).
+		TxType(txTypeForAsset(assetId)). // only `pay` for ALGO, `axfer` for ASA
+		AfterTime(afterTime).            // must be after time deposit was created
+		BeforeTime(beforeTime)
+
+	if assetId != 0 {
+		q = q.AssetID(assetId)
+	}
+
+	return q
+}
+
+// runs the search built by `search`, following next tokens until every page is read
+func (s *IndexerService) searchAllPages(ctx context.Context, search func() *indexer.LookupAccountTransactions) ([]models.Transaction, error) {
+	r, err := search().Do(ctx)
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
 		return nil, err
@@ -89,13 +109,7 @@ func (s *IndexerService) GetAssetTransactionsForAddress(ctx context.Context, rec
 
 	for nextToken != "" {
 		// do another lookup, but this time provide the nextToken
-		r2, err := s.indexerClient.LookupAccountTransactions(receiver).
-			AssetID(assetId).     // must be chips ASA
-			TxType("axfer").      // only asset transfer tx
-			AfterTime(afterTime). // must be after time deposit was created
-			BeforeTime(beforeTime).
-			NextToken(nextToken).
-			Do(ctx)
+		r2, err := search().NextToken(nextToken).Do(ctx)
 		if err != nil {
 			fmt.Printf("err: %v\n", err)
 			return nil, err
@@ -109,12 +123,89 @@ func (s *IndexerService) GetAssetTransactionsForAddress(ctx context.Context, rec
 	return r.Transactions, nil
 }
 
-// TODO: add ability to check for algo txn as well
+// raw get transfers
+// must be sent to `receiver` address, match the assetId (zero for ALGO)
+// transfers sent by `receiver` itself are included, callers match on sender
+func (s *IndexerService) GetTransfersForAddress(ctx context.Context, receiver string, assetId uint64, afterTime, beforeTime time.Time) ([]*Transfer, error) {
+	txns, err := s.searchAllPages(ctx, func() *indexer.LookupAccountTransactions {
+		return s.searchTransfers(receiver, assetId, afterTime, beforeTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0, len(txns))
+
+	for _, txn := range txns {
+		t, ok := TransferFromTransaction(txn)
+		if !ok || t.Receiver != receiver || t.AssetId != assetId {
+			continue
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	return transfers, nil
+}
+
+// every transfer sent to `receiver` between the given times, in any asset
+// transfers sent by `receiver` itself are included, callers match on sender
+func (s *IndexerService) GetAllTransfersForAddress(ctx context.Context, receiver string, afterTime, beforeTime time.Time) ([]*Transfer, error) {
+	txns, err := s.searchAllPages(ctx, func() *indexer.LookupAccountTransactions {
+		// no type filter, anything that isn't `pay` or `axfer` is dropped below
+		return s.indexerClient.LookupAccountTransactions(receiver).
+			AfterTime(afterTime).
+			BeforeTime(beforeTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0, len(txns))
+
+	for _, txn := range txns {
+		t, ok := TransferFromTransaction(txn)
+		if !ok || t.Receiver != receiver {
+			continue
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	return transfers, nil
+}
+
+// latest round the indexer has caught up to
+func (s *IndexerService) LatestRound(ctx context.Context) (uint64, error) {
+	health, err := s.indexerClient.HealthCheck().Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return health.Round, nil
+}
+
+// look up a single confirmed transfer by txid
+func (s *IndexerService) GetTransfer(ctx context.Context, txid string) (*Transfer, error) {
+	txn, err := s.indexerClient.LookupTransaction(txid).Do(ctx)
+	if err != nil && strings.HasPrefix(err.Error(), "HTTP 404") {
+		return nil, fmt.Errorf("%w: %v", ErrTransactionNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	t, ok := TransferFromTransaction(txn.Transaction)
+	if !ok {
+		return nil, errors.New("transaction is not a transfer")
+	}
+
+	return t, nil
+}
 
 // check transaction exists meeting following criteria:
 // sender, receiver, txid, amount, time (must have took place after given time)
 // returns true if deposit exists, false otherwise
-// only ASA transfers support at this time
+// assetId of zero checks for an ALGO `pay` txn, otherwise an ASA `axfer` txn
 func (s *IndexerService) CheckTransaction(ctx context.Context, txid, sender, receiver string, assetId, amount uint64, afterTime, beforeTime time.Time, mustMatchNote string) (bool, error) {
 	txn, err := s.indexerClient.LookupTransaction(txid).Do(ctx)
 	if err != nil {
@@ -122,27 +213,27 @@ func (s *IndexerService) CheckTransaction(ctx context.Context, txid, sender, rec
 		return false, err
 	}
 
-	blockTime := time.Unix(int64(txn.Transaction.RoundTime), 0).UTC()
+	t, ok := TransferFromTransaction(txn.Transaction)
+	if !ok {
+		return false, errors.New("transaction is not a transfer")
+	}
 
-	if txn.Transaction.Type != "axfer" ||
-		txn.Transaction.AssetTransferTransaction.Amount != amount ||
-		txn.Transaction.AssetTransferTransaction.AssetId != assetId ||
-		txn.Transaction.Sender != sender ||
-		txn.Transaction.AssetTransferTransaction.Receiver != receiver {
+	if t.Amount != amount ||
+		t.AssetId != assetId ||
+		t.Sender != sender ||
+		t.Receiver != receiver {
 		// didn't match amount, assetId, sender or receiver
 		return false, errors.New("transaction did not match payment")
-	} else if !blockTime.Before(beforeTime) || !blockTime.After(afterTime) {
+	} else if !t.RoundTime.Before(beforeTime) || !t.RoundTime.After(afterTime) {
 		// must be within given time range
-		fmt.Printf("blockTime: %v\n", blockTime)
+		fmt.Printf("blockTime: %v\n", t.RoundTime)
 		fmt.Printf("afterTime: %v\n", afterTime)
 		fmt.Printf("beforeTime: %v\n", beforeTime)
 		return false, errors.New("transaction outside time range")
 	}
 
 	if mustMatchNote != "" {
-		note := txn.Transaction.Note
-
-		if !bytes.Equal(note, []byte(mustMatchNote)) {
+		if !bytes.Equal(t.Note, []byte(mustMatchNote)) {
 			return false, errors.New("note didn't match external id")
 		}
 	}
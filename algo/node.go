@@ -9,6 +9,9 @@ import (
 	"github.com/algorand/go-algorand-sdk/client/v2/algod"
 )
 
+// address hasn't opted in to the asset, as opposed to failing to look it up
+var ErrAssetNotOptedIn = errors.New("no such asset found")
+
 type (
 	NodeService struct {
 		algodClient *algod.Client
@@ -46,7 +49,24 @@ func (s *NodeService) CheckAssetBalance(ctx context.Context, address string, ass
 		}
 	}
 
-	return 0, errors.New("no such asset found")
+	return 0, ErrAssetNotOptedIn
+}
+
+// algo (asset id 0) and every asset balance of address, assets it hasn't opted in to are left out
+func (s *NodeService) GetAssetBalances(ctx context.Context, address string) (map[uint64]uint64, error) {
+	accountInfo, err := s.algodClient.AccountInformation(address).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[uint64]uint64, len(accountInfo.Assets)+1)
+	balances[0] = accountInfo.Amount
+
+	for _, asset := range accountInfo.Assets {
+		balances[asset.AssetId] = asset.Amount
+	}
+
+	return balances, nil
 }
 
 func (s *NodeService) StatusAfterRound(ctx context.Context, round uint64) error {
@@ -63,3 +83,49 @@ func (s *NodeService) StatusAfterRound(ctx context.Context, round uint64) error
 
 	return nil
 }
+
+// latest round the node has
+func (s *NodeService) LatestRound(ctx context.Context) (uint64, error) {
+	r, err := s.algodClient.Status().Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.LastRound, nil
+}
+
+// blocks until the node has `round`, algod gives up after about a minute so callers should loop
+// returns the latest round the node has
+func (s *NodeService) WaitForRound(ctx context.Context, round uint64) (uint64, error) {
+	if round == 0 {
+		return s.LatestRound(ctx)
+	}
+
+	r, err := s.algodClient.StatusAfterBlock(round - 1).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.LastRound, nil
+}
+
+// every top level `pay` and `axfer` in the given round, inner transactions are skipped
+func (s *NodeService) GetBlockTransfers(ctx context.Context, round uint64) ([]*Transfer, error) {
+	block, err := s.algodClient.Block(round).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make([]*Transfer, 0)
+
+	for _, stxn := range block.Payset {
+		t, ok := TransferFromBlockTransaction(block.BlockHeader, stxn)
+		if !ok {
+			continue
+		}
+
+		transfers = append(transfers, t)
+	}
+
+	return transfers, nil
+}
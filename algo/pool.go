@@ -0,0 +1,142 @@
+package algo
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+type (
+	// a liquidity pool account's state, Tinyman pools mint every pool token up front and hold what isn't issued
+	PoolReserves struct {
+		Address string
+		Round   uint64 // state is as of this round
+
+		// CHIP side of the pool, in base units
+		ChipAssetId uint64
+		ChipReserve uint64
+
+		// pool tokens held outside the pool, in base units
+		LiquidityAssetId  uint64
+		LiquidityIssued   uint64
+		LiquidityDecimals uint64
+	}
+)
+
+// where pool reserves come from, *NodeService outside of tests
+type PoolReservesSource interface {
+	// reserves of the pool at poolAddress trading chipAssetId, liquidityAssetId is its pool token
+	GetPoolReserves(ctx context.Context, poolAddress string, chipAssetId, liquidityAssetId uint64) (*PoolReserves, error)
+}
+
+var _ PoolReservesSource = (*NodeService)(nil)
+
+// Tinyman v2 keeps the pool's reserves in the pool account's local state of the validator app
+// asset 1 is the asset with the larger id, ALGO (zero) is always asset 2
+const (
+	tinymanV2Asset1Id         = "asset_1_id"
+	tinymanV2Asset2Id         = "asset_2_id"
+	tinymanV2Asset1Reserves   = "asset_1_reserves"
+	tinymanV2Asset2Reserves   = "asset_2_reserves"
+	tinymanV2PoolTokenAssetId = "pool_token_asset_id"
+	tinymanV2IssuedPoolTokens = "issued_pool_tokens"
+)
+
+// reads the reserves of the pool at poolAddress trading chipAssetId, liquidityAssetId is its pool token
+// a Tinyman v2 pool's reserves come from its local state, its balance also holds protocol fees not yet collected
+// pools without that state (Tinyman v1) are read from the balance
+func (s *NodeService) GetPoolReserves(ctx context.Context, poolAddress string, chipAssetId, liquidityAssetId uint64) (*PoolReserves, error) {
+	accountInfo, err := s.algodClient.AccountInformation(poolAddress).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	asset, err := s.algodClient.GetAssetByID(liquidityAssetId).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ls := range accountInfo.AppsLocalState {
+		pr, ok, err := poolReservesFromLocalState(ls.KeyValue, chipAssetId, liquidityAssetId)
+		if err != nil {
+			return nil, fmt.Errorf("%s local state of app %d: %w", poolAddress, ls.Id, err)
+		} else if !ok {
+			continue
+		}
+
+		pr.Address = poolAddress
+		pr.Round = accountInfo.Round
+		pr.LiquidityDecimals = asset.Params.Decimals
+
+		return pr, nil
+	}
+
+	pr := &PoolReserves{
+		Address:           poolAddress,
+		Round:             accountInfo.Round,
+		ChipAssetId:       chipAssetId,
+		LiquidityAssetId:  liquidityAssetId,
+		LiquidityDecimals: asset.Params.Decimals,
+	}
+
+	held := uint64(0)
+	opted := false
+
+	for _, a := range accountInfo.Assets {
+		switch a.AssetId {
+		case chipAssetId:
+			pr.ChipReserve = a.Amount
+		case liquidityAssetId:
+			held = a.Amount
+			opted = true
+		}
+	}
+
+	if !opted || held > asset.Params.Total {
+		return nil, fmt.Errorf("%s does not hold pool token %d", poolAddress, liquidityAssetId)
+	}
+
+	pr.LiquidityIssued = asset.Params.Total - held
+
+	return pr, nil
+}
+
+// reserves from a Tinyman v2 pool's local state
+// returns false if the state isn't of a pool with pool token liquidityAssetId trading chipAssetId
+func poolReservesFromLocalState(kv []models.TealKeyValue, chipAssetId, liquidityAssetId uint64) (*PoolReserves, bool, error) {
+	state := make(map[string]uint64, len(kv))
+
+	for _, v := range kv {
+		key, err := base64.StdEncoding.DecodeString(v.Key)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if v.Value.Type == 2 { // uint
+			state[string(key)] = v.Value.Uint
+		}
+	}
+
+	if poolToken, ok := state[tinymanV2PoolTokenAssetId]; !ok || poolToken != liquidityAssetId {
+		return nil, false, nil
+	}
+
+	pr := &PoolReserves{
+		ChipAssetId:      chipAssetId,
+		LiquidityAssetId: liquidityAssetId,
+		LiquidityIssued:  state[tinymanV2IssuedPoolTokens],
+	}
+
+	switch chipAssetId {
+	case state[tinymanV2Asset1Id]:
+		pr.ChipReserve = state[tinymanV2Asset1Reserves]
+	case state[tinymanV2Asset2Id]:
+		pr.ChipReserve = state[tinymanV2Asset2Reserves]
+	default:
+		return nil, false, fmt.Errorf("pool token %d is not of a pool trading %d", liquidityAssetId, chipAssetId)
+	}
+
+	return pr, true, nil
+}
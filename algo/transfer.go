@@ -0,0 +1,103 @@
+package algo
+
+import (
+	"time"
+
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+// a single movement of ALGO (asset id 0) or an ASA between two accounts
+// common shape for `pay` and `axfer` transactions so callers don't care which it was
+type Transfer struct {
+	TxID      string
+	Round     uint64
+	RoundTime time.Time
+
+	Sender   string
+	Receiver string
+	AssetId  uint64 // zero for network token
+	Amount   uint64
+	Note     []byte
+}
+
+// converts an indexer transaction into a transfer
+// returns false if the transaction doesn't move funds (not `pay` or `axfer`)
+func TransferFromTransaction(txn models.Transaction) (*Transfer, bool) {
+	t := &Transfer{
+		TxID:      txn.Id,
+		Round:     txn.ConfirmedRound,
+		RoundTime: time.Unix(int64(txn.RoundTime), 0).UTC(),
+		Sender:    txn.Sender,
+		Note:      txn.Note,
+	}
+
+	switch txn.Type {
+	case "pay":
+		t.Receiver = txn.PaymentTransaction.Receiver
+		t.Amount = txn.PaymentTransaction.Amount
+	case "axfer":
+		t.Receiver = txn.AssetTransferTransaction.Receiver
+		t.AssetId = txn.AssetTransferTransaction.AssetId
+		t.Amount = txn.AssetTransferTransaction.Amount
+	default:
+		return nil, false
+	}
+
+	return t, true
+}
+
+// converts a top level transaction taken straight from a block into a transfer
+// returns false if the transaction doesn't move funds (not `pay` or `axfer`)
+// inner transactions (in ApplyData.EvalDelta) are skipped, funds moved by apps are only seen through the indexer
+func TransferFromBlockTransaction(header types.BlockHeader, stxn types.SignedTxnInBlock) (*Transfer, bool) {
+	txn := stxn.Txn
+
+	// genesis fields are stripped from block txns, they're needed to compute the txid
+	// the genesis id was signed over only if the txn had one, hgi says so
+	if stxn.HasGenesisID {
+		txn.GenesisID = header.GenesisID
+	}
+
+	// every protocol the follower will meet has RequireGenesisHash, blocks then never set hgh
+	// yet the hash was always signed over
+	txn.GenesisHash = header.GenesisHash
+
+	t := &Transfer{
+		Round:     uint64(header.Round),
+		RoundTime: time.Unix(header.TimeStamp, 0).UTC(),
+		Sender:    txn.Sender.String(),
+		Note:      txn.Note,
+	}
+
+	switch txn.Type {
+	case types.PaymentTx:
+		t.Receiver = txn.Receiver.String()
+		t.Amount = uint64(txn.Amount)
+	case types.AssetTransferTx:
+		if !txn.AssetSender.IsZero() {
+			// clawback, not sent by the txn sender
+			return nil, false
+		}
+
+		t.Receiver = txn.AssetReceiver.String()
+		t.AssetId = uint64(txn.XferAsset)
+		t.Amount = txn.AssetAmount
+	default:
+		return nil, false
+	}
+
+	t.TxID = crypto.GetTxID(txn)
+
+	return t, true
+}
+
+// indexer txn type used to move the given asset
+func txTypeForAsset(assetId uint64) string {
+	if assetId == 0 {
+		return "pay"
+	}
+
+	return "axfer"
+}
@@ -0,0 +1,116 @@
+package algo_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/algo-casino/payapi/algo"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/encoding/msgpack"
+	"github.com/algorand/go-algorand-sdk/future"
+	"github.com/algorand/go-algorand-sdk/types"
+)
+
+// mainnet-v1.0
+const mainnetGenesisHash = "wGHE2Pwdvd7S12BL5FaOP20EGYesN73ktiC1qzkkit8="
+
+func TestTransferFromBlockTransaction(t *testing.T) {
+	// txids of block txns must match the txid they were signed with
+
+	gh, err := base64.StdEncoding.DecodeString(mainnetGenesisHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := types.BlockHeader{
+		Round:       30000000,
+		TimeStamp:   1688000000,
+		GenesisID:   "mainnet-v1.0",
+		GenesisHash: types.Digest(gh),
+	}
+
+	account := crypto.GenerateAccount()
+	receiver := crypto.GenerateAccount()
+
+	params := types.SuggestedParams{
+		Fee:             1000,
+		FlatFee:         true,
+		FirstRoundValid: 29999990,
+		LastRoundValid:  30000990,
+		GenesisID:       header.GenesisID,
+		GenesisHash:     gh,
+	}
+
+	t.Run("Axfer", func(t *testing.T) {
+		txn, err := future.MakeAssetTransferTxn(account.Address.String(), receiver.Address.String(), 69, []byte("420"), params, "", 1337)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txid, stx, err := crypto.SignTransaction(account.PrivateKey, txn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transfer, ok := algo.TransferFromBlockTransaction(header, blockTransaction(t, stx))
+		if !ok {
+			t.Fatal("expected transfer")
+		} else if transfer.TxID != txid {
+			t.Fatalf("TxID=%v, want %v", transfer.TxID, txid)
+		} else if transfer.AssetId != 1337 || transfer.Amount != 69 || transfer.Receiver != receiver.Address.String() {
+			t.Fatalf("unexpected transfer: %+v", transfer)
+		}
+	})
+
+	t.Run("NoGenesisID", func(t *testing.T) {
+		params := params
+		params.GenesisID = ""
+
+		txn, err := future.MakePaymentTxn(account.Address.String(), receiver.Address.String(), 1000000, nil, "", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		txid, stx, err := crypto.SignTransaction(account.PrivateKey, txn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transfer, ok := algo.TransferFromBlockTransaction(header, blockTransaction(t, stx))
+		if !ok {
+			t.Fatal("expected transfer")
+		} else if transfer.TxID != txid {
+			t.Fatalf("TxID=%v, want %v", transfer.TxID, txid)
+		}
+	})
+}
+
+// a signed txn as algod puts it in a block, genesis fields stripped with hgi set only if it had a genesis id
+func blockTransaction(tb testing.TB, stx []byte) types.SignedTxnInBlock {
+	tb.Helper()
+
+	var signed types.SignedTxn
+
+	err := msgpack.Decode(stx, &signed)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	stxn := types.SignedTxnInBlock{
+		HasGenesisID: signed.Txn.GenesisID != "",
+	}
+
+	signed.Txn.GenesisID = ""
+	signed.Txn.GenesisHash = types.Digest{}
+	stxn.SignedTxn = signed
+
+	// round trip the encoding a block would use
+	var decoded types.SignedTxnInBlock
+
+	err = msgpack.Decode(msgpack.Encode(&stxn), &decoded)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return decoded
+}
@@ -0,0 +1,24 @@
+package payapi
+
+import (
+	"context"
+	"time"
+)
+
+// name of the cursor used by the deposit follower
+const ChainCursorDeposits = "deposits"
+
+// last round a chain follower has fully processed, so it can resume after a restart
+type ChainCursor struct {
+	Name      string    `json:"name"`
+	Round     uint64    `json:"round"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type ChainCursorService interface {
+	// Find cursor by name, errors if it has never been saved
+	FindChainCursor(ctx context.Context, name string) (*ChainCursor, error)
+
+	// Save the last processed round, creating the cursor if needed
+	UpdateChainCursor(ctx context.Context, name string, round uint64) error
+}
@@ -0,0 +1,79 @@
+package chip
+
+import (
+	"context"
+	"log"
+	"math/big"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+)
+
+var _ payapi.StakingPricingService = (*PricingService)(nil)
+
+type PricingService struct {
+	PoolReservesSource  algo.PoolReservesSource
+	StakingAssetService payapi.StakingAssetService
+}
+
+func NewPricingService() *PricingService {
+	return &PricingService{}
+}
+
+func (s *PricingService) PriceStakingAssets(ctx context.Context) ([]*payapi.StakingAssetRatio, error) {
+	chips, err := s.StakingAssetService.FindStakingAssetByAssetID(ctx, payapi.StakingRewardAssetId)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, err := s.StakingAssetService.FindStakingAssets(ctx, payapi.StakingAssetFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	ratios := make([]*payapi.StakingAssetRatio, 0)
+
+	for _, asset := range assets {
+		if asset.PriceSource != payapi.StakingPriceSourceChipRatio || asset.PoolAddress == nil {
+			continue
+		}
+
+		// one pool failing doesn't keep the others from being priced, results fall back to its other ratios or the chip ratio
+		pr, err := s.PoolReservesSource.GetPoolReserves(ctx, *asset.PoolAddress, chips.AssetId, asset.AssetId)
+		if err != nil {
+			log.Printf("GetPoolReserves() %s failed err: %v\n", asset.Name, err)
+			continue
+		} else if pr.LiquidityIssued == 0 {
+			log.Printf("%s pool has no liquidity, not priced\n", asset.Name)
+			continue
+		}
+
+		ratio, _ := poolChipRatio(pr, chips.Decimals).Float64()
+
+		ratios = append(ratios, &payapi.StakingAssetRatio{
+			AssetId:         asset.AssetId,
+			Ratio:           ratio,
+			PoolAddress:     pr.Address,
+			Round:           pr.Round,
+			ChipReserve:     pr.ChipReserve,
+			LiquidityIssued: pr.LiquidityIssued,
+		})
+	}
+
+	return ratios, nil
+}
+
+// chips one whole pool token is worth, both sides of a pool are worth the same so a token is
+// twice its share of the chip reserve
+func poolChipRatio(pr *algo.PoolReserves, chipDecimals int) *big.Rat {
+	chips := new(big.Rat).SetFrac(new(big.Int).SetUint64(pr.ChipReserve), pow10(uint64(chipDecimals)))
+	issued := new(big.Rat).SetFrac(new(big.Int).SetUint64(pr.LiquidityIssued), pow10(pr.LiquidityDecimals))
+
+	ratio := new(big.Rat).Mul(chips, big.NewRat(2, 1))
+
+	return ratio.Quo(ratio, issued)
+}
+
+func pow10(n uint64) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), new(big.Int).SetUint64(n), nil)
+}
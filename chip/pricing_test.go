@@ -0,0 +1,72 @@
+package chip_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+	"github.com/algo-casino/payapi/chip"
+)
+
+// reserves by pool address, pools missing fail
+type fakePools map[string]*algo.PoolReserves
+
+func (f fakePools) GetPoolReserves(ctx context.Context, poolAddress string, chipAssetId, liquidityAssetId uint64) (*algo.PoolReserves, error) {
+	pr, ok := f[poolAddress]
+	if !ok {
+		return nil, errors.New("node unavailable")
+	}
+
+	return pr, nil
+}
+
+func (f *fakeAssets) FindStakingAssetByAssetID(ctx context.Context, assetId uint64) (*payapi.StakingAsset, error) {
+	for _, a := range f.assets {
+		if a.AssetId == assetId {
+			return a, nil
+		}
+	}
+
+	return nil, fmt.Errorf("asset %d is not a staking asset", assetId)
+}
+
+func TestPricingService_PriceStakingAssets(t *testing.T) {
+	// ensure ratios are taken from fixed reserves and failing pools are skipped
+
+	t.Run("OK", func(t *testing.T) {
+		pool := func(address string) *string { return &address }
+
+		assets := &fakeAssets{assets: []*payapi.StakingAsset{
+			{AssetId: payapi.StakingRewardAssetId, Name: "CHIP", Decimals: 1, PriceSource: payapi.StakingPriceSourceFixed},
+			{AssetId: 1, Name: "LP", PoolAddress: pool("POOL"), Decimals: 6, PriceSource: payapi.StakingPriceSourceChipRatio},
+			{AssetId: 2, Name: "DOWN", PoolAddress: pool("DOWN"), Decimals: 6, PriceSource: payapi.StakingPriceSourceChipRatio},
+			{AssetId: 3, Name: "EMPTY", PoolAddress: pool("EMPTY"), Decimals: 6, PriceSource: payapi.StakingPriceSourceChipRatio},
+			{AssetId: 4, Name: "FIXED", PoolAddress: pool("POOL"), Decimals: 6, PriceSource: payapi.StakingPriceSourceFixed},
+		}}
+
+		s := chip.NewPricingService()
+		s.StakingAssetService = assets
+		s.PoolReservesSource = fakePools{
+			// 5000 chips against 2500 whole pool tokens, a token is twice its share of the chips
+			"POOL":  {Address: "POOL", Round: 42, ChipReserve: 50000, LiquidityIssued: 2500000000, LiquidityDecimals: 6},
+			"EMPTY": {Address: "EMPTY", Round: 42, ChipReserve: 0, LiquidityIssued: 0, LiquidityDecimals: 6},
+		}
+
+		ratios, err := s.PriceStakingAssets(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ratios) != 1 {
+			t.Fatalf("len(ratios)=%v, want %v", len(ratios), 1)
+		}
+
+		r := ratios[0]
+		if r.AssetId != 1 || r.PoolAddress != "POOL" || r.Round != 42 || r.ChipReserve != 50000 || r.LiquidityIssued != 2500000000 {
+			t.Fatalf("unexpected ratio: %+v", r)
+		} else if r.Ratio != 4 {
+			t.Fatalf("Ratio=%v, want %v", r.Ratio, 4)
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package chip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+)
+
+var _ payapi.StakingCheckService = (*StakingCheckService)(nil)
+
+type (
+	StakingCheckService struct {
+		HoldingsSource           algo.HoldingsSource
+		StakingCommitmentService payapi.StakingCommitmentService
+		StakingAssetService      payapi.StakingAssetService
+		StakingCheckRunService   payapi.StakingCheckRunService
+		StakingResultService     payapi.StakingResultService
+
+		// pooled assets are priced at every check, if set
+		StakingPricingService payapi.StakingPricingService
+	}
+
+	// address -> asset id -> balance in base units, missing when none is held
+	holdingsMatrix map[string]map[uint64]uint64
+)
+
+func NewStakingCheckService() *StakingCheckService {
+	return &StakingCheckService{}
+}
+
+func (s *StakingCheckService) CheckStakingCommitments(ctx context.Context, stakingPeriodId int, dryRun bool) (*payapi.StakingCheckReport, error) {
+	stakingCommitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, fmt.Errorf("FindStakingCommitments() failed: %w", err)
+	}
+
+	assets, err := s.StakingAssetService.FindStakingAssets(ctx, payapi.StakingAssetFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("FindStakingAssets() failed: %w", err)
+	}
+
+	report := &payapi.StakingCheckReport{
+		StakingPeriodId: stakingPeriodId,
+		DryRun:          dryRun,
+		Commitments:     len(stakingCommitments),
+		Changes:         make([]*payapi.EligibilityChange, 0),
+		Warnings:        make([]string, 0),
+	}
+
+	// what every commitment holds, eligible or not, so results can be weighted by it
+	run := &payapi.StakingCheckRun{StakingPeriodId: stakingPeriodId}
+	report.Run = run
+
+	// and what pooled assets are worth in chips
+	if s.StakingPricingService != nil {
+		run.Ratios, err = s.StakingPricingService.PriceStakingAssets(ctx)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("PriceStakingAssets() failed! err: %v", err))
+		}
+	}
+
+	matrix, err := s.findHoldings(ctx, stakingCommitments, assets)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Verifications = verifyCommitments(stakingCommitments, assets, matrix)
+
+	commitments := make(map[int]*payapi.StakingCommitment, len(stakingCommitments))
+	for _, c := range stakingCommitments {
+		commitments[c.ID] = c
+	}
+
+	for _, v := range report.Verifications {
+		for _, a := range v.Assets {
+			run.Holdings = append(run.Holdings, &payapi.StakingHolding{
+				Address: v.Address,
+				AssetId: a.AssetId,
+				Amount:  a.Held,
+			})
+		}
+
+		if !v.Eligible {
+			continue
+		}
+
+		report.EligibleBefore++
+
+		if v.Met {
+			report.EligibleAfter++
+			continue
+		}
+
+		report.Changes = append(report.Changes, &payapi.EligibilityChange{
+			Commitment: commitments[v.StakingCommitmentId],
+			Event:      eligibilityEvent(v),
+		})
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// saved first so eligibility events can point at the run
+	if len(run.Holdings) > 0 || len(run.Ratios) > 0 {
+		err = s.StakingCheckRunService.CreateStakingCheckRun(ctx, run)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("CreateStakingCheckRun() staking period %d failed! err: %v", stakingPeriodId, err))
+		}
+	}
+
+	for _, change := range report.Changes {
+		if run.ID != 0 {
+			change.Event.StakingCheckRunId = &run.ID
+		}
+
+		// mark record as ineligible
+		_, err = s.StakingCommitmentService.UpdateEligibility(ctx, change.Commitment.ID, change.Event)
+		if err != nil {
+			log.Printf("UpdateEligibility() commitment %d failed err: %v\n", change.Commitment.ID, err)
+			report.Warnings = append(report.Warnings, fmt.Sprintf("failed to make user %s ineligible for staking period %d", change.Commitment.AlgorandAddress, stakingPeriodId))
+			report.EligibleAfter++
+			continue
+		}
+
+		change.Applied = true
+	}
+
+	return report, nil
+}
+
+// one lookup per asset anybody committed, only committed addresses are kept
+func (s *StakingCheckService) findHoldings(ctx context.Context, commitments []*payapi.StakingCommitment, assets []*payapi.StakingAsset) (holdingsMatrix, error) {
+	matrix := make(holdingsMatrix, len(commitments))
+	for _, c := range commitments {
+		matrix[c.AlgorandAddress] = make(map[uint64]uint64)
+	}
+
+	for _, asset := range assets {
+		// skip the lookup if nobody committed any
+		committed := false
+		for _, c := range commitments {
+			if c.AssetAmount(asset.AssetId) > 0 {
+				committed = true
+				break
+			}
+		}
+
+		if !committed {
+			continue
+		}
+
+		holding, err := s.HoldingsSource.GetAccountsWithAsset(ctx, asset.AssetId)
+		if err != nil {
+			return nil, fmt.Errorf("GetAccountsWithAsset() ASA ID: %d failed: %w", asset.AssetId, err)
+		}
+
+		for _, h := range holding {
+			if balances, ok := matrix[h.Address]; ok {
+				balances[asset.AssetId] = h.Amount
+			}
+		}
+	}
+
+	return matrix, nil
+}
+
+// checks every committed asset of every commitment against matrix, assets missing from the registry are left out
+func verifyCommitments(commitments []*payapi.StakingCommitment, assets []*payapi.StakingAsset, matrix holdingsMatrix) []*payapi.CommitmentVerification {
+	registry := make(map[uint64]*payapi.StakingAsset, len(assets))
+	for _, a := range assets {
+		registry[a.AssetId] = a
+	}
+
+	verifications := make([]*payapi.CommitmentVerification, 0, len(commitments))
+
+	for _, c := range commitments {
+		v := &payapi.CommitmentVerification{
+			StakingCommitmentId: c.ID,
+			Address:             c.AlgorandAddress,
+			Eligible:            c.Eligible,
+			Met:                 true,
+			Assets:              make([]*payapi.AssetVerification, 0, len(c.Assets)),
+		}
+
+		for _, item := range c.Assets {
+			asset, ok := registry[item.AssetId]
+			if !ok || item.Amount == 0 {
+				continue
+			}
+
+			held := matrix[c.AlgorandAddress][item.AssetId]
+
+			av := &payapi.AssetVerification{
+				AssetId:   item.AssetId,
+				Name:      asset.Name,
+				Committed: item.Amount,
+				Held:      held,
+				Met:       held >= item.Amount,
+			}
+
+			v.Met = v.Met && av.Met
+			v.Assets = append(v.Assets, av)
+		}
+
+		sort.Slice(v.Assets, func(i, j int) bool {
+			return v.Assets[i].AssetId < v.Assets[j].AssetId
+		})
+
+		verifications = append(verifications, v)
+	}
+
+	sort.Slice(verifications, func(i, j int) bool {
+		return verifications[i].StakingCommitmentId < verifications[j].StakingCommitmentId
+	})
+
+	return verifications
+}
+
+// the change a failed verification makes, the first short asset is recorded, every one is in the reason
+func eligibilityEvent(v *payapi.CommitmentVerification) *payapi.EligibilityEvent {
+	event := &payapi.EligibilityEvent{
+		StakingCommitmentId: v.StakingCommitmentId,
+		Eligible:            false,
+		Source:              payapi.EligibilitySourceCheck,
+	}
+
+	reasons := make([]string, 0, len(v.Assets))
+
+	for _, a := range v.Assets {
+		if a.Met {
+			continue
+		}
+
+		reasons = append(reasons, fmt.Sprintf("committed %d %s, holds %d", a.Committed, a.Name, a.Held))
+
+		if event.AssetId == nil {
+			assetId, committed, held := a.AssetId, a.Committed, a.Held
+			event.AssetId = &assetId
+			event.Committed = &committed
+			event.Balance = &held
+		}
+	}
+
+	event.Reason = strings.Join(reasons, "; ")
+
+	return event
+}
+
+func (s *StakingCheckService) PreviewStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*payapi.StakingResultPreview, error) {
+	sr, err := s.StakingResultService.CalculateStakingResult(ctx, stakingPeriodId, totalProfit, weighting)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &payapi.StakingResultPreview{
+		Result:  sr,
+		Changes: make([]*payapi.StakingRewardChange, 0, len(sr.Results)),
+	}
+
+	results, err := s.StakingResultService.FindStakingResults(ctx, payapi.StakingResultFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	} else if len(results) > 0 {
+		preview.Current = results[0]
+	}
+
+	changes := make(map[string]*payapi.StakingRewardChange)
+
+	change := func(address string) *payapi.StakingRewardChange {
+		c, ok := changes[address]
+		if !ok {
+			c = &payapi.StakingRewardChange{Address: address}
+			changes[address] = c
+			preview.Changes = append(preview.Changes, c)
+		}
+		return c
+	}
+
+	for _, item := range sr.Results {
+		change(item.Address).Preview = item.Reward
+	}
+
+	if preview.Current != nil {
+		for _, item := range preview.Current.Results {
+			change(item.Address).Current = item.Reward
+		}
+	}
+
+	// only what differs
+	n := 0
+	for _, c := range preview.Changes {
+		if c.Current != c.Preview {
+			preview.Changes[n] = c
+			n++
+		}
+	}
+	preview.Changes = preview.Changes[:n]
+
+	sort.Slice(preview.Changes, func(i, j int) bool {
+		return preview.Changes[i].Address < preview.Changes[j].Address
+	})
+
+	return preview, nil
+}
@@ -0,0 +1,200 @@
+package chip_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/chip"
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+// balances by asset id, counts lookups
+type fakeHoldings struct {
+	balances map[uint64][]models.MiniAssetHolding
+	lookups  map[uint64]int
+	err      error
+}
+
+func (f *fakeHoldings) GetAccountsWithAsset(ctx context.Context, assetId uint64) ([]models.MiniAssetHolding, error) {
+	if f.lookups == nil {
+		f.lookups = make(map[uint64]int)
+	}
+	f.lookups[assetId]++
+
+	return f.balances[assetId], f.err
+}
+
+type fakeCommitments struct {
+	payapi.StakingCommitmentService
+
+	commitments []*payapi.StakingCommitment
+	events      map[int]*payapi.EligibilityEvent
+}
+
+func (f *fakeCommitments) FindStakingCommitments(ctx context.Context, filter payapi.StakingCommitmentFilter) ([]*payapi.StakingCommitment, error) {
+	return f.commitments, nil
+}
+
+func (f *fakeCommitments) UpdateEligibility(ctx context.Context, id int, event *payapi.EligibilityEvent) (*payapi.StakingCommitment, error) {
+	if f.events == nil {
+		f.events = make(map[int]*payapi.EligibilityEvent)
+	}
+	f.events[id] = event
+
+	for _, c := range f.commitments {
+		if c.ID == id {
+			c.Eligible = event.Eligible
+			return c, nil
+		}
+	}
+
+	return nil, payapi.ErrStakingCommitmentNotFound
+}
+
+type fakeAssets struct {
+	payapi.StakingAssetService
+
+	assets []*payapi.StakingAsset
+}
+
+func (f *fakeAssets) FindStakingAssets(ctx context.Context, filter payapi.StakingAssetFilter) ([]*payapi.StakingAsset, error) {
+	return f.assets, nil
+}
+
+type fakeCheckRuns struct {
+	payapi.StakingCheckRunService
+
+	runs []*payapi.StakingCheckRun
+}
+
+func (f *fakeCheckRuns) CreateStakingCheckRun(ctx context.Context, run *payapi.StakingCheckRun) error {
+	f.runs = append(f.runs, run)
+	run.ID = len(f.runs)
+	return nil
+}
+
+const (
+	chips = uint64(1)
+	lp    = uint64(2)
+	xalgo = uint64(3)
+)
+
+func newCheckService() (*chip.StakingCheckService, *fakeHoldings, *fakeCommitments, *fakeCheckRuns) {
+	holdings := &fakeHoldings{
+		balances: map[uint64][]models.MiniAssetHolding{
+			chips: {{Address: "AAAA", Amount: 100}, {Address: "CCCC", Amount: 5}, {Address: "NOBODY", Amount: 1}},
+			lp:    {{Address: "AAAA", Amount: 10}},
+			xalgo: {{Address: "BBBB", Amount: 50}, {Address: "CCCC", Amount: 1}},
+		},
+	}
+
+	commitments := &fakeCommitments{
+		commitments: []*payapi.StakingCommitment{
+			// holds everything
+			{ID: 1, AlgorandAddress: "AAAA", Eligible: true, Assets: []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 100}, {AssetId: lp, Amount: 10}}},
+			// only xALGO, missing from every earlier lookup
+			{ID: 2, AlgorandAddress: "BBBB", Eligible: true, Assets: []*payapi.StakingCommitmentItem{{AssetId: xalgo, Amount: 50}}},
+			// short on both
+			{ID: 3, AlgorandAddress: "CCCC", Eligible: true, Assets: []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 10}, {AssetId: xalgo, Amount: 2}}},
+			// already ineligible, still short
+			{ID: 4, AlgorandAddress: "DDDD", Eligible: false, Assets: []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 10}}},
+		},
+	}
+
+	runs := &fakeCheckRuns{}
+
+	s := chip.NewStakingCheckService()
+	s.HoldingsSource = holdings
+	s.StakingCommitmentService = commitments
+	s.StakingAssetService = &fakeAssets{assets: []*payapi.StakingAsset{
+		{AssetId: chips, Name: "CHIP"},
+		{AssetId: lp, Name: "LP"},
+		{AssetId: xalgo, Name: "xALGO"},
+		{AssetId: 4, Name: "unused"},
+	}}
+	s.StakingCheckRunService = runs
+
+	return s, holdings, commitments, runs
+}
+
+func TestStakingCheckService_CheckStakingCommitments(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		s, holdings, commitments, runs := newCheckService()
+
+		report, err := s.CheckStakingCommitments(context.Background(), 1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// one lookup per committed asset
+		if want := map[uint64]int{chips: 1, lp: 1, xalgo: 1}; !reflect.DeepEqual(holdings.lookups, want) {
+			t.Fatalf("lookups=%v, want %v", holdings.lookups, want)
+		}
+
+		met := make(map[string]bool)
+		for _, v := range report.Verifications {
+			met[v.Address] = v.Met
+		}
+
+		if want := map[string]bool{"AAAA": true, "BBBB": true, "CCCC": false, "DDDD": false}; !reflect.DeepEqual(met, want) {
+			t.Fatalf("met=%v, want %v", met, want)
+		}
+
+		// every asset checked on its own
+		if v := report.Verifications[2]; len(v.Assets) != 2 || v.Assets[0].Met || v.Assets[1].Met || v.Assets[0].Held != 5 || v.Assets[1].Held != 1 {
+			t.Fatalf("unexpected CCCC verification: %+v", v.Assets)
+		}
+
+		if report.EligibleBefore != 3 || report.EligibleAfter != 2 {
+			t.Fatalf("eligible %d -> %d, want 3 -> 2", report.EligibleBefore, report.EligibleAfter)
+		} else if len(report.Changes) != 1 || !report.Changes[0].Applied {
+			t.Fatalf("unexpected changes: %v", report.Changes)
+		}
+
+		event := commitments.events[3]
+		if event == nil || event.Eligible || *event.AssetId != chips || *event.Balance != 5 || *event.StakingCheckRunId != 1 {
+			t.Fatalf("unexpected event: %+v", event)
+		} else if event.Reason != "committed 10 CHIP, holds 5; committed 2 xALGO, holds 1" {
+			t.Fatalf("Reason=%q", event.Reason)
+		} else if len(commitments.events) != 1 {
+			t.Fatalf("len(events)=%d, want %d", len(commitments.events), 1)
+		}
+
+		// ineligible commitments are recorded too
+		if len(runs.runs) != 1 || len(runs.runs[0].Holdings) != 6 {
+			t.Fatalf("unexpected runs: %v", runs.runs)
+		}
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		s, _, commitments, runs := newCheckService()
+
+		report, err := s.CheckStakingCommitments(context.Background(), 1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(report.Changes) != 1 || report.Changes[0].Applied || report.Changes[0].Commitment.ID != 3 {
+			t.Fatalf("unexpected changes: %v", report.Changes)
+		} else if len(commitments.events) != 0 || len(runs.runs) != 0 {
+			t.Fatal("dry run saved changes")
+		} else if !commitments.commitments[2].Eligible {
+			t.Fatal("dry run changed eligibility")
+		}
+	})
+
+	t.Run("ErrLookup", func(t *testing.T) {
+		s, holdings, commitments, runs := newCheckService()
+		holdings.err = errors.New("indexer down")
+
+		_, err := s.CheckStakingCommitments(context.Background(), 1, false)
+		if err == nil {
+			t.Fatal("expected error")
+		} else if len(commitments.events) != 0 || len(runs.runs) != 0 {
+			t.Fatal("failed lookup saved changes")
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package chip
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+)
+
+var _ payapi.StakingDashboardService = (*StakingDashboardService)(nil)
+
+type StakingDashboardService struct {
+	NodeService                algo.NodeService
+	StakingPeriodService       payapi.StakingPeriodService
+	StakingCommitmentService   payapi.StakingCommitmentService
+	StakingAssetService        payapi.StakingAssetService
+	StakingCheckRunService     payapi.StakingCheckRunService
+	StakingResultService       payapi.StakingResultService
+	StakingPayoutService       payapi.StakingPayoutService
+	StakeProfitSnapshotService payapi.StakeProfitSnapshotService
+}
+
+func NewStakingDashboardService() *StakingDashboardService {
+	return &StakingDashboardService{}
+}
+
+func (s *StakingDashboardService) GetStakingDashboard(ctx context.Context, address string) (*payapi.StakingDashboard, error) {
+	commitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{AlgorandAddress: &address})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &payapi.StakingDashboard{
+		Address: address,
+		Periods: make([]*payapi.StakingDashboardPeriod, 0, len(commitments)),
+	}
+
+	if len(commitments) == 0 {
+		return d, nil
+	}
+
+	assets, err := s.StakingAssetService.FindStakingAssets(ctx, payapi.StakingAssetFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint64]string, len(assets))
+	for _, a := range assets {
+		names[a.AssetId] = a.Name
+	}
+
+	// one lookup covers every period
+	balances, err := s.NodeService.GetAssetBalances(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range commitments {
+		sp, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, c.StakingPeriodID)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &payapi.StakingDashboardPeriod{
+			StakingPeriod: sp,
+			Commitment:    c,
+			Assets:        make([]*payapi.StakingDashboardAsset, 0, len(c.Assets)),
+		}
+
+		for _, item := range c.Assets {
+			p.Assets = append(p.Assets, &payapi.StakingDashboardAsset{
+				AssetId:   item.AssetId,
+				Name:      names[item.AssetId],
+				Committed: item.Amount,
+				Held:      balances[item.AssetId],
+			})
+		}
+
+		p.Checks, err = s.findChecks(ctx, c, names)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Eligibility, err = s.StakingCommitmentService.FindEligibilityEvents(ctx, payapi.EligibilityEventFilter{StakingCommitmentId: &c.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		results, err := s.StakingResultService.FindStakingResults(ctx, payapi.StakingResultFilter{StakingPeriodId: &sp.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(results) > 0 {
+			p.Reward = resultItem(results[0], address)
+
+			payouts, err := s.StakingPayoutService.FindStakingPayouts(ctx, payapi.StakingPayoutFilter{StakingPeriodId: &sp.ID, Address: &address})
+			if err != nil {
+				return nil, err
+			} else if len(payouts) > 0 {
+				p.Payout = payouts[len(payouts)-1]
+			}
+		} else if sp.Status != payapi.StakingPeriodStatusScheduled {
+			s.project(ctx, p, address)
+		}
+
+		d.Periods = append(d.Periods, p)
+	}
+
+	return d, nil
+}
+
+// what check runs saw of the commitment, ordered by time
+func (s *StakingDashboardService) findChecks(ctx context.Context, c *payapi.StakingCommitment, names map[uint64]string) ([]*payapi.StakingDashboardCheck, error) {
+	holdings, err := s.StakingCheckRunService.FindStakingHoldings(ctx, payapi.StakingHoldingFilter{StakingPeriodId: &c.StakingPeriodID, Address: &c.AlgorandAddress})
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]*payapi.StakingDashboardCheck, 0, len(holdings))
+
+	for _, h := range holdings {
+		check := &payapi.StakingDashboardCheck{
+			StakingHolding: h,
+			Committed:      c.AssetAmount(h.AssetId),
+		}
+
+		check.Met = h.Amount >= check.Committed
+		if !check.Met {
+			check.Reason = fmt.Sprintf("held %d of %d %s committed", h.Amount, check.Committed, names[h.AssetId])
+		}
+
+		checks = append(checks, check)
+	}
+
+	sort.SliceStable(checks, func(i, j int) bool {
+		return checks[i].CreatedAt.Before(checks[j].CreatedAt)
+	})
+
+	return checks, nil
+}
+
+// reward if the latest profit snapshot were final, left out if there's nothing to go on
+func (s *StakingDashboardService) project(ctx context.Context, p *payapi.StakingDashboardPeriod, address string) {
+	snapshot, err := s.StakeProfitSnapshotService.GetLastKnownProfitForPeriod(ctx, p.StakingPeriod.ID)
+	if err != nil || snapshot.Profit <= 0 {
+		return
+	}
+
+	p.ProjectedProfit = snapshot
+
+	sr, err := s.StakingResultService.CalculateStakingResult(ctx, p.StakingPeriod.ID, uint64(math.Floor(snapshot.Profit)), payapi.StakingWeightingCommitment)
+	if err != nil {
+		log.Printf("CalculateStakingResult() period %d failed err: %v\n", p.StakingPeriod.ID, err)
+		return
+	}
+
+	p.ProjectedReward = resultItem(sr, address)
+}
+
+func resultItem(sr *payapi.StakingResult, address string) *payapi.StakingResultItem {
+	for _, item := range sr.Results {
+		if item.Address == address {
+			return item
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package chip
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+)
+
+var _ payapi.StakingExportService = (*StakingExportService)(nil)
+
+type (
+	StakingExportService struct {
+		StakingPeriodService     payapi.StakingPeriodService
+		StakingCommitmentService payapi.StakingCommitmentService
+		StakingCheckRunService   payapi.StakingCheckRunService
+		StakingAssetService      payapi.StakingAssetService
+		StakingResultService     payapi.StakingResultService
+
+		// house account exports are signed with, nothing can be signed when nil
+		AccountService *algo.AccountService
+	}
+)
+
+func NewStakingExportService() *StakingExportService {
+	return &StakingExportService{}
+}
+
+func (s *StakingExportService) ExportStakingResult(ctx context.Context, stakingResultId int) (*payapi.StakingResultExport, error) {
+	sr, err := s.StakingResultService.FindStakingResultByID(ctx, stakingResultId)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, sr.StakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &payapi.StakingResultExport{
+		StakingResultId: sr.ID,
+		StakingPeriod: &payapi.StakingExportPeriod{
+			ID:                sp.ID,
+			RegistrationBegin: sp.RegistrationBegin.UTC(),
+			RegistrationEnd:   sp.RegistrationEnd.UTC(),
+			CommitmentBegin:   sp.CommitmentBegin.UTC(),
+			CommitmentEnd:     sp.CommitmentEnd.UTC(),
+			ChipRatio:         sp.ChipRatio,
+			FundingGames:      sr.FundingGames,
+		},
+		Profit:      sr.Profit,
+		HouseFee:    sr.HouseFee,
+		Unallocated: sr.Unallocated,
+		Weighting:   sr.Weighting,
+		Policy:      sr.Policy,
+		AssetRatios: sr.AssetRatios,
+		Rewards:     make([]*payapi.StakingExportReward, 0, len(sr.Results)),
+		CreatedAt:   sr.CreatedAt.UTC(),
+	}
+
+	if export.AssetRatios == nil {
+		export.AssetRatios = make(map[uint64]float64)
+	}
+
+	// saved before funding games were recorded with results
+	if sr.Policy == nil {
+		export.StakingPeriod.FundingGames = sp.FundingGames
+	}
+
+	if export.StakingPeriod.FundingGames == nil {
+		export.StakingPeriod.FundingGames = make([]string, 0)
+	}
+
+	for _, item := range sr.Results {
+		reward := &payapi.StakingExportReward{
+			Address: item.Address,
+			Reward:  item.Reward,
+			Boosts:  item.Boosts,
+		}
+
+		if reward.Boosts == nil {
+			reward.Boosts = make([]*payapi.StakingBoost, 0)
+		}
+
+		export.Rewards = append(export.Rewards, reward)
+	}
+
+	sort.Slice(export.Rewards, func(i, j int) bool {
+		return export.Rewards[i].Address < export.Rewards[j].Address
+	})
+
+	// inputs as they were when the result was saved, results saved before that hash them as they are now
+	export.Inputs = sr.Inputs
+	if export.Inputs == nil {
+		export.Inputs, err = s.hashInputs(ctx, sp.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return export, nil
+}
+
+// hashes what the result of a period is worked out from as it is now
+func (s *StakingExportService) hashInputs(ctx context.Context, stakingPeriodId int) (*payapi.StakingExportInputs, error) {
+	commitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, err := s.StakingCheckRunService.FindStakingHoldings(ctx, payapi.StakingHoldingFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	ratios, err := s.StakingAssetService.FindStakingAssetRatios(ctx, payapi.StakingAssetRatioFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	return payapi.HashStakingInputs(commitments, holdings, ratios)
+}
+
+func (s *StakingExportService) SignStakingResultExport(ctx context.Context, export *payapi.StakingResultExport) (*payapi.SignedStakingResultExport, error) {
+	if s.AccountService == nil {
+		return nil, payapi.ErrNoSigningKey
+	}
+
+	document, err := json.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := s.AccountService.SignBytes(document)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payapi.SignedStakingResultExport{
+		Document:  document,
+		Signer:    s.AccountService.AccountAddress,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
@@ -3,6 +3,7 @@ package chip
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/algo-casino/payapi"
 	"github.com/algo-casino/payapi/algo"
@@ -12,20 +13,14 @@ var _ payapi.StakingNftService = (*StakingNftService)(nil)
 
 type (
 	StakingNftService struct {
-		IndexerService           algo.IndexerService
+		HoldingsSource           algo.HoldingsSource
 		StakingCommitmentService payapi.StakingCommitmentService
-		addressDenylist          []string
-	}
+		StakingAssetService      payapi.StakingAssetService
 
-	autoStakeEntry struct {
-		LiquidityCommitment   uint64
-		LiquidityCommitmentV2 uint64
+		// collections, caps and mode
+		Policy payapi.AutoStakePolicy
 
-		// new liquid targets
-		CAlgoCommitment uint64
-		TAlgoCommitment uint64
-		MAlgoCommitment uint64
-		XAlgoCommitment uint64
+		addressDenylist []string
 	}
 )
 
@@ -47,253 +42,257 @@ func NewStakingNftService(addressDenylist []string) *StakingNftService {
 	}
 }
 
-func (s *StakingNftService) CreateAutoStake(ctx context.Context, stakingPeriodId int) error {
-	// bad wording, is actually who has more than 0..
-	nftHolders, err := s.IndexerService.GetAccountsWithMinimumAssetBalance(context.TODO(), 1032365802, 0)
+func (s *StakingNftService) CreateAutoStake(ctx context.Context, stakingPeriodId int) (*payapi.AutoStakeReport, error) {
+	err := s.Policy.Validate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	holders := 0
-
-	as := make(map[string]autoStakeEntry, 0)
-
-	for _, mah := range nftHolders {
-		if mah.Amount > 0 {
-			if s.isAddressDenied(mah.Address) {
-				fmt.Printf("Holder %s is on denylist, ignored\n", mah.Address)
-				continue
-			}
-
-			fmt.Printf("%s holds %d nft\n", mah.Address, mah.Amount)
+	report := &payapi.AutoStakeReport{
+		StakingPeriodId: stakingPeriodId,
+		Mode:            s.Policy.Mode,
+		Created:         make([]*payapi.AutoStakeEntry, 0),
+		Updated:         make([]*payapi.AutoStakeEntry, 0),
+		Skipped:         make([]*payapi.AutoStakeSkip, 0),
+	}
 
-			as[mah.Address] = autoStakeEntry{
-				LiquidityCommitment:   0,
-				LiquidityCommitmentV2: 0,
-				CAlgoCommitment:       0,
-				TAlgoCommitment:       0,
-				MAlgoCommitment:       0,
-				XAlgoCommitment:       0,
-			}
-			holders++
-		}
+	nfts, err := s.countNfts(ctx, report)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("total auto stake %d\n", len(as))
+	active := true
 
-	lpHolding, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 552665159)
+	assets, err := s.StakingAssetService.FindStakingAssets(ctx, payapi.StakingAssetFilter{Active: &active})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, v := range lpHolding {
-		if v.Amount <= 0 {
+	// whole balance of every auto staked asset holders have
+	balances := make(holdingsMatrix, len(nfts))
+	for address := range nfts {
+		balances[address] = make(map[uint64]uint64)
+	}
+
+	for _, asset := range assets {
+		if !asset.AutoStake {
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   v.Amount,
-				LiquidityCommitmentV2: as[v.Address].LiquidityCommitmentV2,
-				CAlgoCommitment:       as[v.Address].CAlgoCommitment,
-				TAlgoCommitment:       as[v.Address].TAlgoCommitment,
-				MAlgoCommitment:       as[v.Address].MAlgoCommitment,
-				XAlgoCommitment:       as[v.Address].XAlgoCommitment,
+		holding, err := s.HoldingsSource.GetAccountsWithAsset(ctx, asset.AssetId)
+		if err != nil {
+			return nil, fmt.Errorf("GetAccountsWithAsset() ASA ID: %d failed: %w", asset.AssetId, err)
+		}
+
+		for _, h := range holding {
+			if b, ok := balances[h.Address]; ok && h.Amount > 0 {
+				b[asset.AssetId] = h.Amount
 			}
 		}
 	}
 
-	lpHoldingV2, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 1002609713)
+	currentCommitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	existing := make(map[string]*payapi.StakingCommitment, len(currentCommitments))
+	for _, sc := range currentCommitments {
+		existing[sc.AlgorandAddress] = sc
+	}
+
+	// ordered so reports compare
+	addresses := make([]string, 0, len(nfts))
+	for address := range nfts {
+		addresses = append(addresses, address)
 	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		skip := func(reason string) {
+			report.Skipped = append(report.Skipped, &payapi.AutoStakeSkip{Address: address, Reason: reason})
+		}
 
-	for _, v := range lpHoldingV2 {
-		if v.Amount <= 0 {
+		auto := s.autoStakeItems(assets, balances[address], nfts[address])
+		if len(auto) == 0 {
+			skip("holds no auto staked assets")
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   as[v.Address].LiquidityCommitment,
-				LiquidityCommitmentV2: v.Amount,
-				CAlgoCommitment:       as[v.Address].CAlgoCommitment,
-				TAlgoCommitment:       as[v.Address].TAlgoCommitment,
-				MAlgoCommitment:       as[v.Address].MAlgoCommitment,
-				XAlgoCommitment:       as[v.Address].XAlgoCommitment,
-			}
+		entry := &payapi.AutoStakeEntry{
+			Address: address,
+			Nfts:    nfts[address],
 		}
-	}
 
-	cAlgoHolding, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 2562903034)
-	if err != nil {
-		return err
-	}
+		cc, ok := existing[address]
+		if !ok {
+			sc := &payapi.StakingCommitment{
+				StakingPeriodID: stakingPeriodId,
+				AlgorandAddress: address,
+				Assets:          auto,
+			}
 
-	for _, v := range cAlgoHolding {
-		if v.Amount <= 0 {
+			err := s.StakingCommitmentService.CreateStakingCommitment(ctx, sc)
+			if err != nil {
+				skip(fmt.Sprintf("CreateStakingCommitment() failed: %v", err))
+				continue
+			}
+
+			entry.Assets = sc.Assets
+			report.Created = append(report.Created, entry)
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   as[v.Address].LiquidityCommitment,
-				LiquidityCommitmentV2: as[v.Address].LiquidityCommitmentV2,
-				CAlgoCommitment:       v.Amount,
-				TAlgoCommitment:       as[v.Address].TAlgoCommitment,
-				MAlgoCommitment:       as[v.Address].MAlgoCommitment,
-				XAlgoCommitment:       as[v.Address].XAlgoCommitment,
-			}
+		items := s.mergeItems(assets, cc.Assets, auto)
+		if sameItems(items, cc.Assets) {
+			skip("commitment unchanged")
+			continue
 		}
-	}
 
-	tAlgoHolding, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 2545480441)
-	if err != nil {
-		return err
-	}
+		sc := &payapi.StakingCommitment{
+			ID:              cc.ID,
+			StakingPeriodID: cc.StakingPeriodID,
+			Assets:          items,
+		}
 
-	for _, v := range tAlgoHolding {
-		if v.Amount <= 0 {
+		err = s.StakingCommitmentService.UpdateStakingCommitment(ctx, sc)
+		if err != nil {
+			skip(fmt.Sprintf("UpdateStakingCommitment() failed: %v", err))
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   as[v.Address].LiquidityCommitment,
-				LiquidityCommitmentV2: as[v.Address].LiquidityCommitmentV2,
-				CAlgoCommitment:       as[v.Address].CAlgoCommitment,
-				TAlgoCommitment:       v.Amount,
-				MAlgoCommitment:       as[v.Address].MAlgoCommitment,
-				XAlgoCommitment:       as[v.Address].XAlgoCommitment,
+		entry.Assets = sc.Assets
+		report.Updated = append(report.Updated, entry)
+	}
+
+	return report, nil
+}
+
+// NFTs counted per holder over every collection, denied holders are reported as skipped
+func (s *StakingNftService) countNfts(ctx context.Context, report *payapi.AutoStakeReport) (map[string]uint64, error) {
+	held := make(holdingsMatrix)
+
+	for _, c := range s.Policy.Collections {
+		for _, id := range c.AssetIds {
+			holding, err := s.HoldingsSource.GetAccountsWithAsset(ctx, id)
+			if err != nil {
+				return nil, fmt.Errorf("GetAccountsWithAsset() NFT %d failed: %w", id, err)
+			}
+
+			for _, h := range holding {
+				if h.Amount == 0 {
+					continue
+				}
+
+				if _, ok := held[h.Address]; !ok {
+					held[h.Address] = make(map[uint64]uint64)
+				}
+				held[h.Address][id] = h.Amount
 			}
 		}
 	}
 
-	mAlgoHolding, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 2536627349)
-	if err != nil {
-		return err
-	}
+	nfts := make(map[string]uint64, len(held))
+	denied := make([]string, 0)
 
-	for _, v := range mAlgoHolding {
-		if v.Amount <= 0 {
+	for address, balances := range held {
+		if s.isAddressDenied(address) {
+			denied = append(denied, address)
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   as[v.Address].LiquidityCommitment,
-				LiquidityCommitmentV2: as[v.Address].LiquidityCommitmentV2,
-				CAlgoCommitment:       as[v.Address].CAlgoCommitment,
-				TAlgoCommitment:       as[v.Address].TAlgoCommitment,
-				MAlgoCommitment:       v.Amount,
-				XAlgoCommitment:       as[v.Address].XAlgoCommitment,
-			}
+		for _, c := range s.Policy.Collections {
+			nfts[address] += c.Count(balances)
 		}
 	}
 
-	xAlgoHolding, err := s.IndexerService.GetAccountsWithAsset(context.Background(), 2520645026)
-	if err != nil {
-		return err
+	sort.Strings(denied)
+	for _, address := range denied {
+		report.Skipped = append(report.Skipped, &payapi.AutoStakeSkip{Address: address, Reason: "on denylist"})
 	}
 
-	for _, v := range xAlgoHolding {
-		if v.Amount <= 0 {
+	return nfts, nil
+}
+
+// what the policy commits of each auto staked asset held, in registry order
+func (s *StakingNftService) autoStakeItems(assets []*payapi.StakingAsset, balances map[uint64]uint64, nfts uint64) []*payapi.StakingCommitmentItem {
+	items := make([]*payapi.StakingCommitmentItem, 0)
+
+	for _, asset := range assets {
+		amount := balances[asset.AssetId]
+		if !asset.AutoStake || amount == 0 {
 			continue
 		}
 
-		if _, ok := as[v.Address]; ok {
-			// add their v1 token to the list
-			as[v.Address] = autoStakeEntry{
-				LiquidityCommitment:   as[v.Address].LiquidityCommitment,
-				LiquidityCommitmentV2: as[v.Address].LiquidityCommitmentV2,
-				CAlgoCommitment:       as[v.Address].CAlgoCommitment,
-				TAlgoCommitment:       as[v.Address].TAlgoCommitment,
-				MAlgoCommitment:       as[v.Address].MAlgoCommitment,
-				XAlgoCommitment:       v.Amount,
-			}
+		if limit, ok := s.Policy.CapPerNft[asset.AssetId]; ok && limit > 0 && nfts*limit < amount {
+			amount = nfts * limit
 		}
-	}
 
-	currentCommitments, err := s.StakingCommitmentService.FindStakingCommitments(context.TODO(), payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-		return err
+		if amount > 0 {
+			items = append(items, &payapi.StakingCommitmentItem{AssetId: asset.AssetId, Amount: amount})
+		}
 	}
 
-	fmt.Printf("len(currentCommitments): %d\n", len(currentCommitments))
+	return items
+}
 
-	checkCommitment := func(address string) *payapi.StakingCommitment {
-		for _, sc := range currentCommitments {
-			if sc.AlgorandAddress == address {
-				return sc
-			}
+// current commitment combined with what auto staking commits, as the policy's mode says
+// assets that aren't auto staked (eg chips) are always kept
+func (s *StakingNftService) mergeItems(assets []*payapi.StakingAsset, current, auto []*payapi.StakingCommitmentItem) []*payapi.StakingCommitmentItem {
+	items := make([]*payapi.StakingCommitmentItem, 0, len(current)+len(auto))
+	committed := make(map[uint64]bool, len(current))
+
+	for _, item := range current {
+		if s.Policy.Mode == payapi.AutoStakeModeReplace && isAutoStaked(assets, item.AssetId) {
+			continue
 		}
 
-		return nil
+		items = append(items, item)
+		committed[item.AssetId] = true
 	}
 
-	for k, ase := range as {
-		//fmt.Printf("Address: %s ase: %v\n", k, ase)
-
-		// skip if there's nothing to commit
-		if ase.LiquidityCommitment == 0 && ase.LiquidityCommitmentV2 == 0 && ase.CAlgoCommitment == 0 && ase.TAlgoCommitment == 0 && ase.MAlgoCommitment == 0 && ase.XAlgoCommitment == 0 {
-			fmt.Printf("k: %v has zero LP, skipping\n", k)
-			continue
+	for _, item := range auto {
+		if !committed[item.AssetId] {
+			items = append(items, item)
 		}
+	}
 
-		cc := checkCommitment(k)
-		if cc != nil {
-			fmt.Printf("k: %v already has a commitment, updating\n", k)
-			// already has a commitment
-			nsc := &payapi.StakingCommitment{
-				ID:                    cc.ID,
-				StakingPeriodID:       cc.StakingPeriodID,
-				ChipCommitment:        cc.ChipCommitment,
-				LiquidityCommitment:   ase.LiquidityCommitment,
-				LiquidityCommitmentV2: ase.LiquidityCommitmentV2,
-				CAlgoCommitment:       ase.CAlgoCommitment,
-				TAlgoCommitment:       ase.TAlgoCommitment,
-				MAlgoCommitment:       ase.MAlgoCommitment,
-				XAlgoCommitment:       ase.XAlgoCommitment,
-			}
-			err := s.StakingCommitmentService.UpdateStakingCommitment(context.TODO(), nsc)
-			if err != nil {
-				fmt.Printf("err: %v\n", err)
-			}
-		} else {
-			fmt.Printf("k: %v does not have a commitment\n", k)
-
-			nsc := &payapi.StakingCommitment{
-				StakingPeriodID:       stakingPeriodId,
-				AlgorandAddress:       k,
-				ChipCommitment:        0,
-				LiquidityCommitment:   ase.LiquidityCommitment,
-				LiquidityCommitmentV2: ase.LiquidityCommitmentV2,
-				CAlgoCommitment:       ase.CAlgoCommitment,
-				TAlgoCommitment:       ase.TAlgoCommitment,
-				MAlgoCommitment:       ase.MAlgoCommitment,
-				XAlgoCommitment:       ase.XAlgoCommitment,
-			}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].AssetId < items[j].AssetId
+	})
 
-			err := s.StakingCommitmentService.CreateStakingCommitment(context.TODO(), nsc)
-			if err != nil {
-				fmt.Printf("err: %v\n", err)
-			}
+	return items
+}
+
+func sameItems(a, b []*payapi.StakingCommitmentItem) bool {
+	sc := &payapi.StakingCommitment{Assets: b}
+
+	n := 0
+	for _, item := range a {
+		if sc.AssetAmount(item.AssetId) != item.Amount {
+			return false
+		} else if item.Amount > 0 {
+			n++
 		}
 	}
 
-	currentCommitments, err = s.StakingCommitmentService.FindStakingCommitments(context.TODO(), payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
-	if err != nil {
-		fmt.Printf("err: %v\n", err)
-		return err
+	m := 0
+	for _, item := range b {
+		if item.Amount > 0 {
+			m++
+		}
 	}
 
-	fmt.Printf("len(currentCommitments): %d\n", len(currentCommitments))
+	return n == m
+}
 
-	return nil
+// is assetId one of the registry's auto staked assets
+func isAutoStaked(assets []*payapi.StakingAsset, assetId uint64) bool {
+	for _, asset := range assets {
+		if asset.AssetId == assetId {
+			return asset.AutoStake
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,142 @@
+package chip_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/chip"
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+)
+
+func (f *fakeCommitments) CreateStakingCommitment(ctx context.Context, sc *payapi.StakingCommitment) error {
+	sc.ID = len(f.commitments) + 1
+	sc.Eligible = true
+	f.commitments = append(f.commitments, sc)
+	return nil
+}
+
+func (f *fakeCommitments) UpdateStakingCommitment(ctx context.Context, sc *payapi.StakingCommitment) error {
+	for _, c := range f.commitments {
+		if c.ID == sc.ID {
+			c.Assets = sc.Assets
+			sc.AlgorandAddress = c.AlgorandAddress
+			sc.Eligible = c.Eligible
+			return nil
+		}
+	}
+
+	return payapi.ErrStakingCommitmentNotFound
+}
+
+const (
+	nftA = uint64(100)
+	nftB = uint64(101)
+)
+
+func newNftService(mode string) (*chip.StakingNftService, *fakeCommitments) {
+	holdings := &fakeHoldings{
+		balances: map[uint64][]models.MiniAssetHolding{
+			nftA:  {{Address: "AAAA", Amount: 1}, {Address: "BBBB", Amount: 5}, {Address: "DENY", Amount: 1}, {Address: "EEEE", Amount: 1}},
+			nftB:  {{Address: "AAAA", Amount: 1}},
+			lp:    {{Address: "AAAA", Amount: 1000}, {Address: "BBBB", Amount: 1000}, {Address: "DENY", Amount: 1000}},
+			xalgo: {{Address: "BBBB", Amount: 40}},
+		},
+	}
+
+	commitments := &fakeCommitments{
+		commitments: []*payapi.StakingCommitment{
+			// committed chips and some lp themselves
+			{ID: 1, AlgorandAddress: "BBBB", Eligible: true, Assets: []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 10}, {AssetId: lp, Amount: 20}}},
+		},
+	}
+
+	s := chip.NewStakingNftService([]string{"DENY"})
+	s.HoldingsSource = holdings
+	s.StakingCommitmentService = commitments
+	s.StakingAssetService = &fakeAssets{assets: []*payapi.StakingAsset{
+		{AssetId: chips, Name: "CHIP"},
+		{AssetId: lp, Name: "LP", AutoStake: true},
+		{AssetId: xalgo, Name: "xALGO", AutoStake: true},
+	}}
+	s.Policy = payapi.AutoStakePolicy{
+		Collections: []*payapi.AutoStakeCollection{
+			{Name: "a", AssetIds: []uint64{nftA}, MaxNfts: 3},
+			{Name: "b", AssetIds: []uint64{nftB}, Multiplier: 2},
+		},
+		Mode:      mode,
+		CapPerNft: map[uint64]uint64{lp: 100},
+	}
+
+	return s, commitments
+}
+
+func TestStakingNftService_CreateAutoStake(t *testing.T) {
+	t.Run("Merge", func(t *testing.T) {
+		s, commitments := newNftService(payapi.AutoStakeModeMerge)
+
+		report, err := s.CreateAutoStake(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// AAAA counts 1 + 1*2 NFTs, lp capped at 3*100
+		if len(report.Created) != 1 || report.Created[0].Address != "AAAA" || report.Created[0].Nfts != 3 {
+			t.Fatalf("unexpected created: %v", report.Created)
+		} else if want := []*payapi.StakingCommitmentItem{{AssetId: lp, Amount: 300}}; !reflect.DeepEqual(report.Created[0].Assets, want) {
+			t.Fatalf("Assets=%v, want %v", report.Created[0].Assets, want)
+		}
+
+		// BBBB keeps what they committed, only xALGO is added
+		if len(report.Updated) != 1 || report.Updated[0].Nfts != 3 {
+			t.Fatalf("unexpected updated: %v", report.Updated)
+		} else if want := []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 10}, {AssetId: lp, Amount: 20}, {AssetId: xalgo, Amount: 40}}; !reflect.DeepEqual(commitments.commitments[0].Assets, want) {
+			t.Fatalf("Assets=%v, want %v", commitments.commitments[0].Assets, want)
+		} else if commitments.commitments[0].AlgorandAddress != "BBBB" || !commitments.commitments[0].Eligible {
+			t.Fatal("update dropped address or eligibility")
+		}
+
+		skipped := make(map[string]string)
+		for _, skip := range report.Skipped {
+			skipped[skip.Address] = skip.Reason
+		}
+
+		if want := map[string]string{"DENY": "on denylist", "EEEE": "holds no auto staked assets"}; !reflect.DeepEqual(skipped, want) {
+			t.Fatalf("skipped=%v, want %v", skipped, want)
+		}
+
+		// again, nothing changes
+		report, err = s.CreateAutoStake(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(report.Created) != 0 || len(report.Updated) != 0 || len(report.Skipped) != 4 {
+			t.Fatalf("unexpected report: %+v", report)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		s, commitments := newNftService(payapi.AutoStakeModeReplace)
+
+		report, err := s.CreateAutoStake(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(report.Updated) != 1 {
+			t.Fatalf("unexpected updated: %v", report.Updated)
+		}
+
+		// lp raised to the cap, chips kept
+		if want := []*payapi.StakingCommitmentItem{{AssetId: chips, Amount: 10}, {AssetId: lp, Amount: 300}, {AssetId: xalgo, Amount: 40}}; !reflect.DeepEqual(commitments.commitments[0].Assets, want) {
+			t.Fatalf("Assets=%v, want %v", commitments.commitments[0].Assets, want)
+		}
+	})
+
+	t.Run("ErrPolicy", func(t *testing.T) {
+		s, _ := newNftService("overwrite")
+
+		_, err := s.CreateAutoStake(context.Background(), 1)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
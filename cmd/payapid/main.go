@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/algo-casino/payapi/chip"
 	"github.com/algo-casino/payapi/http"
 	"github.com/algo-casino/payapi/postgres"
+	"github.com/algo-casino/payapi/reward"
 	"github.com/algo-casino/payapi/slack"
 	"github.com/algo-casino/payapi/stake"
 	"github.com/algo-casino/payapi/utils"
@@ -64,6 +66,30 @@ func connectToStake() (*sql.DB, error) {
 	return db, nil
 }
 
+// NFT holders auto staked, AUTO_STAKE_POLICY is a json payapi.AutoStakePolicy
+// defaults to merging in whole balances for holders of the original collection
+func autoStakePolicy() payapi.AutoStakePolicy {
+	policy := payapi.AutoStakePolicy{
+		Collections: []*payapi.AutoStakeCollection{{Name: "house nft", AssetIds: []uint64{1032365802}}},
+		Mode:        payapi.AutoStakeModeMerge,
+	}
+
+	if v := os.Getenv("AUTO_STAKE_POLICY"); v != "" {
+		policy = payapi.AutoStakePolicy{}
+
+		err := json.Unmarshal([]byte(v), &policy)
+		if err != nil {
+			log.Fatalf("invalid AUTO_STAKE_POLICY: %v\n", err)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		log.Fatalf("invalid auto stake policy: %v\n", err)
+	}
+
+	return policy
+}
+
 func newApp() (*payapi.App, error) {
 	app := &payapi.App{}
 
@@ -98,6 +124,10 @@ func newApp() (*payapi.App, error) {
 	platformService := postgres.NewPlatformService(db.DB)
 	app.PlatformService = platformService
 
+	app.WebhookService = postgres.NewWebhookService(db.DB)
+
+	app.IdempotencyService = postgres.NewIdempotencyService(db.DB)
+
 	paymentService := postgres.NewPaymentService(db.DB)
 	app.PaymentService = paymentService
 
@@ -106,6 +136,14 @@ func newApp() (*payapi.App, error) {
 	paymentService.IndexerService = *indexerService
 	paymentService.NodeService = *nodeService
 
+	withdrawalService := postgres.NewWithdrawalService(db.DB)
+	withdrawalService.PlatformService = platformService
+	withdrawalService.IndexerService = *indexerService
+	app.WithdrawalService = withdrawalService
+
+	orphanDepositService := postgres.NewOrphanDepositService(db.DB)
+	app.OrphanDepositService = orphanDepositService
+
 	// attach stake service
 	// TODO: attach actual ssh tunnel stake db instance
 	stakeDatabase, err := connectToStake()
@@ -124,21 +162,54 @@ func newApp() (*payapi.App, error) {
 	app.CasinoRefundService = casinoRefundService
 
 	// staking services
+	stakingAssetService := postgres.NewStakingAssetService(db.DB)
+	app.StakingAssetService = stakingAssetService
+
+	// pooled assets are valued from their pool reserves
+	pricingService := chip.NewPricingService()
+	pricingService.PoolReservesSource = nodeService
+	pricingService.StakingAssetService = stakingAssetService
+	app.StakingPricingService = pricingService
+
 	stakingPeriodService := postgres.NewStakingPeriodService(db.DB)
+	stakingPeriodService.StakingPricingService = pricingService
+	stakingPeriodService.StakingAssetService = stakingAssetService
 	app.StakingPeriodService = stakingPeriodService
 
 	stakingCommitmentService := postgres.NewStakingCommitmentService(db.DB)
 	stakingCommitmentService.StakingPeriodService = stakingPeriodService
 	app.StakingCommitmentService = stakingCommitmentService
 
+	stakingCheckRunService := postgres.NewStakingCheckRunService(db.DB)
+	app.StakingCheckRunService = stakingCheckRunService
+
 	stakingResultService := postgres.NewStakingResultService(db.DB)
 	stakingResultService.StakingPeriodService = stakingPeriodService
 	stakingResultService.StakingCommitmentService = stakingCommitmentService
+	stakingResultService.StakingAssetService = stakingAssetService
+	stakingResultService.StakingCheckRunService = stakingCheckRunService
+	stakingResultService.RewardPolicy, err = reward.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid staking reward policy: %v\n", err)
+	}
+	stakingResultService.BoostRules, err = payapi.StakingBoostRulesFromEnv()
+	if err != nil {
+		log.Fatalf("StakingBoostRulesFromEnv() failed err: %v\n", err)
+	}
+	stakingResultService.HoldingsSource = indexerService
 	app.StakingResultService = stakingResultService
 
+	// payouts are only queued here, the worker holds the house account and sends them
+	stakingPayoutService := postgres.NewStakingPayoutService(db.DB)
+	stakingPayoutService.StakingResultService = stakingResultService
+	stakingPayoutService.IndexerService = *indexerService
+	app.StakingPayoutService = stakingPayoutService
+
 	stakingNftService := chip.NewStakingNftService(nftDenylist)
-	stakingNftService.IndexerService = *indexerService
+	stakingNftService.HoldingsSource = indexerService
+	stakingNftService.Policy = autoStakePolicy()
 	stakingNftService.StakingCommitmentService = stakingCommitmentService
+	stakingNftService.StakingAssetService = stakingAssetService
 	app.StakingNftService = stakingNftService
 
 	// init stake profit snapshot
@@ -147,6 +218,45 @@ func newApp() (*payapi.App, error) {
 	stakeProfitSnapshotService.StakingPeriodService = stakingPeriodService
 	app.StakeProfitSnapshotService = stakeProfitSnapshotService
 
+	stakingDashboardService := chip.NewStakingDashboardService()
+	stakingDashboardService.NodeService = *nodeService
+	stakingDashboardService.StakingPeriodService = stakingPeriodService
+	stakingDashboardService.StakingCommitmentService = stakingCommitmentService
+	stakingDashboardService.StakingAssetService = stakingAssetService
+	stakingDashboardService.StakingCheckRunService = stakingCheckRunService
+	stakingDashboardService.StakingResultService = stakingResultService
+	stakingDashboardService.StakingPayoutService = stakingPayoutService
+	stakingDashboardService.StakeProfitSnapshotService = stakeProfitSnapshotService
+	app.StakingDashboardService = stakingDashboardService
+
+	// admin previews of checks and results
+	stakingCheckService := chip.NewStakingCheckService()
+	stakingCheckService.HoldingsSource = indexerService
+	stakingCheckService.StakingCommitmentService = stakingCommitmentService
+	stakingCheckService.StakingAssetService = stakingAssetService
+	stakingCheckService.StakingCheckRunService = stakingCheckRunService
+	stakingCheckService.StakingResultService = stakingResultService
+	stakingCheckService.StakingPricingService = pricingService
+	app.StakingCheckService = stakingCheckService
+
+	stakingExportService := chip.NewStakingExportService()
+	stakingExportService.StakingPeriodService = stakingPeriodService
+	stakingExportService.StakingCommitmentService = stakingCommitmentService
+	stakingExportService.StakingCheckRunService = stakingCheckRunService
+	stakingExportService.StakingAssetService = stakingAssetService
+	stakingExportService.StakingResultService = stakingResultService
+	app.StakingExportService = stakingExportService
+
+	// house key signing published results, only signs, payouts stay with the worker
+	if signingMnemonic := os.Getenv("HOUSE_SIGNING_MNEMONIC"); signingMnemonic != "" {
+		accountService, err := algo.NewAccountService(signingMnemonic)
+		if err != nil {
+			return nil, fmt.Errorf("NewAccountService() failed with error: %v", err)
+		}
+
+		stakingExportService.AccountService = accountService
+	}
+
 	return app, nil
 }
 
@@ -162,6 +272,9 @@ func main() {
 	// attach validator to http server
 	s.Validator = *utils.NewValidator()
 
+	// admin routes are disabled unless a key is set
+	s.AdminApiKey = os.Getenv("ADMIN_API_KEY")
+
 	s.Start(serverPort)
 
 	log.Printf("PayAPI server listening on port %v\n", serverPort)
@@ -1,123 +1,141 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/algo-casino/payapi"
-	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algo-casino/payapi/algo"
 )
 
-func checkTxnMatchesPayment(payment *payapi.Payment, txn models.Transaction) bool {
-	if txn.AssetTransferTransaction.Amount != payment.Amount {
-		// amount didn't match what was expected
-		return false
-	} else if txn.Sender != payment.Sender {
-		// sender wasn't who we expected
-		return false
-	}
-
-	mustMatchNote := strconv.FormatInt(int64(payment.ExternalId), 10)
-
-	// note field of txn must match external_id field of payment
-	if !bytes.Equal(txn.Note, []byte(mustMatchNote)) {
-		//log.Printf("payment %v note didn't match external id %s", payment.ExternalId, txn.Id)
-		return false
-	}
-
-	blockTime := time.Unix(int64(txn.RoundTime), 0).UTC()
-
-	// must be within given time range between payment being created and 60 seconds after
-	if !blockTime.Before(payment.CreatedAt.Add(60*time.Second)) || !blockTime.After(payment.CreatedAt) {
-
-		//fmt.Printf("blockTime: %v\n", blockTime)
-		//fmt.Printf("afterTime: %v\n", afterTime)
-		//fmt.Printf("beforeTime: %v\n", beforeTime)
-		//log.Print("transaction outside time range")
-		return false
-	}
-
-	return true
-}
-
+// fallback for anything the chain follower missed (downtime, skipped rounds)
 func checkPendingDeposits(app *payapi.App) {
-	checkPendingDepositsForPlatform(app, 1) // casino
-	checkPendingDepositsForPlatform(app, 2) // poker site
-}
-
-func checkPendingDepositsForPlatform(app *payapi.App, platformId int) {
 	ctx := context.Background()
 
-	platform, err := app.PlatformService.FindPlatformByID(ctx, platformId)
+	platforms, err := app.PlatformService.FindPlatforms(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to find platform 1. err: %v\n", err)
+		fmt.Fprintf(os.Stderr, "FindPlatforms() failed err: %v\n", err)
 		return
 	}
 
-	status := payapi.StatusCreated // should be cancelled
+	for _, platform := range platforms {
+		if !platform.Active {
+			continue
+		}
+
+		checkPendingDepositsForPlatform(ctx, app, platform)
+	}
+}
 
-	beforeTime := time.Now().Add(-2 * time.Minute) // must be at least 5 mins since created (suggesting user cannot call complete endpoint)
-	afterTime := beforeTime.Add(-1 * time.Hour)    // just within the past hour, since we're polling every 5 mins should rarely be stragglers
+func checkPendingDepositsForPlatform(ctx context.Context, app *payapi.App, platform *payapi.Platform) {
+	status := payapi.StatusCreated
 
-	// get all payments for platform in the created state (waiting to be completed or cancelled)
-	// returns newest first
-	createdPayments, _ := app.PaymentService.FindPayments(context.TODO(), payapi.PaymentFilter{
+	// give users a chance to call the complete endpoint themselves first
+	beforeTime := time.Now().UTC().Add(-2 * time.Minute)
+
+	// every payment still open, expired ones have already moved out of the created state
+	createdPayments, _, err := app.PaymentService.FindPayments(ctx, payapi.PaymentFilter{
 		PlatformId: &platform.ID,
 		Status:     &status,
 		BeforeTime: &beforeTime,
-		AfterTime:  &afterTime,
 	})
+	if err != nil {
+		log.Printf("FindPayments() for platformId: %d failed err: %v\n", platform.ID, err)
+		return
+	}
 
 	if len(createdPayments) <= 0 {
 		log.Printf("FindPayments() for platformId: %d succeeded but no payments found\n", platform.ID)
 		return
 	}
 
-	assetId := uint64(388592191)
+	// search from the oldest open payment (returned newest first) up to the end of its match window
+	afterTime := createdPayments[len(createdPayments)-1].CreatedAt
+	beforeTime = time.Now().UTC()
+
+	// group by asset, one indexer search per asset
+	paymentsByAsset := make(map[uint64][]*payapi.Payment)
+
+	for _, payment := range createdPayments {
+		paymentsByAsset[payment.AssetId] = append(paymentsByAsset[payment.AssetId], payment)
+	}
 
-	// get all txns between (NOW() - X hours) and NOW() ALL UTC
-	txns, err := app.IndexerService.GetAssetTransactionsForAddress(ctx, platform.Address, assetId, afterTime, beforeTime)
+	for assetId, payments := range paymentsByAsset {
+		checkPendingDepositsForAsset(ctx, app, platform, assetId, payments, afterTime, beforeTime)
+	}
+}
+
+func checkPendingDepositsForAsset(ctx context.Context, app *payapi.App, platform *payapi.Platform, assetId uint64, payments []*payapi.Payment, afterTime, beforeTime time.Time) {
+	// get all transfers between (NOW() - X hours) and NOW() ALL UTC
+	transfers, err := app.IndexerService.GetTransfersForAddress(ctx, platform.Address, assetId, afterTime, beforeTime)
 	if err != nil {
-		log.Printf("GetAssetTransactionsForAddress() for platformId: %d failed with err: %v\n", platform.ID, err)
+		log.Printf("GetTransfersForAddress() for platformId: %d assetId: %d failed with err: %v\n", platform.ID, assetId, err)
 		return
 	}
 
-	if len(txns) <= 0 {
-		log.Printf("GetAssetTransactionsForAddress() for platformId: %d succeeded but no transactions found\n", platform.ID)
+	if len(transfers) <= 0 {
+		log.Printf("GetTransfersForAddress() for platformId: %d assetId: %d succeeded but no transactions found\n", platform.ID, assetId)
 		return
 	}
 
-	for _, payment := range createdPayments {
-		for _, txn := range txns {
-			if checkTxnMatchesPayment(payment, txn) {
-
-				// temporary, only 50,000 or less (or is poker platform)
-				if payment.Amount > (50_000 * 10) {
-					// too high for auto process atm
-					msg := fmt.Sprintf("payment %d platform: %d cannot be auto processed amount: %d possible txn: %s (ensure checked)\n", payment.ID, platformId, payment.Amount, txn.Id)
-					fmt.Print(msg)
-					app.NotifyService.Notify(ctx, msg)
-					continue
-				}
-
-				// mark as complete
-				_, err := app.PaymentService.CompletePayment(ctx, payment.ID, txn.Id)
-				if err != nil {
-					// notify via slack as well, just easier to keep logs on this
-					fmt.Printf("CompletePayment() err: %v\n", err)
-				} else {
-					msg := fmt.Sprintf("payment %d platformId: %d externalId: %d txid: %s\n", payment.ID, platformId, payment.ExternalId, txn.Id)
-					fmt.Print(msg)
-					app.NotifyService.Notify(ctx, msg)
-				}
-			} else {
-				// txn didnt match payment
+	for _, payment := range payments {
+		for _, t := range transfers {
+			// a payment is completed once, later repeat deposits are left to reconcile
+			if payment.Match(platform, t) == nil {
+				completeMatchedPayment(ctx, app, platform, payment, t)
+				break
 			}
 		}
 	}
 }
+
+// completes a payment a transfer has been matched to, or holds it for review if it's too large
+func completeMatchedPayment(ctx context.Context, app *payapi.App, platform *payapi.Platform, payment *payapi.Payment, t *algo.Transfer) {
+	asset, err := app.PlatformService.FindPlatformAsset(ctx, platform.ID, payment.AssetId)
+	if err != nil {
+		log.Printf("FindPlatformAsset() platformId: %d assetId: %d failed err: %v\n", platform.ID, payment.AssetId, err)
+		return
+	}
+
+	if asset.RequiresReview(t.Amount) {
+		_, err := app.PaymentService.HoldPaymentForReview(ctx, payment.ID, t.TxID, t.Amount)
+		if err != nil {
+			fmt.Printf("HoldPaymentForReview() err: %v\n", err)
+			return
+		}
+
+		msg := fmt.Sprintf("payment %d platformId: %d held for review amount: %d txid: %s\n", payment.ID, platform.ID, t.Amount, t.TxID)
+		fmt.Print(msg)
+		app.NotifyService.Notify(ctx, msg)
+		return
+	}
+
+	// mark as complete
+	_, err = app.PaymentService.CompletePayment(ctx, payment.ID, t.TxID, t.Amount)
+	if err != nil {
+		// notify via slack as well, just easier to keep logs on this
+		fmt.Printf("CompletePayment() err: %v\n", err)
+	} else {
+		msg := fmt.Sprintf("payment %d platformId: %d externalId: %d txid: %s\n", payment.ID, platform.ID, payment.ExternalId, t.TxID)
+		fmt.Print(msg)
+		app.NotifyService.Notify(ctx, msg)
+	}
+}
+
+// moves open payments past their expiry to expired, platforms are notified by webhook
+func expirePayments(app *payapi.App) {
+	ctx := context.Background()
+
+	expired, err := app.PaymentService.ExpirePayments(ctx)
+	if err != nil {
+		log.Printf("ExpirePayments() failed err: %v\n", err)
+		return
+	}
+
+	for _, payment := range expired {
+		log.Printf("payment %d platformId: %d externalId: %d expired\n", payment.ID, payment.PlatformId, payment.ExternalId)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/algo-casino/payapi"
+)
+
+// sends staking rewards queued with POST /stakingPeriods/{id}/distribute, and settles ones already sent
+func distributeStakingPayouts(app *payapi.App) {
+	ctx := context.Background()
+
+	// periods with anything left to do
+	periods := make(map[int]bool)
+
+	for _, status := range []int{payapi.StakingPayoutStatusPending, payapi.StakingPayoutStatusSent, payapi.StakingPayoutStatusFailed} {
+		payouts, err := app.StakingPayoutService.FindStakingPayouts(ctx, payapi.StakingPayoutFilter{Status: &status})
+		if err != nil {
+			log.Printf("FindStakingPayouts() status: %d failed with err: %v\n", status, err)
+			return
+		}
+
+		for _, p := range payouts {
+			periods[p.StakingPeriodId] = true
+		}
+	}
+
+	for stakingPeriodId := range periods {
+		dist, err := app.StakingPayoutService.DistributeStakingPayouts(ctx, stakingPeriodId)
+		if err != nil {
+			msg := fmt.Sprintf("staking period %d payouts failed to distribute err: %v\n", stakingPeriodId, err)
+			fmt.Print(msg)
+			app.NotifyService.Notify(ctx, msg)
+		}
+
+		if dist == nil {
+			continue
+		}
+
+		for _, w := range dist.Warnings {
+			msg := fmt.Sprintf("staking period %d payouts: %s\n", stakingPeriodId, w)
+			fmt.Print(msg)
+			app.NotifyService.Notify(ctx, msg)
+		}
+
+		if dist.Sent+dist.Confirmed+dist.Failed == 0 {
+			continue
+		}
+
+		msg := fmt.Sprintf("staking period %d payouts: %d sent in %d groups, %d confirmed, %d failed, %d remaining\n", stakingPeriodId, dist.Sent, dist.Groups, dist.Confirmed, dist.Failed, dist.Remaining)
+		fmt.Print(msg)
+		app.NotifyService.Notify(ctx, msg)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+)
+
+const (
+	// non archival nodes only keep ~1000 rounds, any further behind and we skip ahead (fallback poll picks up the gap)
+	followerMaxLag = 1000
+
+	// how long to back off after algod or postgres errors
+	followerRetryDelay = 5 * time.Second
+)
+
+// sleeps for d, returns false if ctx was cancelled first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// round to resume from, the one after the last processed or the current round on first run
+func followerStartRound(ctx context.Context, app *payapi.App) (uint64, error) {
+	cursor, err := app.ChainCursorService.FindChainCursor(ctx, payapi.ChainCursorDeposits)
+	if err == nil {
+		return cursor.Round + 1, nil
+	}
+
+	return app.NodeService.LatestRound(ctx)
+}
+
+// walks algod round by round matching transfers to open payments as they confirm
+// runs until ctx is cancelled
+func followChain(ctx context.Context, app *payapi.App) {
+	var round uint64
+
+	for {
+		r, err := followerStartRound(ctx, app)
+		if err == nil {
+			round = r
+			break
+		}
+
+		log.Printf("followerStartRound() failed err: %v\n", err)
+
+		if !sleepContext(ctx, followerRetryDelay) {
+			return
+		}
+	}
+
+	log.Printf("chain follower starting at round %d\n", round)
+
+	for ctx.Err() == nil {
+		latest, err := app.NodeService.WaitForRound(ctx, round)
+		if err != nil {
+			log.Printf("WaitForRound() round: %d failed err: %v\n", round, err)
+			sleepContext(ctx, followerRetryDelay)
+			continue
+		} else if latest < round {
+			// algod timed out waiting, go again
+			continue
+		}
+
+		if latest-round > followerMaxLag {
+			msg := fmt.Sprintf("chain follower is %d rounds behind, skipping from round %d to %d\n", latest-round, round, latest)
+			fmt.Print(msg)
+			app.NotifyService.Notify(ctx, msg)
+
+			round = latest
+		}
+
+		err = processDepositRound(ctx, app, round)
+		if err != nil {
+			log.Printf("processDepositRound() round: %d failed err: %v\n", round, err)
+			sleepContext(ctx, followerRetryDelay)
+			continue
+		}
+
+		err = app.ChainCursorService.UpdateChainCursor(ctx, payapi.ChainCursorDeposits, round)
+		if err != nil {
+			// round is done, worst case it is processed again after a restart
+			log.Printf("UpdateChainCursor() round: %d failed err: %v\n", round, err)
+		}
+
+		round++
+	}
+}
+
+// matches every transfer in round sent to an active platform
+func processDepositRound(ctx context.Context, app *payapi.App, round uint64) error {
+	transfers, err := app.NodeService.GetBlockTransfers(ctx, round)
+	if err != nil {
+		return err
+	} else if len(transfers) == 0 {
+		return nil
+	}
+
+	platforms, err := app.PlatformService.FindPlatforms(ctx)
+	if err != nil {
+		return err
+	}
+
+	platformsByAddress := make(map[string]*payapi.Platform)
+
+	for _, platform := range platforms {
+		if platform.Active {
+			platformsByAddress[platform.Address] = platform
+		}
+	}
+
+	for _, t := range transfers {
+		platform, ok := platformsByAddress[t.Receiver]
+		if !ok {
+			continue
+		}
+
+		matchTransfer(ctx, app, platform, t)
+	}
+
+	return nil
+}
+
+// finds the open payment a transfer pays for, if any, and completes it
+func matchTransfer(ctx context.Context, app *payapi.App, platform *payapi.Platform, t *algo.Transfer) {
+	status := payapi.StatusCreated
+
+	// payment must have been created shortly before the transfer confirmed
+	afterTime := t.RoundTime.Add(-time.Duration(platform.MatchWindow) * time.Second)
+	beforeTime := t.RoundTime
+
+	payments, _, err := app.PaymentService.FindPayments(ctx, payapi.PaymentFilter{
+		PlatformId: &platform.ID,
+		Status:     &status,
+		AfterTime:  &afterTime,
+		BeforeTime: &beforeTime,
+	})
+	if err != nil {
+		log.Printf("FindPayments() for platformId: %d txid: %s failed err: %v\n", platform.ID, t.TxID, err)
+		return
+	}
+
+	for _, payment := range payments {
+		if payment.Match(platform, t) == nil {
+			completeMatchedPayment(ctx, app, platform, payment, t)
+			return
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -11,7 +12,9 @@ import (
 
 	"github.com/algo-casino/payapi"
 	"github.com/algo-casino/payapi/algo"
+	"github.com/algo-casino/payapi/chip"
 	"github.com/algo-casino/payapi/postgres"
+	"github.com/algo-casino/payapi/reward"
 	"github.com/algo-casino/payapi/slack"
 	"github.com/algo-casino/payapi/stake"
 	"github.com/algo-casino/payapi/utils"
@@ -113,13 +116,43 @@ func newApp() (*payapi.App, error) {
 	platformService := postgres.NewPlatformService(db.DB)
 	app.PlatformService = platformService
 
+	app.WebhookService = postgres.NewWebhookService(db.DB)
+
+	app.IdempotencyService = postgres.NewIdempotencyService(db.DB)
+
 	paymentService := postgres.NewPaymentService(db.DB)
 	app.PaymentService = paymentService
 
+	app.ChainCursorService = postgres.NewChainCursorService(db.DB)
+
+	orphanDepositService := postgres.NewOrphanDepositService(db.DB)
+	app.OrphanDepositService = orphanDepositService
+
 	// setup dependencies for payment service
 	paymentService.PlatformService = platformService
 	paymentService.IndexerService = *indexerService
 
+	withdrawalService := postgres.NewWithdrawalService(db.DB)
+	withdrawalService.PlatformService = platformService
+	withdrawalService.IndexerService = *indexerService
+	app.WithdrawalService = withdrawalService
+
+	stakingPayoutService := postgres.NewStakingPayoutService(db.DB)
+	stakingPayoutService.IndexerService = *indexerService
+	app.StakingPayoutService = stakingPayoutService
+
+	// house account paying out withdrawals and staking rewards, both stay queued until configured
+	if payoutMnemonic := os.Getenv("PAYOUT_MNEMONIC"); payoutMnemonic != "" {
+		accountService, err := algo.NewAccountService(payoutMnemonic)
+		if err != nil {
+			return nil, fmt.Errorf("NewAccountService() failed with error: %v", err)
+		}
+
+		accountService.NodeService = nodeService
+		withdrawalService.AccountService = accountService
+		stakingPayoutService.AccountService = accountService
+	}
+
 	// attach stake service
 	// TODO: attach actual ssh tunnel stake db instance
 	stakeDatabase, err := connectToStake()
@@ -132,12 +165,51 @@ func newApp() (*payapi.App, error) {
 	app.StakeService = *stakeService
 
 	// staking services
+	stakingAssetService := postgres.NewStakingAssetService(db.DB)
+	app.StakingAssetService = stakingAssetService
+
+	// pooled assets are priced at every check run
+	pricingService := chip.NewPricingService()
+	pricingService.PoolReservesSource = nodeService
+	pricingService.StakingAssetService = stakingAssetService
+	app.StakingPricingService = pricingService
+
 	stakingPeriodService := postgres.NewStakingPeriodService(db.DB)
 	app.StakingPeriodService = stakingPeriodService
 
 	stakingCommitmentService := postgres.NewStakingCommitmentService(db.DB)
 	app.StakingCommitmentService = stakingCommitmentService
 
+	// what commitments held at each check
+	stakingCheckRunService := postgres.NewStakingCheckRunService(db.DB)
+	app.StakingCheckRunService = stakingCheckRunService
+
+	// only used for previews here, results are created through the api
+	stakingResultService := postgres.NewStakingResultService(db.DB)
+	stakingResultService.StakingPeriodService = stakingPeriodService
+	stakingResultService.StakingCommitmentService = stakingCommitmentService
+	stakingResultService.StakingAssetService = stakingAssetService
+	stakingResultService.StakingCheckRunService = stakingCheckRunService
+	stakingResultService.RewardPolicy, err = reward.PolicyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid staking reward policy: %v\n", err)
+	}
+	stakingResultService.BoostRules, err = payapi.StakingBoostRulesFromEnv()
+	if err != nil {
+		log.Fatalf("StakingBoostRulesFromEnv() failed err: %v\n", err)
+	}
+	stakingResultService.HoldingsSource = indexerService
+	app.StakingResultService = stakingResultService
+
+	stakingCheckService := chip.NewStakingCheckService()
+	stakingCheckService.HoldingsSource = indexerService
+	stakingCheckService.StakingCommitmentService = stakingCommitmentService
+	stakingCheckService.StakingAssetService = stakingAssetService
+	stakingCheckService.StakingCheckRunService = stakingCheckRunService
+	stakingCheckService.StakingResultService = stakingResultService
+	stakingCheckService.StakingPricingService = pricingService
+	app.StakingCheckService = stakingCheckService
+
 	faucetSnapshotService := postgres.NewFaucetSnapshotService(db.DB, faucetDenylist)
 	faucetSnapshotService.IndexerService = *indexerService
 	app.FaucetSnapshotService = faucetSnapshotService
@@ -152,18 +224,68 @@ func newApp() (*payapi.App, error) {
 }
 
 func main() {
+	flag.Parse()
+
 	app, err := newApp()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "newApp() failed err: %s\n", err)
 		os.Exit(1)
 	}
 
+	// one off checks and previews skip the scheduler
+	if *checkPeriod != 0 || *previewResult != 0 {
+		os.Exit(runOnce(context.Background(), app))
+	}
+
+	// deposits are matched as soon as their round is available
+	followerCtx, stopFollower := context.WithCancel(context.Background())
+	go followChain(followerCtx, app)
+
 	scheduler := gocron.NewScheduler(time.UTC)
 
-	scheduler.Every(2).Minutes().Do(func() {
+	// slower indexer poll in case the follower missed anything
+	scheduler.Every(10).Minutes().Do(func() {
 		checkPendingDeposits(app)
 	})
 
+	scheduler.Every(1).Minute().Do(func() {
+		expirePayments(app)
+	})
+
+	// transfers nothing was matched to
+	scheduler.Every(1).Hour().Do(func() {
+		reconcileDeposits(app)
+	})
+
+	scheduler.Every(1).Minute().Do(func() {
+		processWithdrawals(app)
+	})
+
+	// staking rewards queued by an admin
+	scheduler.Every(5).Minutes().Do(func() {
+		distributeStakingPayouts(app)
+	})
+
+	// platform webhook outbox, failed calls are retried with backoff
+	scheduler.Every(15).Seconds().Do(func() {
+		n, err := app.WebhookService.DeliverPendingWebhooks(context.Background(), 50)
+		if err != nil {
+			log.Printf("DeliverPendingWebhooks() failed err: %v\n", err)
+		} else if n > 0 {
+			log.Printf("DeliverPendingWebhooks() attempted %d deliveries\n", n)
+		}
+	})
+
+	// stored responses only need to outlive client retries
+	scheduler.Every(1).Hour().Do(func() {
+		n, err := app.IdempotencyService.DeleteIdempotencyKeys(context.Background(), time.Now().UTC().Add(-24*time.Hour))
+		if err != nil {
+			log.Printf("DeleteIdempotencyKeys() failed err: %v\n", err)
+		} else if n > 0 {
+			log.Printf("DeleteIdempotencyKeys() deleted %d keys\n", n)
+		}
+	})
+
 	ctx := context.Background()
 
 	// every 6 hours do house staking check and check casino profit
@@ -189,12 +311,13 @@ func main() {
 			snap, err := app.StakeProfitSnapshotService.CreateStakeProfitSnapshot(ctx, sp)
 			if err != nil {
 				log.Printf("CreateStakeProfitSnapshot() stakingPeriod: %d failed err: %v\n", sp.ID, err)
+				continue
 			}
 
 			fmt.Printf("StakeProfitSnapshot created: stakingPeriod: %d time: %v snap.Profit: %v\n", snap.StakingPeriodID, snap.CreatedAt, snap.Profit)
 
 			//we're within the commitment period, check eligibility
-			CheckCommitments(ctx, app, sp.ID)
+			CheckCommitments(ctx, app, sp.ID, false)
 		}
 	})
 
@@ -246,5 +369,6 @@ func main() {
 	// Waiting for SIGINT (kill -2)
 	<-stop
 
+	stopFollower()
 	scheduler.Stop()
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/algo-casino/payapi"
+)
+
+func processWithdrawals(app *payapi.App) {
+	ctx := context.Background()
+
+	sendApprovedWithdrawals(ctx, app)
+	confirmSentWithdrawals(ctx, app)
+}
+
+func sendApprovedWithdrawals(ctx context.Context, app *payapi.App) {
+	status := payapi.WithdrawalStatusApproved
+
+	withdrawals, err := app.WithdrawalService.FindWithdrawals(ctx, payapi.WithdrawalFilter{Status: &status})
+	if err != nil {
+		log.Printf("FindWithdrawals() status: %d failed with err: %v\n", status, err)
+		return
+	}
+
+	for _, w := range withdrawals {
+		sent, err := app.WithdrawalService.SendWithdrawal(ctx, w.ID)
+		if err != nil {
+			msg := fmt.Sprintf("withdrawal %d platformId: %d failed to send err: %v\n", w.ID, w.PlatformId, err)
+			fmt.Print(msg)
+			app.NotifyService.Notify(ctx, msg)
+			continue
+		}
+
+		msg := fmt.Sprintf("withdrawal %d platformId: %d externalId: %d sent txid: %s\n", sent.ID, sent.PlatformId, sent.ExternalId, *sent.TransactionID)
+		fmt.Print(msg)
+		app.NotifyService.Notify(ctx, msg)
+	}
+}
+
+// signed withdrawals may have reached the network even if broadcasting failed, so both are checked
+func confirmSentWithdrawals(ctx context.Context, app *payapi.App) {
+	for _, status := range []int{payapi.WithdrawalStatusSigned, payapi.WithdrawalStatusBroadcast} {
+		status := status
+
+		withdrawals, err := app.WithdrawalService.FindWithdrawals(ctx, payapi.WithdrawalFilter{Status: &status})
+		if err != nil {
+			log.Printf("FindWithdrawals() status: %d failed with err: %v\n", status, err)
+			continue
+		}
+
+		for _, w := range withdrawals {
+			_, err := app.WithdrawalService.ConfirmWithdrawal(ctx, w.ID)
+			if errors.Is(err, payapi.ErrWithdrawalExpired) {
+				msg := fmt.Sprintf("withdrawal %d platformId: %d txid: %s %v, marked failed\n", w.ID, w.PlatformId, *w.TransactionID, err)
+				fmt.Print(msg)
+				app.NotifyService.Notify(ctx, msg)
+				continue
+			} else if err != nil {
+				// not on chain yet, checked again next run
+				continue
+			}
+
+			log.Printf("withdrawal %d platformId: %d confirmed\n", w.ID, w.PlatformId)
+		}
+	}
+}
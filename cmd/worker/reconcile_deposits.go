@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/algo-casino/payapi"
+)
+
+const (
+	// how far back each run looks, runs overlap and already recorded transfers are skipped
+	reconcileLookback = 24 * time.Hour
+
+	// extra time after the match window for the follower and fallback poll to have matched a transfer
+	reconcileGrace = 15 * time.Minute
+)
+
+// records inbound transfers to platform addresses that no payment was completed with
+func reconcileDeposits(app *payapi.App) {
+	ctx := context.Background()
+
+	platforms, err := app.PlatformService.FindPlatforms(ctx)
+	if err != nil {
+		log.Printf("FindPlatforms() failed err: %v\n", err)
+		return
+	}
+
+	for _, platform := range platforms {
+		n, err := reconcileDepositsForPlatform(ctx, app, platform)
+		if err != nil {
+			log.Printf("reconcileDepositsForPlatform() platformId: %d failed err: %v\n", platform.ID, err)
+		}
+
+		if n > 0 {
+			msg := fmt.Sprintf("platform %d has %d new orphan deposits, check /admin/orphanDeposits\n", platform.ID, n)
+			fmt.Print(msg)
+			app.NotifyService.Notify(ctx, msg)
+		}
+	}
+}
+
+// returns how many new orphans were recorded
+// every inbound transfer is scanned, transfers in assets the platform doesn't accept are recorded with a reason
+func reconcileDepositsForPlatform(ctx context.Context, app *payapi.App, platform *payapi.Platform) (int, error) {
+	assets, err := app.PlatformService.FindPlatformAssets(ctx, platform.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	accepted := make(map[uint64]bool, len(assets))
+	for _, asset := range assets {
+		accepted[asset.AssetId] = true
+	}
+
+	// anything newer may still be matched to a payment
+	beforeTime := time.Now().UTC().Add(-time.Duration(platform.MatchWindow)*time.Second - reconcileGrace)
+	afterTime := beforeTime.Add(-reconcileLookback)
+
+	transfers, err := app.IndexerService.GetAllTransfersForAddress(ctx, platform.Address, afterTime, beforeTime)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	for _, t := range transfers {
+		if t.Sender == platform.Address || t.Amount == 0 {
+			// house moving its own funds, or an opt in
+			continue
+		}
+
+		deposit := &payapi.OrphanDeposit{
+			PlatformId:    platform.ID,
+			TransactionID: t.TxID,
+			Round:         t.Round,
+			RoundTime:     t.RoundTime,
+			Sender:        t.Sender,
+			AssetId:       t.AssetId,
+			Amount:        t.Amount,
+			Note:          t.Note,
+		}
+
+		if !accepted[t.AssetId] {
+			reason := fmt.Sprintf("asset %d is not accepted by the platform", t.AssetId)
+			deposit.Reason = &reason
+		}
+
+		recorded, err := app.OrphanDepositService.RecordOrphanDeposit(ctx, deposit)
+		if err != nil {
+			return n, err
+		} else if recorded {
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/algo-casino/payapi"
+)
+
+var (
+	checkPeriod = flag.Int("check-period", 0, "run the commitment check of this staking period once and exit")
+	dryRun      = flag.Bool("dry-run", false, "with -check-period, report eligibility changes without saving anything")
+
+	previewResult = flag.Int("preview-result", 0, "print the result of this staking period as it would be created now and exit, nothing is saved")
+	profit        = flag.Uint64("profit", 0, "with -preview-result, profit to distribute in base units")
+	weighting     = flag.String("weighting", payapi.StakingWeightingCommitment, "with -preview-result, how committed amounts are credited: commitment, average or minimum")
+)
+
+// runs what the flags ask for, printing the report as json, returns the exit code
+func runOnce(ctx context.Context, app *payapi.App) int {
+	var v any
+
+	if *checkPeriod != 0 {
+		report := CheckCommitments(ctx, app, *checkPeriod, *dryRun)
+		if report == nil {
+			return 1
+		}
+		v = report
+	} else {
+		if *profit == 0 {
+			fmt.Fprintln(os.Stderr, "-preview-result needs -profit")
+			return 2
+		}
+
+		preview, err := app.StakingCheckService.PreviewStakingResult(ctx, *previewResult, *profit, *weighting)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "PreviewStakingResult() staking period %d failed err: %v\n", *previewResult, err)
+			return 1
+		}
+		v = preview
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode report err: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
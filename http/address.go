@@ -0,0 +1,43 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/algorand/go-algorand-sdk/types"
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) registerAddressRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	// unauthenticated routes, everything here is public on chain or in the staking period views anyway
+	r.Group(func(r chi.Router) {
+		r.Route("/{address}", func(r chi.Router) {
+			// house staking across every period the address committed to
+			r.Get("/staking", s.handleAddressStaking)
+		})
+	})
+
+	return r
+}
+
+func (s *Server) handleAddressStaking(w http.ResponseWriter, r *http.Request) {
+	address := chi.URLParam(r, "address")
+
+	if _, err := types.DecodeAddress(address); err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadAddress)
+		return
+	}
+
+	dashboard, err := s.app.StakingDashboardService.GetStakingDashboard(r.Context(), address)
+	if err != nil {
+		log.Printf("GetStakingDashboard() %s failed err: %v\n", address, err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dashboard)
+}
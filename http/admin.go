@@ -0,0 +1,210 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/algo-casino/payapi"
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	paymentReviewRequest struct {
+		Note string `json:"note" validate:"required"` // why it was approved or rejected
+	}
+
+	orphanDepositLinkRequest struct {
+		PaymentId int    `json:"paymentId" validate:"required,numeric"`
+		Note      string `json:"note" validate:"required"`
+	}
+
+	orphanDepositDismissRequest struct {
+		Note string `json:"note" validate:"required"`
+	}
+)
+
+// operator tooling that isn't tied to a single platform
+func (s *Server) registerAdminRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	// admin routes
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireAdmin)
+
+		// deposits held for manual review
+		r.Get("/reviews", s.handleAdminReviewIndex)
+		r.Post("/reviews/{id}/approve", s.handleAdminReviewApprove)
+		r.Post("/reviews/{id}/reject", s.handleAdminReviewReject)
+
+		// inbound transfers no payment was completed with
+		r.Get("/orphanDeposits", s.handleAdminOrphanDepositIndex)
+		r.Post("/orphanDeposits/{id}/link", s.handleAdminOrphanDepositLink)
+		r.Post("/orphanDeposits/{id}/dismiss", s.handleAdminOrphanDepositDismiss)
+	})
+
+	return r
+}
+
+func (s *Server) handleAdminReviewIndex(w http.ResponseWriter, r *http.Request) {
+	status := payapi.StatusPendingReview
+
+	filter := payapi.PaymentFilter{
+		Status: &status,
+	}
+
+	if v := r.URL.Query().Get("platformId"); v != "" {
+		platformId, err := strconv.Atoi(v)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		filter.PlatformId = &platformId
+	}
+
+	payments, _, err := s.app.PaymentService.FindPayments(r.Context(), filter)
+	if err != nil {
+		log.Printf("FindPayments() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+func (s *Server) handleAdminReviewApprove(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*paymentReviewRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payment, err := s.app.PaymentService.ApprovePayment(r.Context(), int(id), params.Note)
+	if err != nil {
+		log.Printf("ApprovePayment() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (s *Server) handleAdminReviewReject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*paymentReviewRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payment, err := s.app.PaymentService.RejectPayment(r.Context(), int(id), params.Note)
+	if err != nil {
+		log.Printf("RejectPayment() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (s *Server) handleAdminOrphanDepositIndex(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	// open orphans unless asked otherwise
+	status := payapi.OrphanDepositStatusOpen
+
+	filter := payapi.OrphanDepositFilter{
+		Status: &status,
+	}
+
+	if v := q.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		filter.Status = &status
+	}
+
+	if v := q.Get("platformId"); v != "" {
+		platformId, err := strconv.Atoi(v)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		filter.PlatformId = &platformId
+	}
+
+	deposits, err := s.app.OrphanDepositService.FindOrphanDeposits(r.Context(), filter)
+	if err != nil {
+		log.Printf("FindOrphanDeposits() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deposits)
+}
+
+func (s *Server) handleAdminOrphanDepositLink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*orphanDepositLinkRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	deposit, err := s.app.OrphanDepositService.LinkOrphanDeposit(r.Context(), int(id), params.PaymentId, params.Note)
+	if err != nil {
+		log.Printf("LinkOrphanDeposit() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deposit)
+}
+
+func (s *Server) handleAdminOrphanDepositDismiss(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*orphanDepositDismissRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	deposit, err := s.app.OrphanDepositService.DismissOrphanDeposit(r.Context(), int(id), params.Note)
+	if err != nil {
+		log.Printf("DismissOrphanDeposit() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deposit)
+}
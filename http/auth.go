@@ -2,12 +2,17 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
+	"crypto/subtle"
 	"encoding/base32"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 
+	"github.com/algo-casino/payapi"
 	"github.com/algorand/go-algorand-sdk/encoding/msgpack"
 	"github.com/algorand/go-algorand-sdk/types"
 )
@@ -45,6 +50,32 @@ func rawVerifyTransaction(pubkey ed25519.PublicKey, transaction types.Transactio
 	return ed25519.Verify(pubkey, toVerify, sig)
 }
 
+// checks a staking result export was signed by its signer, as SignStakingResultExport signs it
+func VerifyStakingResultExport(signed *payapi.SignedStakingResultExport) error {
+	if signed == nil || len(signed.Document) == 0 {
+		return errors.New("empty export")
+	}
+
+	pubkey, err := getPubKey(signed.Signer)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("cannot decode signature")
+	}
+
+	// same prefix Algorand wallets sign data with
+	toVerify := bytes.Join([][]byte{[]byte("MX"), signed.Document}, nil)
+
+	if !ed25519.Verify(pubkey, toVerify, sig) {
+		return errors.New("signature does not match export")
+	}
+
+	return nil
+}
+
 func decodeTransaction(auth AuthRequest) (*types.SignedTxn, error) {
 	// decoded the transaction, as the payload comes base64 encoded from the Typescript client
 	decodedTransaction, err := base64.StdEncoding.DecodeString(auth.Payload)
@@ -96,3 +127,58 @@ func CheckAuth(authRequest *AuthRequest) (error, bool) {
 
 	return nil, true
 }
+
+// returns the bearer token from the Authorization header, empty if none
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// middleware, only allows requests carrying the admin api key through
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+
+		if s.AdminApiKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.AdminApiKey)) != 1 {
+			s.respondWithError(w, r, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contextKey int
+
+const platformContextKey contextKey = iota
+
+// platform the request was authenticated as, nil outside of requirePlatform routes
+func platformFromContext(ctx context.Context) *payapi.Platform {
+	platform, _ := ctx.Value(platformContextKey).(*payapi.Platform)
+	return platform
+}
+
+// middleware, requires a platform api key and attaches the platform to the request context
+func (s *Server) requirePlatform(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			s.respondWithError(w, r, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		platform, err := s.app.PlatformService.FindPlatformByApiKey(r.Context(), token)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), platformContextKey, platform)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
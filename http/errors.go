@@ -11,13 +11,28 @@ const (
 	// 	message: "bad parameters, check your request",
 	// }
 
-	ErrBadParameters     = "bad parameters, check your request"
-	ErrCreatePayment     = "failed to create payment"
-	ErrCompletePayment   = "failed to complete payment"
-	ErrGeneric           = "Something went wrong!"
-	ErrRecentTransaction = "You have already claimed your CHIPS, Check back tomorrow for more."
-	ErrLowBalance        = "The faucet has run dry. Check back later!"
-	ErrSendAssetFailed   = "Unable to send CHIPS. Please make sure you have added the CHIPS ASA ID: 388592191 to your wallet."
+	ErrBadParameters      = "bad parameters, check your request"
+	ErrCreatePayment      = "failed to create payment"
+	ErrCompletePayment    = "failed to complete payment"
+	ErrCreateWithdrawal   = "failed to create withdrawal"
+	ErrWithdrawalNotFound = "withdrawal not found"
+	ErrUnauthorized       = "unauthorized"
+	ErrForbidden          = "you do not have access to this resource"
+	ErrCreatePlatform     = "failed to create platform"
+	ErrPlatformNotFound   = "platform not found"
+	ErrPaymentNotFound    = "payment not found"
+	ErrAssetNotAccepted   = "asset is not accepted by this platform"
+	ErrPaymentExists      = "a payment with this externalId already exists"
+	ErrPaymentCompleted   = "payment already completed"
+	ErrPaymentNotOpen     = "payment is no longer open"
+	ErrGeneric            = "Something went wrong!"
+	ErrRecentTransaction  = "You have already claimed your CHIPS, Check back tomorrow for more."
+	ErrLowBalance         = "The faucet has run dry. Check back later!"
+	ErrSendAssetFailed    = "Unable to send CHIPS. Please make sure you have added the CHIPS ASA ID: 388592191 to your wallet."
+
+	// Idempotency-Key header
+	ErrIdempotencyKeyMismatch   = "idempotency key was already used for a different request"
+	ErrIdempotencyKeyInProgress = "a request with this idempotency key is still in progress"
 
 	// reCAPTCHA specific
 	ErrRecaptcha    = "Something went wrong with the reCAPTCHA."
@@ -34,4 +49,8 @@ const (
 
 	ErrNoEditDuringCommitment = "You cannot edit after commitment has begin"
 	ErrAlreadyRegistered      = "you have already registered"
+	ErrStakingPeriodNotFound  = "staking period not found"
+
+	ErrStakingCommitmentNotFound = "staking commitment not found"
+	ErrStakingResultNotFound     = "staking result not found"
 )
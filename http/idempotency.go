@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/algo-casino/payapi"
+)
+
+// longest Idempotency-Key accepted, clients usually send a uuid
+const maxIdempotencyKeyLength = 255
+
+// captures what a handler writes so it can be stored against the key
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// keys are per platform, public routes share one scope
+func idempotencyScope(r *http.Request) string {
+	if platform := platformFromContext(r.Context()); platform != nil {
+		return "platform:" + strconv.Itoa(platform.ID)
+	}
+
+	return "public"
+}
+
+// middleware, replays the stored response when a request is retried with the same Idempotency-Key
+// requests without the header are passed straight through
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// same key must mean the same request
+		h := sha256.New()
+		h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		h.Write(body)
+		hash := hex.EncodeToString(h.Sum(nil))
+
+		scope := idempotencyScope(r)
+
+		stored, err := s.app.IdempotencyService.BeginIdempotentRequest(r.Context(), scope, key, hash)
+		if errors.Is(err, payapi.ErrIdempotencyKeyMismatch) {
+			s.respondWithError(w, r, http.StatusUnprocessableEntity, ErrIdempotencyKeyMismatch)
+			return
+		} else if errors.Is(err, payapi.ErrIdempotencyKeyInProgress) {
+			s.respondWithError(w, r, http.StatusConflict, ErrIdempotencyKeyInProgress)
+			return
+		} else if err != nil {
+			log.Printf("BeginIdempotentRequest() failed err: %v\n", err)
+			s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+			return
+		}
+
+		if stored != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.StatusCode)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.statusCode == 0 {
+			rec.statusCode = http.StatusOK
+		}
+
+		// server errors may succeed on retry, so don't pin them to the key
+		if rec.statusCode >= http.StatusInternalServerError {
+			err = s.app.IdempotencyService.ReleaseIdempotentRequest(r.Context(), scope, key)
+			if err != nil {
+				log.Printf("ReleaseIdempotentRequest() failed err: %v\n", err)
+			}
+			return
+		}
+
+		err = s.app.IdempotencyService.CompleteIdempotentRequest(r.Context(), scope, key, payapi.IdempotentResponse{
+			StatusCode: rec.statusCode,
+			Body:       rec.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("CompleteIdempotentRequest() failed err: %v\n", err)
+		}
+	})
+}
@@ -2,10 +2,12 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/algo-casino/payapi"
 	"github.com/go-chi/chi/v5"
@@ -15,12 +17,19 @@ type (
 	paymentCreateRequest struct {
 		PlatformId int    `json:"platformId" validate:"required,numeric"` // who does this belong to
 		Sender     string `json:"sender" validate:"required,len=58"`
-		AssetId    uint64 `json:"assetId" validate:"required,numeric"`
+		AssetId    uint64 `json:"assetId" validate:"numeric"` // zero for ALGO
 		Amount     uint64 `json:"amount" validate:"required,numeric"`
 
 		ExternalId int `json:"externalId" validate:"required,numeric"` // ID of the payment for the webhook callback
 	}
 
+	paymentIndexResponse struct {
+		Payments []*payapi.Payment `json:"payments"`
+		Total    int               `json:"total"` // matching the filter, across all pages
+		Offset   int               `json:"offset"`
+		Limit    int               `json:"limit"`
+	}
+
 	paymentCompleteRequest struct {
 		Round         *uint64 `json:"round" validate:"omitempty,numeric"` // the round this transaction was completed/available on chain
 		TransactionID string  `json:"txid" validate:"required,len=52"`
@@ -32,18 +41,171 @@ func (s *Server) registerPaymentRoutes() chi.Router {
 
 	// unauthenticated routes
 	r.Group(func(r chi.Router) {
-		// raw index route (returns view)
-		r.Post("/", s.handlePaymentCreate)
+		// txn is verified on chain, anyone holding it may complete
+		r.With(s.idempotent).Post("/{id}/complete", s.handlePaymentComplete)
+	})
 
-		r.Route("/{id}", func(r chi.Router) {
-			r.Post("/complete", s.handlePaymentComplete)
-		})
+	// platform routes (requires platform api key)
+	r.Group(func(r chi.Router) {
+		r.Use(s.requirePlatform)
 
+		r.Get("/", s.handlePaymentIndex)
+		r.With(s.idempotent).Post("/", s.handlePaymentCreate)
+
+		r.Get("/{id}", s.handlePaymentGet)
+		r.With(s.idempotent).Post("/{id}/cancel", s.handlePaymentCancel)
+
+		// webhook delivery log
+		r.Get("/{id}/webhooks", s.handlePaymentWebhooks)
 	})
 
 	return r
 }
 
+// page size when none is given, and the most that can be asked for
+const (
+	defaultPaymentLimit = 50
+	maxPaymentLimit     = 500
+)
+
+// builds a filter from the query string, platformId always comes from the api key
+func parsePaymentFilter(r *http.Request) (payapi.PaymentFilter, error) {
+	q := r.URL.Query()
+
+	platformId := platformFromContext(r.Context()).ID
+
+	filter := payapi.PaymentFilter{
+		PlatformId: &platformId,
+		Limit:      defaultPaymentLimit,
+	}
+
+	if v := q.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.Status = &status
+	}
+
+	if v := q.Get("sender"); v != "" {
+		filter.Sender = &v
+	}
+
+	if v := q.Get("externalId"); v != "" {
+		externalId, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.ExternalId = &externalId
+	}
+
+	if v := q.Get("afterTime"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, err
+		}
+		t = t.UTC()
+		filter.AfterTime = &t
+	}
+
+	if v := q.Get("beforeTime"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, err
+		}
+		t = t.UTC()
+		filter.BeforeTime = &t
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset %q", v)
+		}
+		filter.Offset = offset
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxPaymentLimit {
+			return filter, fmt.Errorf("invalid limit %q", v)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func (s *Server) handlePaymentIndex(w http.ResponseWriter, r *http.Request) {
+	filter, err := parsePaymentFilter(r)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payments, n, err := s.app.PaymentService.FindPayments(r.Context(), filter)
+	if err != nil {
+		log.Printf("FindPayments() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&paymentIndexResponse{
+		Payments: payments,
+		Total:    n,
+		Offset:   filter.Offset,
+		Limit:    filter.Limit,
+	})
+}
+
+func (s *Server) handlePaymentGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payment, err := s.app.PaymentService.FindPaymentByID(r.Context(), int(id))
+	if err != nil || payment.PlatformId != platformFromContext(r.Context()).ID {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPaymentNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (s *Server) handlePaymentCancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payment, err := s.app.PaymentService.FindPaymentByID(r.Context(), int(id))
+	if err != nil || payment.PlatformId != platformFromContext(r.Context()).ID {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPaymentNotFound)
+		return
+	}
+
+	payment, err = s.app.PaymentService.CancelPayment(r.Context(), payment.ID)
+	if errors.Is(err, payapi.ErrPaymentAlreadyCompleted) {
+		s.respondWithError(w, r, http.StatusConflict, ErrPaymentCompleted)
+		return
+	} else if errors.Is(err, payapi.ErrPaymentNotOpen) {
+		s.respondWithError(w, r, http.StatusConflict, ErrPaymentNotOpen)
+		return
+	} else if err != nil {
+		log.Printf("CancelPayment() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
 func (s *Server) handlePaymentCreate(w http.ResponseWriter, r *http.Request) {
 	params, err := decodeAndValidateRequest[*paymentCreateRequest](r.Body, &s.Validator)
 	if err != nil {
@@ -51,6 +213,12 @@ func (s *Server) handlePaymentCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// platforms can only create payments for themselves
+	if platformFromContext(r.Context()).ID != params.PlatformId {
+		s.respondWithError(w, r, http.StatusForbidden, ErrForbidden)
+		return
+	}
+
 	payment := payapi.Payment{
 		PlatformId: int(params.PlatformId),
 
@@ -62,8 +230,24 @@ func (s *Server) handlePaymentCreate(w http.ResponseWriter, r *http.Request) {
 		ExternalId: params.ExternalId,
 	}
 
-	err = s.app.PaymentService.CreatePayment(r.Context(), &payment)
+	// tell the platform why, rather than a generic failure
+	asset, err := s.app.PlatformService.FindPlatformAsset(r.Context(), payment.PlatformId, payment.AssetId)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrAssetNotAccepted)
+		return
+	}
+
+	err = asset.CheckAmount(payment.Amount)
 	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.app.PaymentService.CreatePayment(r.Context(), &payment)
+	if errors.Is(err, payapi.ErrPaymentExists) {
+		s.respondWithError(w, r, http.StatusConflict, ErrPaymentExists)
+		return
+	} else if err != nil {
 		fmt.Printf("err: %v\n", err)
 		s.respondWithError(w, r, http.StatusInternalServerError, ErrCreatePayment)
 		return
@@ -87,7 +271,17 @@ func (s *Server) handlePaymentComplete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	p, err := s.app.PaymentService.CheckAndCompletePayment(r.Context(), int(id), params.TransactionID, params.Round)
-	if err != nil {
+	if errors.Is(err, payapi.ErrPaymentNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPaymentNotFound)
+		return
+	} else if errors.Is(err, payapi.ErrPaymentAlreadyCompleted) {
+		// most often the worker saw it on chain first
+		s.respondWithError(w, r, http.StatusConflict, ErrPaymentCompleted)
+		return
+	} else if errors.Is(err, payapi.ErrPaymentNotOpen) {
+		s.respondWithError(w, r, http.StatusConflict, ErrPaymentNotOpen)
+		return
+	} else if err != nil {
 		log.Printf("CheckAndCompletePayment() failed err: %v\n", err)
 		s.respondWithError(w, r, http.StatusInternalServerError, ErrCompletePayment)
 		return
@@ -96,3 +290,27 @@ func (s *Server) handlePaymentComplete(w http.ResponseWriter, r *http.Request) {
 	// return the payment struct to the user with updated fields (txid and completed_at)
 	json.NewEncoder(w).Encode(p)
 }
+
+func (s *Server) handlePaymentWebhooks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	payment, err := s.app.PaymentService.FindPaymentByID(r.Context(), int(id))
+	if err != nil || payment.PlatformId != platformFromContext(r.Context()).ID {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPaymentNotFound)
+		return
+	}
+
+	deliveries, err := s.app.WebhookService.FindWebhookDeliveries(r.Context(), payapi.WebhookDeliveryFilter{PaymentId: &payment.ID})
+	if err != nil {
+		log.Printf("FindWebhookDeliveries() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
@@ -1,36 +1,381 @@
 package http
 
 import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/algo-casino/payapi"
 	"github.com/go-chi/chi/v5"
 )
 
 type (
-	_paymentCreateRequest struct {
-		PlatformId uint64 `json:"platformId" validate:"required,numeric"` // who does this belong to
-		Sender     string `json:"sender" validate:"required,len=58"`
-		AssetId    uint64 `json:"assetId" validate:"required,numeric"`
-		Amount     uint64 `json:"amount" validate:"required,numeric"`
+	platformCreateRequest struct {
+		Name       string `json:"name" validate:"required"`
+		Active     bool   `json:"active"`
+		Address    string `json:"address" validate:"required,len=58"`
+		WebhookUrl string `json:"webhookUrl" validate:"required,url"`
+
+		// payapi.WebhookVersion*, signed events when unset
+		WebhookVersion int `json:"webhookVersion" validate:"omitempty,oneof=1 2"`
+	}
+
+	platformWebhookRequest struct {
+		WebhookUrl string `json:"webhookUrl" validate:"required,url"`
+
+		// switching a legacy platform to signed events, left alone when unset
+		WebhookVersion *int `json:"webhookVersion" validate:"omitempty,oneof=1 2"`
+	}
+
+	platformActiveRequest struct {
+		Active bool `json:"active"`
+	}
 
-		ExternalId uint64 `json:"externalId" validate:"required,numeric"` // ID of the payment for the webhook callback
+	platformAddressRequest struct {
+		Address string `json:"address" validate:"required,len=58"`
+	}
+
+	// nil fields are left alone
+	platformSettingsRequest struct {
+		PaymentExpiry      *int    `json:"paymentExpiry" validate:"omitempty,min=1"`
+		MatchWindow        *int    `json:"matchWindow" validate:"omitempty,min=1"`
+		NoteFormat         *string `json:"noteFormat" validate:"omitempty,max=1000"`
+		AmountToleranceBps *int    `json:"amountToleranceBps" validate:"omitempty,min=0,max=9999"`
+	}
+
+	platformAssetRequest struct {
+		Name      string  `json:"name" validate:"required"`
+		Decimals  int     `json:"decimals" validate:"min=0,max=19"`
+		MinAmount uint64  `json:"minAmount" validate:"numeric"`
+		MaxAmount *uint64 `json:"maxAmount" validate:"omitempty,numeric"`
+
+		ReviewThreshold *uint64 `json:"reviewThreshold" validate:"omitempty,numeric"`
 	}
 )
 
 func (s *Server) registerPlatformRoutes() chi.Router {
 	r := chi.NewRouter()
 
-	// unauthenticated routes
+	// admin routes
 	r.Group(func(r chi.Router) {
-		// raw index route (returns view)
-		// r.Post("/", s.handlePlatformCreate)
+		r.Use(s.requireAdmin)
+
+		r.Get("/", s.handlePlatformIndex)
+		r.Post("/", s.handlePlatformCreate)
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", s.handlePlatformGet)
 
-		// r.Route("/{id}", func(r chi.Router) {
-		// 	r.Post("/complete", s.handlePaymentComplete)
-		// })
+			r.Put("/webhook", s.handlePlatformUpdateWebhook)
+			r.Put("/active", s.handlePlatformUpdateActive)
+			r.Put("/address", s.handlePlatformUpdateAddress)
 
+			// payment expiry and matching
+			r.Put("/settings", s.handlePlatformUpdateSettings)
+
+			// new signing secret for webhook calls
+			r.Post("/webhookSecret", s.handlePlatformRotateWebhookSecret)
+
+			r.Get("/apiKeys", s.handlePlatformApiKeyIndex)
+			r.Post("/apiKeys", s.handlePlatformApiKeyCreate)
+			r.Delete("/apiKeys/{keyId}", s.handlePlatformApiKeyRevoke)
+
+			// accepted assets, assetId 0 is ALGO
+			r.Get("/assets", s.handlePlatformAssetIndex)
+			r.Put("/assets/{assetId}", s.handlePlatformAssetSave)
+			r.Delete("/assets/{assetId}", s.handlePlatformAssetDelete)
+		})
 	})
 
 	return r
 }
 
-// func (s *Server) handlePlatformCreate(w http.ResponseWriter, r *http.Request) {
-//}
+func (s *Server) handlePlatformIndex(w http.ResponseWriter, r *http.Request) {
+	platforms, err := s.app.PlatformService.FindPlatforms(r.Context())
+	if err != nil {
+		log.Printf("FindPlatforms() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platforms)
+}
+
+func (s *Server) handlePlatformCreate(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*platformCreateRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform := &payapi.Platform{
+		Name:       params.Name,
+		Active:     params.Active,
+		Address:    params.Address,
+		WebhookUrl: params.WebhookUrl,
+
+		WebhookVersion: params.WebhookVersion,
+	}
+
+	err = s.app.PlatformService.CreatePlatform(r.Context(), platform)
+	if err != nil {
+		log.Printf("CreatePlatform() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrCreatePlatform)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(platform)
+}
+
+func (s *Server) handlePlatformGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform, err := s.app.PlatformService.FindPlatformByID(r.Context(), int(id))
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPlatformNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform)
+}
+
+// shared by the single field update routes
+func (s *Server) updatePlatform(w http.ResponseWriter, r *http.Request, upd payapi.PlatformUpdate) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform, err := s.app.PlatformService.UpdatePlatform(r.Context(), int(id), upd)
+	if err != nil {
+		log.Printf("UpdatePlatform() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform)
+}
+
+func (s *Server) handlePlatformUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*platformWebhookRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	s.updatePlatform(w, r, payapi.PlatformUpdate{WebhookUrl: &params.WebhookUrl, WebhookVersion: params.WebhookVersion})
+}
+
+func (s *Server) handlePlatformUpdateActive(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*platformActiveRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	s.updatePlatform(w, r, payapi.PlatformUpdate{Active: &params.Active})
+}
+
+func (s *Server) handlePlatformUpdateAddress(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*platformAddressRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	s.updatePlatform(w, r, payapi.PlatformUpdate{Address: &params.Address})
+}
+
+func (s *Server) handlePlatformUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*platformSettingsRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	s.updatePlatform(w, r, payapi.PlatformUpdate{
+		PaymentExpiry:      params.PaymentExpiry,
+		MatchWindow:        params.MatchWindow,
+		NoteFormat:         params.NoteFormat,
+		AmountToleranceBps: params.AmountToleranceBps,
+	})
+}
+
+func (s *Server) handlePlatformRotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform, err := s.app.PlatformService.RotateWebhookSecret(r.Context(), int(id))
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPlatformNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(platform)
+}
+
+func (s *Server) handlePlatformApiKeyIndex(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	keys, err := s.app.PlatformService.FindPlatformApiKeys(r.Context(), int(id))
+	if err != nil {
+		log.Printf("FindPlatformApiKeys() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (s *Server) handlePlatformApiKeyCreate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform, err := s.app.PlatformService.FindPlatformByID(r.Context(), int(id))
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPlatformNotFound)
+		return
+	}
+
+	key, err := s.app.PlatformService.CreatePlatformApiKey(r.Context(), platform.ID)
+	if err != nil {
+		log.Printf("CreatePlatformApiKey() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	// only time the key is ever shown
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *Server) handlePlatformApiKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	keyId, err := strconv.ParseInt(chi.URLParam(r, "keyId"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	err = s.app.PlatformService.RevokePlatformApiKey(r.Context(), int(id), int(keyId))
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePlatformAssetIndex(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	assets, err := s.app.PlatformService.FindPlatformAssets(r.Context(), int(id))
+	if err != nil {
+		log.Printf("FindPlatformAssets() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assets)
+}
+
+func (s *Server) handlePlatformAssetSave(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	assetId, err := strconv.ParseUint(chi.URLParam(r, "assetId"), 10, 64)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*platformAssetRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	platform, err := s.app.PlatformService.FindPlatformByID(r.Context(), int(id))
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, ErrPlatformNotFound)
+		return
+	}
+
+	asset := &payapi.PlatformAsset{
+		PlatformId: platform.ID,
+		AssetId:    assetId,
+		Name:       params.Name,
+		Decimals:   params.Decimals,
+		MinAmount:  params.MinAmount,
+		MaxAmount:  params.MaxAmount,
+
+		ReviewThreshold: params.ReviewThreshold,
+	}
+
+	err = s.app.PlatformService.SavePlatformAsset(r.Context(), asset)
+	if err != nil {
+		log.Printf("SavePlatformAsset() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
+
+func (s *Server) handlePlatformAssetDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	assetId, err := strconv.ParseUint(chi.URLParam(r, "assetId"), 10, 64)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	err = s.app.PlatformService.DeletePlatformAsset(r.Context(), int(id), assetId)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -26,6 +26,9 @@ type Server struct {
 
 	// Validator
 	Validator utils.Validator
+
+	// bearer token required by admin routes, admin routes are disabled when empty
+	AdminApiKey string
 }
 
 func NewServer(app *payapi.App) *Server {
@@ -45,8 +48,8 @@ func NewServer(app *payapi.App) *Server {
 		//AllowedOrigins: []string{"https://labs.algo-casino.com"},
 		AllowedOrigins:  []string{"https://*", "http://*"}, // allow any origin
 		AllowOriginFunc: func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:  []string{"POST", "OPTIONS", "GET", "PUT"},
-		AllowedHeaders:  []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Xsrf-Token"},
+		AllowedMethods:  []string{"POST", "OPTIONS", "GET", "PUT", "DELETE"},
+		AllowedHeaders:  []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Xsrf-Token", "Idempotency-Key"},
 		//ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		//Debug:            true,
@@ -63,13 +66,17 @@ func NewServer(app *payapi.App) *Server {
 		},
 		)))
 
+	s.router.Mount("/admin", s.registerAdminRoutes())
 	s.router.Mount("/platforms", s.registerPlatformRoutes())
 	s.router.Mount("/payments", s.registerPaymentRoutes())
+	s.router.Mount("/withdrawals", s.registerWithdrawalRoutes())
 	s.router.Mount("/casino", s.registerCasinoRoutes())
 
+	s.router.Mount("/stakingAssets", s.registerStakingAssetRoutes())
 	s.router.Mount("/stakingPeriods", s.registerStakingPeriodRoutes())
 	s.router.Mount("/stakingCommitments", s.registerStakingCommitmentRoutes())
 	s.router.Mount("/stakingResults", s.registerStakingResultRoutes())
+	s.router.Mount("/addresses", s.registerAddressRoutes())
 
 	return s
 }
@@ -135,8 +142,11 @@ func decodeAndValidateRequest[T any](r io.Reader, v *utils.Validator) (T, error)
 	var obj T
 
 	// if user passed us a validator
-	if v != nil && v.Validate(tmp) != nil {
-		return obj, err
+	if v != nil {
+		err = v.Validate(tmp)
+		if err != nil {
+			return obj, err
+		}
 	}
 
 	obj = tmp
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/utils"
+)
+
+func TestDecodeAndValidateRequest(t *testing.T) {
+	v := utils.NewValidator()
+
+	t.Run("OK", func(t *testing.T) {
+		params, err := decodeAndValidateRequest[*stakingResultCreateRequest](strings.NewReader(`{"profit": 100}`), v)
+		if err != nil {
+			t.Fatal(err)
+		} else if params == nil || params.Profit != 100 {
+			t.Fatalf("unexpected params: %+v", params)
+		}
+	})
+
+	t.Run("ErrValidation", func(t *testing.T) {
+		params, err := decodeAndValidateRequest[*stakingResultCreateRequest](strings.NewReader(`{"profit": 0}`), v)
+		if err == nil {
+			t.Fatal("expected error")
+		} else if params != nil {
+			t.Fatalf("unexpected params: %+v", params)
+		}
+	})
+}
+
+func TestServer_RejectedBody(t *testing.T) {
+	// bodies failing validation are a bad request, never a panic
+
+	s := NewServer(&payapi.App{})
+	s.Validator = *utils.NewValidator()
+	s.AdminApiKey = "secret"
+
+	body := `{"registrationBegin": "2026-11-01T00:00:00Z", "registrationEnd": "2026-11-02T00:00:00Z", "commitmentBegin": "2026-11-02T00:00:00Z", "commitmentEnd": "2026-11-09T00:00:00Z", "chipRatio": 0}`
+
+	r := httptest.NewRequest(http.MethodPost, "/stakingPeriods/", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+
+	s.router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Code=%d, want %d", w.Code, http.StatusBadRequest)
+	} else if !strings.Contains(w.Body.String(), ErrBadParameters) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/algo-casino/payapi"
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	stakingAssetRequest struct {
+		Name        string  `json:"name" validate:"required"`
+		PoolAddress *string `json:"poolAddress" validate:"omitempty,len=58"`
+		Weight      float64 `json:"weight" validate:"gte=0"`
+		PriceSource string  `json:"priceSource" validate:"required,oneof=fixed chip_ratio"`
+		AutoStake   bool    `json:"autoStake"`
+		Active      bool    `json:"active"`
+	}
+
+	stakingAssetCreateRequest struct {
+		stakingAssetRequest
+
+		AssetId  uint64 `json:"assetId" validate:"required,numeric"`
+		Decimals int    `json:"decimals" validate:"gte=0,lte=19"`
+	}
+)
+
+func (s *Server) registerStakingAssetRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	// unauthenticated routes
+	r.Group(func(r chi.Router) {
+		// what can be committed, and what it's worth
+		r.Get("/", s.handleStakingAssetIndex)
+	})
+
+	// admin routes, adding a pool is a data change
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireAdmin)
+
+		r.Post("/", s.handleStakingAssetCreate)
+		r.Put("/{assetId}", s.handleStakingAssetUpdate)
+	})
+
+	return r
+}
+
+func (s *Server) handleStakingAssetIndex(w http.ResponseWriter, r *http.Request) {
+	filter := payapi.StakingAssetFilter{}
+
+	if v := r.URL.Query().Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		filter.Active = &active
+	}
+
+	assets, err := s.app.StakingAssetService.FindStakingAssets(r.Context(), filter)
+	if err != nil {
+		log.Printf("FindStakingAssets() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assets)
+}
+
+func (s *Server) handleStakingAssetCreate(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*stakingAssetCreateRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	asset := &payapi.StakingAsset{
+		AssetId:     params.AssetId,
+		Name:        params.Name,
+		PoolAddress: params.PoolAddress,
+		Decimals:    params.Decimals,
+		Weight:      params.Weight,
+		PriceSource: params.PriceSource,
+		AutoStake:   params.AutoStake,
+		Active:      params.Active,
+	}
+
+	err = s.app.StakingAssetService.CreateStakingAsset(r.Context(), asset)
+	if err != nil {
+		log.Printf("CreateStakingAsset() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(asset)
+}
+
+func (s *Server) handleStakingAssetUpdate(w http.ResponseWriter, r *http.Request) {
+	assetId, err := strconv.ParseUint(chi.URLParam(r, "assetId"), 10, 64)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*stakingAssetRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	asset := &payapi.StakingAsset{
+		AssetId:     assetId,
+		Name:        params.Name,
+		PoolAddress: params.PoolAddress,
+		Weight:      params.Weight,
+		PriceSource: params.PriceSource,
+		AutoStake:   params.AutoStake,
+		Active:      params.Active,
+	}
+
+	err = s.app.StakingAssetService.UpdateStakingAsset(r.Context(), asset)
+	if err != nil {
+		log.Printf("UpdateStakingAsset() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
@@ -2,7 +2,9 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,31 +18,22 @@ type (
 	stakingCommitmentCreate struct {
 		*AuthRequest // Require signed txn
 
-		StakingPeriodID       int    `json:"stakingPeriodId"`
-		AlgorandAddress       string `json:"algorandAddress" validate:"required,len=58"`
-		ChipCommitment        uint64 `json:"chipCommitment"`
-		LiquidityCommitment   uint64 `json:"liquidityCommitment"`
-		LiquidityCommitmentV2 uint64 `json:"liquidityCommitmentV2"`
+		StakingPeriodID int    `json:"stakingPeriodId"`
+		AlgorandAddress string `json:"algorandAddress" validate:"required,len=58"`
 
-		// new liquid concensus targets
-		CAlgoCommitment uint64 `json:"cAlgoCommitment"`
-		TAlgoCommitment uint64 `json:"tAlgoCommitment"`
-		MAlgoCommitment uint64 `json:"mAlgoCommitment"`
-		XAlgoCommitment uint64 `json:"xAlgoCommitment"`
+		// amounts of assets from the staking asset registry
+		Assets []*payapi.StakingCommitmentItem `json:"assets"`
 	}
 
 	stakingCommitmentUpdate struct {
 		*AuthRequest
 
-		ChipCommitment        uint64 `json:"chipCommitment"`
-		LiquidityCommitment   uint64 `json:"liquidityCommitment"`
-		LiquidityCommitmentV2 uint64 `json:"liquidityCommitmentV2"`
+		// replaces every asset previously committed
+		Assets []*payapi.StakingCommitmentItem `json:"assets"`
+	}
 
-		// new liquid concensus targets
-		CAlgoCommitment uint64 `json:"cAlgoCommitment"`
-		TAlgoCommitment uint64 `json:"tAlgoCommitment"`
-		MAlgoCommitment uint64 `json:"mAlgoCommitment"`
-		XAlgoCommitment uint64 `json:"xAlgoCommitment"`
+	stakingCommitmentReinstate struct {
+		Reason string `json:"reason" validate:"required"`
 	}
 )
 
@@ -51,6 +44,12 @@ func (s *Server) registerStakingCommitmentRoutes() chi.Router {
 	r.Group(func(r chi.Router) {
 		// raw index route (returns view)
 		r.Get("/", s.handleStakingCommitmentsIndex)
+
+		// why a commitment was disqualified or reinstated
+		r.Get("/{id}/eligibility", s.handleStakingCommitmentsEligibility)
+
+		// reinstate after a false positive, e.g. an indexer outage
+		r.With(s.requireAdmin).Post("/{id}/reinstate", s.handleStakingCommitmentsReinstate)
 	})
 
 	// authenticated routes (requires signed txn)
@@ -122,15 +121,9 @@ func (s *Server) handleStakingCommitmentsCreate(w http.ResponseWriter, r *http.R
 	// }
 
 	sc := &payapi.StakingCommitment{
-		StakingPeriodID:       int(params.StakingPeriodID),
-		AlgorandAddress:       params.AlgorandAddress,
-		ChipCommitment:        params.ChipCommitment,
-		LiquidityCommitment:   params.LiquidityCommitment,
-		LiquidityCommitmentV2: params.LiquidityCommitmentV2,
-		CAlgoCommitment:       params.CAlgoCommitment,
-		TAlgoCommitment:       params.TAlgoCommitment,
-		MAlgoCommitment:       params.MAlgoCommitment,
-		XAlgoCommitment:       params.XAlgoCommitment,
+		StakingPeriodID: int(params.StakingPeriodID),
+		AlgorandAddress: params.AlgorandAddress,
+		Assets:          params.Assets,
 	}
 
 	err = s.app.StakingCommitmentService.CreateStakingCommitment(r.Context(), sc)
@@ -198,15 +191,9 @@ func (s *Server) handleStakingCommitmentsUpdate(w http.ResponseWriter, r *http.R
 	}
 
 	sc := &payapi.StakingCommitment{
-		ID:                    int(id),
-		StakingPeriodID:       stakingCommitment.StakingPeriodID,
-		ChipCommitment:        params.ChipCommitment,
-		LiquidityCommitment:   params.LiquidityCommitment,
-		LiquidityCommitmentV2: params.LiquidityCommitmentV2,
-		CAlgoCommitment:       params.CAlgoCommitment,
-		TAlgoCommitment:       params.TAlgoCommitment,
-		MAlgoCommitment:       params.MAlgoCommitment,
-		XAlgoCommitment:       params.XAlgoCommitment,
+		ID:              int(id),
+		StakingPeriodID: stakingCommitment.StakingPeriodID,
+		Assets:          params.Assets,
 	}
 
 	err = s.app.StakingCommitmentService.UpdateStakingCommitment(r.Context(), sc)
@@ -215,9 +202,76 @@ func (s *Server) handleStakingCommitmentsUpdate(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	msg := fmt.Sprintf("%s updated commitment %d! chip: %d -> %d\t lp: %d -> %d\t lp v2: %d -> %d\n", stakingCommitment.AlgorandAddress, stakingCommitment.ID, stakingCommitment.ChipCommitment, sc.ChipCommitment, stakingCommitment.LiquidityCommitment, sc.LiquidityCommitment, stakingCommitment.LiquidityCommitmentV2, sc.LiquidityCommitmentV2)
+	msg := fmt.Sprintf("%s updated commitment %d!", stakingCommitment.AlgorandAddress, stakingCommitment.ID)
+	for _, item := range sc.Assets {
+		msg += fmt.Sprintf("\t asset %d: %d -> %d", item.AssetId, stakingCommitment.AssetAmount(item.AssetId), item.Amount)
+	}
+	for _, item := range stakingCommitment.Assets {
+		if sc.AssetAmount(item.AssetId) == 0 {
+			msg += fmt.Sprintf("\t asset %d: %d -> 0", item.AssetId, item.Amount)
+		}
+	}
+	msg += "\n"
 	s.app.NotifyService.Notify(r.Context(), msg)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(sc)
 }
+
+func (s *Server) handleStakingCommitmentsEligibility(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+	t := int(id)
+
+	_, err = s.app.StakingCommitmentService.FindStakingCommitmentByID(r.Context(), t)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingCommitmentNotFound)
+		return
+	}
+
+	events, err := s.app.StakingCommitmentService.FindEligibilityEvents(r.Context(), payapi.EligibilityEventFilter{StakingCommitmentId: &t})
+	if err != nil {
+		log.Printf("FindEligibilityEvents() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+func (s *Server) handleStakingCommitmentsReinstate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*stakingCommitmentReinstate](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	sc, err := s.app.StakingCommitmentService.UpdateEligibility(r.Context(), int(id), &payapi.EligibilityEvent{
+		Eligible: true,
+		Source:   payapi.EligibilitySourceAdmin,
+		Reason:   params.Reason,
+	})
+	if errors.Is(err, payapi.ErrStakingCommitmentNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingCommitmentNotFound)
+		return
+	} else if err != nil {
+		log.Printf("UpdateEligibility() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	s.app.NotifyService.Notify(r.Context(), fmt.Sprintf("%s reinstated for staking period %d: %s\n", sc.AlgorandAddress, sc.StakingPeriodID, params.Reason))
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sc)
+}
@@ -2,16 +2,33 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/algo-casino/payapi"
 	"github.com/go-chi/chi/v5"
 )
 
 type (
+	stakingPeriodRequest struct {
+		RegistrationBegin time.Time `json:"registrationBegin" validate:"required"`
+		RegistrationEnd   time.Time `json:"registrationEnd" validate:"required"`
+		CommitmentBegin   time.Time `json:"commitmentBegin" validate:"required"`
+		CommitmentEnd     time.Time `json:"commitmentEnd" validate:"required"`
+		ChipRatio         float64   `json:"chipRatio" validate:"required,gt=0"`
+
+		// casino game types funding rewards, every game when empty
+		FundingGames []string `json:"fundingGames" validate:"omitempty,dive,required"`
+	}
+
 	stakingResultCreateRequest struct {
 		Profit uint64 `json:"profit" validate:"required,numeric"`
+
+		// commitment (default), average or minimum, see payapi.StakingWeighting*
+		Weighting string `json:"weighting" validate:"omitempty,oneof=commitment average minimum"`
 	}
 )
 
@@ -24,20 +41,43 @@ func (s *Server) registerStakingPeriodRoutes() chi.Router {
 		r.Get("/", s.handleStakingPeriodsIndex)
 
 		// create
-		//r.Post("/", s.handleStakingPeriodsCreate)
+		r.With(s.requireAdmin).Post("/", s.handleStakingPeriodsCreate)
 
 		r.Route("/{id}", func(r chi.Router) {
 			// get individual
 			r.Get("/", s.handleStakingPeriodsGet)
 
+			// edit, only before registration begins
+			r.With(s.requireAdmin).Put("/", s.handleStakingPeriodsUpdate)
+
+			// settle once the result is in
+			r.With(s.requireAdmin).Post("/close", s.handleStakingPeriodsClose)
+
 			// create result
-			r.Post("/createResult", s.handleStakingPeriodsCreateResult)
+			r.With(s.requireAdmin).Post("/createResult", s.handleStakingPeriodsCreateResult)
+
+			// what a check or result would do, nothing is saved
+			r.With(s.requireAdmin).Post("/previewCheck", s.handleStakingPeriodsPreviewCheck)
+			r.With(s.requireAdmin).Post("/previewResult", s.handleStakingPeriodsPreviewResult)
 
 			// do autostake
-			r.Post("/autoStake", s.handleAutoStakeCreate)
+			r.With(s.requireAdmin).Post("/autoStake", s.handleAutoStakeCreate)
 
 			// get latest profit for period
 			r.Get("/profit", s.handleStakingPeriodsGetProfit)
+
+			// every snapshot taken, ?from=&to= (RFC 3339), ?interval= (eg 24h) and ?points= thin them out
+			r.Get("/profit/history", s.handleStakingPeriodsProfitHistory)
+
+			// gross gaming revenue per day and cumulative
+			r.Get("/profit/daily", s.handleStakingPeriodsProfitDaily)
+
+			// chip ratios pooled assets were priced at
+			r.Get("/ratios", s.handleStakingPeriodsRatios)
+
+			// reward payouts of the result
+			r.Get("/payouts", s.handleStakingPeriodsPayouts)
+			r.With(s.requireAdmin).Post("/distribute", s.handleStakingPeriodsDistribute)
 		})
 	})
 
@@ -56,9 +96,97 @@ func (s *Server) handleStakingPeriodsIndex(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(sps)
 }
 
-// func (s *Server) handleStakingPeriodsCreate(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleStakingPeriodsCreate(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*stakingPeriodRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
 
-// }
+	sp := &payapi.StakingPeriod{
+		RegistrationBegin: params.RegistrationBegin.UTC(),
+		RegistrationEnd:   params.RegistrationEnd.UTC(),
+		CommitmentBegin:   params.CommitmentBegin.UTC(),
+		CommitmentEnd:     params.CommitmentEnd.UTC(),
+		ChipRatio:         params.ChipRatio,
+		FundingGames:      params.FundingGames,
+	}
+
+	err = s.app.StakingPeriodService.CreateStakingPeriod(r.Context(), sp)
+	if err != nil {
+		log.Printf("CreateStakingPeriod() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sp)
+}
+
+func (s *Server) handleStakingPeriodsUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*stakingPeriodRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	sp := &payapi.StakingPeriod{
+		ID:                int(id),
+		RegistrationBegin: params.RegistrationBegin.UTC(),
+		RegistrationEnd:   params.RegistrationEnd.UTC(),
+		CommitmentBegin:   params.CommitmentBegin.UTC(),
+		CommitmentEnd:     params.CommitmentEnd.UTC(),
+		ChipRatio:         params.ChipRatio,
+		FundingGames:      params.FundingGames,
+	}
+
+	err = s.app.StakingPeriodService.UpdateStakingPeriod(r.Context(), sp)
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if errors.Is(err, payapi.ErrStakingPeriodNotEditable) {
+		s.respondWithError(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("UpdateStakingPeriod() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sp)
+}
+
+func (s *Server) handleStakingPeriodsClose(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	sp, err := s.app.StakingPeriodService.CloseStakingPeriod(r.Context(), int(id))
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if errors.Is(err, payapi.ErrStakingPeriodNotSettling) || errors.Is(err, payapi.ErrStakingPeriodNoResult) {
+		s.respondWithError(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("CloseStakingPeriod() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sp)
+}
 
 func (s *Server) handleStakingPeriodsGet(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
@@ -68,7 +196,10 @@ func (s *Server) handleStakingPeriodsGet(w http.ResponseWriter, r *http.Request)
 	}
 
 	sp, err := s.app.StakingPeriodService.FindStakingPeriodByID(r.Context(), int(id))
-	if err != nil {
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if err != nil {
 		s.respondWithError(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -111,8 +242,20 @@ func (s *Server) handleStakingPeriodsCreateResult(w http.ResponseWriter, r *http
 
 	stakingPeriodId := int(id)
 
-	res, err := s.app.StakingResultService.CreateStakingResult(r.Context(), stakingPeriodId, params.Profit)
-	if err != nil {
+	weighting := params.Weighting
+	if weighting == "" {
+		weighting = payapi.StakingWeightingCommitment
+	}
+
+	res, err := s.app.StakingResultService.CreateStakingResult(r.Context(), stakingPeriodId, params.Profit, weighting)
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if errors.Is(err, payapi.ErrStakingPeriodNotSettling) || errors.Is(err, payapi.ErrStakingResultExists) {
+		s.respondWithError(w, r, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("CreateStakingResult() failed err: %v\n", err)
 		s.respondWithError(w, r, http.StatusBadRequest, ErrGeneric)
 		return
 	}
@@ -122,6 +265,65 @@ func (s *Server) handleStakingPeriodsCreateResult(w http.ResponseWriter, r *http
 	json.NewEncoder(w).Encode(res)
 }
 
+func (s *Server) handleStakingPeriodsPreviewCheck(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	_, err = s.app.StakingPeriodService.FindStakingPeriodByID(r.Context(), int(id))
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if err != nil {
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	report, err := s.app.StakingCheckService.CheckStakingCommitments(r.Context(), int(id), true)
+	if err != nil {
+		log.Printf("CheckStakingCommitments() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) handleStakingPeriodsPreviewResult(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*stakingResultCreateRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	weighting := params.Weighting
+	if weighting == "" {
+		weighting = payapi.StakingWeightingCommitment
+	}
+
+	preview, err := s.app.StakingCheckService.PreviewStakingResult(r.Context(), int(id), params.Profit, weighting)
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if err != nil {
+		log.Printf("PreviewStakingResult() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
 func (s *Server) handleAutoStakeCreate(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
 	if err != nil {
@@ -129,15 +331,17 @@ func (s *Server) handleAutoStakeCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.app.StakingNftService.CreateAutoStake(r.Context(), int(id))
+	report, err := s.app.StakingNftService.CreateAutoStake(r.Context(), int(id))
 	if err != nil {
+		log.Printf("CreateAutoStake() failed err: %v\n", err)
 		s.respondWithError(w, r, http.StatusInternalServerError, "failed to create auto stake commitments")
 		return
 	}
 
 	// notify it's been created
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	return
+	json.NewEncoder(w).Encode(report)
 }
 
 func (s *Server) handleStakingPeriodsGetProfit(w http.ResponseWriter, r *http.Request) {
@@ -157,3 +361,146 @@ func (s *Server) handleStakingPeriodsGetProfit(w http.ResponseWriter, r *http.Re
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(snapshot)
 }
+
+func (s *Server) handleStakingPeriodsProfitHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+	t := int(id)
+
+	filter := payapi.StakeProfitSnapshotFilter{StakingPeriodId: &t}
+
+	q := r.URL.Query()
+
+	for param, v := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if q.Get(param) == "" {
+			continue
+		}
+
+		tm, err := time.Parse(time.RFC3339, q.Get(param))
+		if err != nil {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+		*v = &tm
+	}
+
+	var interval time.Duration
+	if q.Get("interval") != "" {
+		interval, err = time.ParseDuration(q.Get("interval"))
+		if err != nil || interval <= 0 {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+	}
+
+	points := 0
+	if q.Get("points") != "" {
+		points, err = strconv.Atoi(q.Get("points"))
+		if err != nil || points <= 0 {
+			s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+			return
+		}
+	}
+
+	_, err = s.app.StakingPeriodService.FindStakingPeriodByID(r.Context(), t)
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if err != nil {
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	snapshots, err := s.app.StakeProfitSnapshotService.FindStakeProfitSnapshots(r.Context(), filter)
+	if err != nil {
+		log.Printf("FindStakeProfitSnapshots() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payapi.DownsampleProfitSnapshots(snapshots, interval, points))
+}
+
+func (s *Server) handleStakingPeriodsProfitDaily(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	days, err := s.app.StakeProfitSnapshotService.GetDailyGrossProfitForPeriod(r.Context(), int(id))
+	if errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingPeriodNotFound)
+		return
+	} else if err != nil {
+		log.Printf("GetDailyGrossProfitForPeriod() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(days)
+}
+
+func (s *Server) handleStakingPeriodsRatios(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	stakingPeriodId := int(id)
+
+	ratios, err := s.app.StakingAssetService.FindStakingAssetRatios(r.Context(), payapi.StakingAssetRatioFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		log.Printf("FindStakingAssetRatios() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratios)
+}
+
+func (s *Server) handleStakingPeriodsPayouts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	stakingPeriodId := int(id)
+
+	payouts, err := s.app.StakingPayoutService.FindStakingPayouts(r.Context(), payapi.StakingPayoutFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		log.Printf("FindStakingPayouts() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payouts)
+}
+
+func (s *Server) handleStakingPeriodsDistribute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	// resumable, anything already sent or confirmed is left alone, the worker does the sending
+	dist, err := s.app.StakingPayoutService.QueueStakingPayouts(r.Context(), int(id))
+	if err != nil {
+		log.Printf("QueueStakingPayouts() stakingPeriod: %d failed err: %v\n", id, err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dist)
+}
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -9,6 +13,14 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+type (
+	stakingResultVerifyResponse struct {
+		Valid  bool   `json:"valid"`
+		Signer string `json:"signer"`
+		Error  string `json:"error,omitempty"`
+	}
+)
+
 func (s *Server) registerStakingResultRoutes() chi.Router {
 	r := chi.NewRouter()
 
@@ -16,6 +28,13 @@ func (s *Server) registerStakingResultRoutes() chi.Router {
 	r.Group(func(r chi.Router) {
 		// raw index route (returns view)
 		r.Get("/", s.handleStakingResultIndex)
+
+		// published payout lists
+		r.Get("/{id}/export.csv", s.handleStakingResultExportCSV)
+		r.Get("/{id}/export.json", s.handleStakingResultExportJSON)
+
+		// check a signed export
+		r.Post("/verify", s.handleStakingResultVerify)
 	})
 
 	return r
@@ -39,3 +58,93 @@ func (s *Server) handleStakingResultIndex(w http.ResponseWriter, r *http.Request
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(scs)
 }
+
+// export of the result in the url, nil after responding with an error
+func (s *Server) exportStakingResult(w http.ResponseWriter, r *http.Request) *payapi.StakingResultExport {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return nil
+	}
+
+	export, err := s.app.StakingExportService.ExportStakingResult(r.Context(), int(id))
+	if errors.Is(err, payapi.ErrStakingResultNotFound) {
+		s.respondWithError(w, r, http.StatusNotFound, ErrStakingResultNotFound)
+		return nil
+	} else if err != nil {
+		log.Printf("ExportStakingResult() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return nil
+	}
+
+	return export
+}
+
+func (s *Server) handleStakingResultExportCSV(w http.ResponseWriter, r *http.Request) {
+	export := s.exportStakingResult(w, r)
+	if export == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"staking-period-%d-result-%d.csv\"", export.StakingPeriod.ID, export.StakingResultId))
+
+	cw := csv.NewWriter(w)
+
+	cw.Write([]string{"stakingPeriodId", "stakingResultId", "address", "reward"})
+
+	for _, reward := range export.Rewards {
+		cw.Write([]string{
+			strconv.Itoa(export.StakingPeriod.ID),
+			strconv.Itoa(export.StakingResultId),
+			reward.Address,
+			strconv.FormatUint(reward.Reward, 10),
+		})
+	}
+
+	cw.Flush()
+}
+
+func (s *Server) handleStakingResultExportJSON(w http.ResponseWriter, r *http.Request) {
+	export := s.exportStakingResult(w, r)
+	if export == nil {
+		return
+	}
+
+	signed, err := s.app.StakingExportService.SignStakingResultExport(r.Context(), export)
+	if errors.Is(err, payapi.ErrNoSigningKey) {
+		s.respondWithError(w, r, http.StatusServiceUnavailable, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("SignStakingResultExport() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(signed)
+}
+
+func (s *Server) handleStakingResultVerify(w http.ResponseWriter, r *http.Request) {
+	signed := &payapi.SignedStakingResultExport{}
+
+	err := json.NewDecoder(r.Body).Decode(signed)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	res := &stakingResultVerifyResponse{
+		Signer: signed.Signer,
+	}
+
+	err = VerifyStakingResultExport(signed)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Valid = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/algo-casino/payapi"
+	"github.com/go-chi/chi/v5"
+)
+
+type (
+	withdrawalCreateRequest struct {
+		PlatformId int    `json:"platformId" validate:"required,numeric"` // who does this belong to
+		Receiver   string `json:"receiver" validate:"required,len=58"`
+		AssetId    uint64 `json:"assetId" validate:"numeric"` // zero for ALGO
+		Amount     uint64 `json:"amount" validate:"required,numeric"`
+
+		ExternalId int `json:"externalId" validate:"required,numeric"` // ID of the withdrawal for the webhook callback
+	}
+
+	withdrawalFailRequest struct {
+		Reason string `json:"reason" validate:"required"`
+	}
+)
+
+func (s *Server) registerWithdrawalRoutes() chi.Router {
+	r := chi.NewRouter()
+
+	// platform routes (requires platform api key)
+	r.Group(func(r chi.Router) {
+		r.Use(s.requirePlatform)
+
+		// request a payout, does nothing until approved
+		r.Post("/", s.handleWithdrawalCreate)
+
+		r.Get("/{id}", s.handleWithdrawalGet)
+
+		// webhook delivery log
+		r.Get("/{id}/webhooks", s.handleWithdrawalWebhooks)
+	})
+
+	// admin routes
+	r.Group(func(r chi.Router) {
+		r.Use(s.requireAdmin)
+
+		r.Post("/{id}/approve", s.handleWithdrawalApprove)
+		r.Post("/{id}/fail", s.handleWithdrawalFail)
+	})
+
+	return r
+}
+
+func (s *Server) handleWithdrawalCreate(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeAndValidateRequest[*withdrawalCreateRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	// platforms can only request payouts for themselves
+	if platformFromContext(r.Context()).ID != params.PlatformId {
+		s.respondWithError(w, r, http.StatusForbidden, ErrForbidden)
+		return
+	}
+
+	withdrawal := payapi.Withdrawal{
+		PlatformId: params.PlatformId,
+
+		Status:   payapi.WithdrawalStatusRequested,
+		Receiver: params.Receiver,
+		AssetId:  params.AssetId,
+		Amount:   params.Amount,
+
+		ExternalId: params.ExternalId,
+	}
+
+	err = s.app.WithdrawalService.CreateWithdrawal(r.Context(), &withdrawal)
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrCreateWithdrawal)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+func (s *Server) handleWithdrawalGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	withdrawal, err := s.app.WithdrawalService.FindWithdrawalByID(r.Context(), int(id))
+	if err != nil || withdrawal.PlatformId != platformFromContext(r.Context()).ID {
+		s.respondWithError(w, r, http.StatusNotFound, ErrWithdrawalNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+func (s *Server) handleWithdrawalApprove(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	withdrawal, err := s.app.WithdrawalService.ApproveWithdrawal(r.Context(), int(id))
+	if err != nil {
+		log.Printf("ApproveWithdrawal() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+func (s *Server) handleWithdrawalFail(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	params, err := decodeAndValidateRequest[*withdrawalFailRequest](r.Body, &s.Validator)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	withdrawal, err := s.app.WithdrawalService.FailWithdrawal(r.Context(), int(id), params.Reason)
+	if err != nil {
+		log.Printf("FailWithdrawal() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(withdrawal)
+}
+
+func (s *Server) handleWithdrawalWebhooks(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		s.respondWithError(w, r, http.StatusBadRequest, ErrBadParameters)
+		return
+	}
+
+	withdrawal, err := s.app.WithdrawalService.FindWithdrawalByID(r.Context(), int(id))
+	if err != nil || withdrawal.PlatformId != platformFromContext(r.Context()).ID {
+		s.respondWithError(w, r, http.StatusNotFound, ErrWithdrawalNotFound)
+		return
+	}
+
+	deliveries, err := s.app.WebhookService.FindWebhookDeliveries(r.Context(), payapi.WebhookDeliveryFilter{WithdrawalId: &withdrawal.ID})
+	if err != nil {
+		log.Printf("FindWebhookDeliveries() failed err: %v\n", err)
+		s.respondWithError(w, r, http.StatusInternalServerError, ErrGeneric)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
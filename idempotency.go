@@ -0,0 +1,37 @@
+package payapi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// key is being used by a request that hasn't finished yet
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+	// key was first used for a different request
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// stored result of a request made with an Idempotency-Key header
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+type IdempotencyService interface {
+	// Claim key within scope for a request, identified by requestHash
+	// returns the stored response if the key was already used for the same request and finished,
+	// nil if the caller now owns the key and must Complete or Release it
+	BeginIdempotentRequest(ctx context.Context, scope, key, requestHash string) (*IdempotentResponse, error)
+
+	// Store the response for a claimed key, retries are given it from now on
+	CompleteIdempotentRequest(ctx context.Context, scope, key string, res IdempotentResponse) error
+
+	// Give up a claimed key without storing a response, so the request can be retried
+	ReleaseIdempotentRequest(ctx context.Context, scope, key string) error
+
+	// Delete keys created before the given time, returns how many
+	DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error)
+}
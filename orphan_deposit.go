@@ -0,0 +1,61 @@
+package payapi
+
+import (
+	"context"
+	"time"
+)
+
+// orphan lifecycle
+// open -> linked (to a payment, completing it)
+// open -> dismissed (nothing to credit, e.g. refunded by hand)
+const (
+	OrphanDepositStatusOpen      int = 0
+	OrphanDepositStatusLinked    int = 1
+	OrphanDepositStatusDismissed int = 2
+)
+
+// inbound transfer to a platform address that no payment was completed with
+type OrphanDeposit struct {
+	ID         int `json:"id"`
+	PlatformId int `json:"platformId"`
+
+	Status     int        `json:"status"`
+	DetectedAt time.Time  `json:"detectedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+
+	TransactionID string    `json:"txid"`
+	Round         uint64    `json:"round"`
+	RoundTime     time.Time `json:"roundTime"`
+	Sender        string    `json:"sender"`
+	AssetId       uint64    `json:"assetId"` // algorand asset id, or zero for network token
+	Amount        uint64    `json:"amount"`
+	Note          []byte    `json:"note"`
+	Reason        *string   `json:"reason"` // set when no payment could ever match it, e.g. an asset the platform doesn't accept
+
+	PaymentId      *int    `json:"paymentId"`      // payment it was linked to
+	ResolutionNote *string `json:"resolutionNote"` // why it was linked or dismissed
+}
+
+type OrphanDepositService interface {
+	// group, newest first
+	FindOrphanDeposits(ctx context.Context, filter OrphanDepositFilter) ([]*OrphanDeposit, error)
+
+	// Find an orphan deposit by ID, returns object
+	FindOrphanDepositByID(ctx context.Context, id int) (*OrphanDeposit, error)
+
+	// Record a transfer as orphaned, unless a payment already has its txid or it was recorded before
+	// returns true if it was recorded
+	RecordOrphanDeposit(ctx context.Context, deposit *OrphanDeposit) (bool, error)
+
+	// Link an open orphan to a created or expired payment of the same asset, completing the payment with its txid
+	// (will notify platform via webhook call)
+	LinkOrphanDeposit(ctx context.Context, id, paymentId int, note string) (*OrphanDeposit, error)
+
+	// Dismiss an open orphan, nothing is credited
+	DismissOrphanDeposit(ctx context.Context, id int, note string) (*OrphanDeposit, error)
+}
+
+type OrphanDepositFilter struct {
+	PlatformId *int `json:"platformId"`
+	Status     *int `json:"status"`
+}
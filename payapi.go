@@ -14,16 +14,43 @@ type App struct {
 	// notify webhooks
 	NotifyService NotifyService
 
+	// platform webhook outbox
+	WebhookService WebhookService
+
 	PlatformService PlatformService
 	PaymentService  PaymentService
 
+	// stored responses for retried requests
+	IdempotencyService IdempotencyService
+
+	// inbound transfers no payment was completed with
+	OrphanDepositService OrphanDepositService
+
+	// rounds processed by chain followers
+	ChainCursorService ChainCursorService
+
+	// outbound payouts
+	WithdrawalService WithdrawalService
+
 	CasinoRefundService CasinoRefundService
 	StakeService        stake.StakeService
 
 	// House staking
+	StakingAssetService      StakingAssetService
 	StakingPeriodService     StakingPeriodService
 	StakingCommitmentService StakingCommitmentService
 	StakingResultService     StakingResultService
+	StakingCheckRunService   StakingCheckRunService
+	StakingPricingService    StakingPricingService
+
+	// commitment checks and result previews
+	StakingCheckService StakingCheckService
+
+	// signed, published staking results
+	StakingExportService StakingExportService
+
+	// on chain payouts of staking results
+	StakingPayoutService StakingPayoutService
 
 	// Faucet
 	FaucetSnapshotService FaucetSnapshotService
@@ -33,4 +60,7 @@ type App struct {
 
 	// profit tracking
 	StakeProfitSnapshotService StakeProfitSnapshotService
+
+	// per address view of all the above
+	StakingDashboardService StakingDashboardService
 }
@@ -1,15 +1,33 @@
 package payapi
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"time"
+
+	"github.com/algo-casino/payapi/algo"
 )
 
 const (
-	StatusCreated   int = 0
-	StatusCancelled int = 1
-	StatusCompleted int = 2
+	StatusCreated       int = 0
+	StatusCancelled     int = 1
+	StatusCompleted     int = 2
+	StatusExpired       int = 3 // never paid before ExpiresAt
+	StatusPendingReview int = 4 // matched a txn, waiting on an admin before completing
+)
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+
+	// platform already has a payment with this externalId
+	ErrPaymentExists = errors.New("payment already exists")
+
+	// completed already, usually by the worker matching it on chain first
+	ErrPaymentAlreadyCompleted = errors.New("payment already completed")
+
+	// cancelled, expired or pending review
+	ErrPaymentNotOpen = errors.New("payment is not open")
 )
 
 type Payment struct {
@@ -20,12 +38,20 @@ type Payment struct {
 	CreatedAt   time.Time  `json:"createdAt"`
 	CancelledAt *time.Time `json:"cancelledAt"`
 	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"` // expired if not completed by this time
 
 	Sender  string `json:"sender"`  // algorand address of who's going to send the payment
 	AssetId uint64 `json:"assetId"` // algorand asset id, or zero for network token
 	Amount  uint64 `json:"amount"`  // amount in uint64
+	Note    string `json:"note"`    // txn note the sender must use, from the platform note format
+
+	TransactionID  *string `json:"txid"`           // algorand txid
+	ReceivedAmount *uint64 `json:"receivedAmount"` // amount actually sent, may differ from Amount within the platform tolerance
 
-	TransactionID *string `json:"txid"` // algorand txid
+	// manual review
+	MatchedTransactionID *string    `json:"matchedTxid"` // txid held while pending review
+	ReviewedAt           *time.Time `json:"reviewedAt"`
+	ReviewNote           *string    `json:"reviewNote"` // why it was approved or rejected
 
 	ExternalId int `json:"externalId"` // ID of payment on platforms internal storage (used for webhook notifications)
 }
@@ -34,9 +60,9 @@ func (p *Payment) Validate() error {
 
 	if p.PlatformId <= 0 {
 		return errors.New("platformId cannot be <= 0")
-	} else if p.Status < StatusCreated || p.Status > StatusCompleted {
+	} else if p.Status < StatusCreated || p.Status > StatusPendingReview {
 		return errors.New("invalid status")
-	} else if p.AssetId <= 0 || p.Amount <= 0 || p.Sender == "" {
+	} else if p.Amount <= 0 || p.Sender == "" {
 		return errors.New("invalid transaction parameters")
 	} else if p.ExternalId <= 0 {
 		return errors.New("externalId cannot be <= 0")
@@ -45,9 +71,35 @@ func (p *Payment) Validate() error {
 	return nil
 }
 
+// checks transfer pays for payment under the platforms matching settings
+// returns why it doesn't match, nil if it does
+func (p *Payment) Match(platform *Platform, t *algo.Transfer) error {
+	if t.Receiver != platform.Address {
+		return errors.New("not sent to platform")
+	} else if t.Sender != p.Sender {
+		return errors.New("sender did not match")
+	} else if t.AssetId != p.AssetId {
+		return errors.New("asset did not match")
+	} else if !platform.AmountWithinTolerance(p.Amount, t.Amount) {
+		return errors.New("amount did not match")
+	} else if !bytes.Equal(t.Note, []byte(p.Note)) {
+		return errors.New("note did not match")
+	}
+
+	// must have confirmed after payment was created, within the platform window
+	window := time.Duration(platform.MatchWindow) * time.Second
+
+	if !t.RoundTime.After(p.CreatedAt) || !t.RoundTime.Before(p.CreatedAt.Add(window)) {
+		return errors.New("transaction outside time range")
+	}
+
+	return nil
+}
+
 type PaymentService interface {
-	// group
-	FindPayments(ctx context.Context, filter PaymentFilter) ([]*Payment, error)
+	// group, newest first
+	// also returns the total matching the filter, ignoring offset and limit
+	FindPayments(ctx context.Context, filter PaymentFilter) ([]*Payment, int, error)
 
 	// Find a payment by ID, returns object
 	FindPaymentByID(ctx context.Context, id int) (*Payment, error)
@@ -56,26 +108,47 @@ type PaymentService interface {
 	// returns error on failure, payment parameter will be updated upon success
 	CreatePayment(ctx context.Context, payment *Payment) error
 
-	// Complete payment
+	// Complete payment with the txid and amount that paid it
 	// returns updated payment object upon success
-	CompletePayment(ctx context.Context, id int, txid string) (*Payment, error)
+	CompletePayment(ctx context.Context, id int, txid string, receivedAmount uint64) (*Payment, error)
 
 	// Check and complete
 	// only succeeds if given txid
-	// external_id in note field must match Payment.ExternalId
-	// must be `axfer`
-	// amount, asset_id, sender, receiver (platform)
-	// txn must be confirmed on network within 45 seconds of deposit creation
+	// note field must match Payment.Note
+	// must be `axfer` of the payment asset, or `pay` if the asset is ALGO (zero)
+	// amount (within platform tolerance), asset_id, sender, receiver (platform)
+	// txn must be confirmed on network within the platform match window of deposit creation
 	CheckAndCompletePayment(ctx context.Context, id int, txid string, round *uint64) (*Payment, error)
 
 	// Cancel payment (will notify platform via webhook call)
 	// returns updated payment (with status Cancelled) object upon success
 	CancelPayment(ctx context.Context, id int) (*Payment, error)
+
+	// Hold an open payment for review, matched to txid for receivedAmount
+	// returns updated payment (with status PendingReview) object upon success
+	HoldPaymentForReview(ctx context.Context, id int, txid string, receivedAmount uint64) (*Payment, error)
+
+	// Approve a payment pending review, completing it with the matched txid (will notify platform via webhook call)
+	ApprovePayment(ctx context.Context, id int, note string) (*Payment, error)
+
+	// Reject a payment pending review, it is cancelled (will notify platform via webhook call)
+	RejectPayment(ctx context.Context, id int, note string) (*Payment, error)
+
+	// Expire every open payment past its ExpiresAt (will notify platforms via webhook call)
+	// returns the payments expired
+	ExpirePayments(ctx context.Context) ([]*Payment, error)
 }
 
+// nil fields are not filtered on
 type PaymentFilter struct {
 	PlatformId *int       `json:"platformId"`
 	Status     *int       `json:"status"`
+	Sender     *string    `json:"sender"`
+	ExternalId *int       `json:"externalId"`
 	BeforeTime *time.Time `json:"beforeTime"`
 	AfterTime  *time.Time `json:"afterTime"`
+
+	// restrict to a page of results, zero limit for all
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
 }
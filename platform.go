@@ -1,6 +1,14 @@
 package payapi
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Platform struct {
 	ID   int    `json:"id"`
@@ -8,18 +16,195 @@ type Platform struct {
 
 	Active bool `json:"active"` // actively accepting payments?
 
-	Address    string `json:"address"`    // where users will send funds to (algo address)
-	WebhookUrl string `json:"webhookUrl"` // where we will call to notify upon payment success
+	Address       string `json:"address"`       // where users will send funds to (algo address)
+	WebhookUrl    string `json:"webhookUrl"`    // where we will call to notify upon payment success
+	WebhookSecret string `json:"webhookSecret"` // HMAC key used to sign webhook calls
+
+	// one of WebhookVersion*, platforms from before signed webhooks stay on the legacy call until they opt in
+	WebhookVersion int `json:"webhookVersion"`
+
+	// payment matching
+	PaymentExpiry      int    `json:"paymentExpiry"`      // seconds an unpaid payment stays open
+	MatchWindow        int    `json:"matchWindow"`        // seconds after creation the txn must confirm within
+	NoteFormat         string `json:"noteFormat"`         // txn note users must send, see PaymentNote
+	AmountToleranceBps int    `json:"amountToleranceBps"` // how far the amount sent may be off, in basis points of the amount
+}
+
+// placeholders a note format may use
+const (
+	NotePlaceholderExternalId = "{externalId}"
+	NotePlaceholderPaymentId  = "{paymentId}"
+)
+
+// how a platform's webhook url is called
+const (
+	// GET with {"externalId", "transactionId"} once a deposit completes, unsigned, nothing else is sent
+	// the contract platforms integrated against before webhook events
+	WebhookVersionLegacy = 1
+
+	// signed POST of every deposit and withdrawal event, see WebhookEvent* and SignWebhookPayload
+	WebhookVersionEvents = 2
+)
+
+// defaults for new platforms, matching how payments were always matched
+const (
+	DefaultPaymentExpiry  = 60 * 60
+	DefaultMatchWindow    = 60
+	DefaultNoteFormat     = NotePlaceholderExternalId
+	DefaultWebhookVersion = WebhookVersionEvents
+)
+
+func (p *Platform) ValidateSettings() error {
+	if p.MatchWindow <= 0 {
+		return errors.New("matchWindow must be > 0")
+	} else if p.PaymentExpiry < p.MatchWindow {
+		return errors.New("paymentExpiry cannot be less than matchWindow")
+	} else if p.AmountToleranceBps < 0 || p.AmountToleranceBps >= 10_000 {
+		return errors.New("amountToleranceBps must be between 0 and 9999")
+	} else if !strings.Contains(p.NoteFormat, NotePlaceholderExternalId) && !strings.Contains(p.NoteFormat, NotePlaceholderPaymentId) {
+		return errors.New("noteFormat must contain {externalId} or {paymentId}")
+	} else if p.WebhookVersion != WebhookVersionLegacy && p.WebhookVersion != WebhookVersionEvents {
+		return errors.New("invalid webhookVersion")
+	}
+
+	return nil
+}
+
+// note users must send with a payment, rendered from NoteFormat
+func (p *Platform) PaymentNote(payment *Payment) string {
+	return strings.NewReplacer(
+		NotePlaceholderExternalId, strconv.Itoa(payment.ExternalId),
+		NotePlaceholderPaymentId, strconv.Itoa(payment.ID),
+	).Replace(p.NoteFormat)
+}
+
+// is received close enough to expected, given AmountToleranceBps
+func (p *Platform) AmountWithinTolerance(expected, received uint64) bool {
+	diff := new(big.Int).Sub(new(big.Int).SetUint64(received), new(big.Int).SetUint64(expected))
+	diff.Abs(diff)
+
+	// diff * 10000 <= expected * bps
+	lhs := new(big.Int).Mul(diff, big.NewInt(10_000))
+	rhs := new(big.Int).Mul(new(big.Int).SetUint64(expected), big.NewInt(int64(p.AmountToleranceBps)))
+
+	return lhs.Cmp(rhs) <= 0
+}
+
+type (
+	// API key a platform authenticates with, only the hash is stored
+	PlatformApiKey struct {
+		ID         int        `json:"id"`
+		PlatformId int        `json:"platformId"`
+		Prefix     string     `json:"prefix"` // start of the key, to tell keys apart
+		CreatedAt  time.Time  `json:"createdAt"`
+		LastUsedAt *time.Time `json:"lastUsedAt"`
+		RevokedAt  *time.Time `json:"revokedAt"`
+
+		// full key, only ever set in the response to creating it
+		Key string `json:"key,omitempty"`
+	}
+
+	// fields that can be changed after creation, nil fields are left alone
+	PlatformUpdate struct {
+		Name       *string `json:"name"`
+		Active     *bool   `json:"active"`
+		Address    *string `json:"address"`
+		WebhookUrl *string `json:"webhookUrl"`
+
+		WebhookVersion *int `json:"webhookVersion"`
+
+		PaymentExpiry      *int    `json:"paymentExpiry"`
+		MatchWindow        *int    `json:"matchWindow"`
+		NoteFormat         *string `json:"noteFormat"`
+		AmountToleranceBps *int    `json:"amountToleranceBps"`
+	}
+
+	// asset a platform accepts deposits (and pays withdrawals) in
+	PlatformAsset struct {
+		PlatformId int    `json:"platformId"`
+		AssetId    uint64 `json:"assetId"` // algorand asset id, or zero for network token
+		Name       string `json:"name"`    // unit name shown to users, e.g. CHIPS
+		Decimals   int    `json:"decimals"`
+
+		MinAmount uint64  `json:"minAmount"` // in base units
+		MaxAmount *uint64 `json:"maxAmount"` // in base units, nil for no limit
+
+		// deposits over this are held for manual review, nil to never hold
+		ReviewThreshold *uint64 `json:"reviewThreshold"`
+
+		CreatedAt time.Time `json:"createdAt"`
+	}
+)
+
+func (a *PlatformAsset) Validate() error {
+	if a.PlatformId <= 0 {
+		return errors.New("platformId cannot be <= 0")
+	} else if a.Name == "" {
+		return errors.New("name cannot be empty")
+	} else if a.Decimals < 0 || a.Decimals > 19 {
+		return errors.New("decimals must be between 0 and 19")
+	} else if a.MaxAmount != nil && *a.MaxAmount < a.MinAmount {
+		return errors.New("maxAmount cannot be less than minAmount")
+	}
+
+	return nil
+}
+
+// does a deposit of amount need an admin to approve it
+func (a *PlatformAsset) RequiresReview(amount uint64) bool {
+	return a.ReviewThreshold != nil && amount > *a.ReviewThreshold
+}
+
+// checks amount is within the accepted range for this asset
+func (a *PlatformAsset) CheckAmount(amount uint64) error {
+	if amount < a.MinAmount {
+		return fmt.Errorf("amount below minimum of %d for asset %d", a.MinAmount, a.AssetId)
+	} else if a.MaxAmount != nil && amount > *a.MaxAmount {
+		return fmt.Errorf("amount above maximum of %d for asset %d", *a.MaxAmount, a.AssetId)
+	}
+
+	return nil
 }
 
 type PlatformService interface {
+	// Find all platforms
+	FindPlatforms(ctx context.Context) ([]*Platform, error)
+
 	// Find a payment by ID, returns object
 	FindPlatformByID(ctx context.Context, id int) (*Platform, error)
 
+	// Find the platform an (unrevoked) api key belongs to
+	FindPlatformByApiKey(ctx context.Context, key string) (*Platform, error)
+
 	// Create platform
 	// returns error on failure, platform parameter will be updated upon success
 	CreatePlatform(ctx context.Context, platform *Platform) error
 
-	// Notify platform via webhook url of deposit status
-	NotifyDeposit(ctx context.Context, status int, payment Payment) error
+	// Update platform, the address cannot change while payments are still open
+	// returns updated platform object upon success
+	UpdatePlatform(ctx context.Context, id int, upd PlatformUpdate) (*Platform, error)
+
+	// Generate a new webhook secret, the old one stops working immediately
+	RotateWebhookSecret(ctx context.Context, id int) (*Platform, error)
+
+	// api keys for platform
+	FindPlatformApiKeys(ctx context.Context, platformId int) ([]*PlatformApiKey, error)
+
+	// Create a new api key, the returned object is the only place the key is visible
+	CreatePlatformApiKey(ctx context.Context, platformId int) (*PlatformApiKey, error)
+
+	// Revoke api key, it can no longer be used
+	RevokePlatformApiKey(ctx context.Context, platformId, id int) error
+
+	// assets accepted by platform
+	FindPlatformAssets(ctx context.Context, platformId int) ([]*PlatformAsset, error)
+
+	// Find an accepted asset, errors if platform doesn't accept it
+	FindPlatformAsset(ctx context.Context, platformId int, assetId uint64) (*PlatformAsset, error)
+
+	// Add asset to allowlist, or update it if already there
+	SavePlatformAsset(ctx context.Context, asset *PlatformAsset) error
+
+	// Remove asset from allowlist, payments already created in it are left alone
+	DeletePlatformAsset(ctx context.Context, platformId int, assetId uint64) error
 }
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.ChainCursorService = (*ChainCursorService)(nil)
+
+type ChainCursorService struct {
+	db *pgxpool.Pool
+}
+
+func NewChainCursorService(db *pgxpool.Pool) *ChainCursorService {
+	return &ChainCursorService{
+		db: db,
+	}
+}
+
+func (s *ChainCursorService) FindChainCursor(ctx context.Context, name string) (*payapi.ChainCursor, error) {
+	c := &payapi.ChainCursor{
+		Name: name,
+	}
+
+	sql := `SELECT round, updated_at FROM chain_cursors WHERE name = $1 LIMIT 1`
+
+	err := s.db.QueryRow(ctx, sql, name).Scan(&c.Round, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (s *ChainCursorService) UpdateChainCursor(ctx context.Context, name string, round uint64) error {
+	sql := `
+		INSERT INTO chain_cursors (name, round, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (name) DO UPDATE
+		SET round = EXCLUDED.round, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.db.Exec(ctx, sql, name, round)
+	return err
+}
@@ -0,0 +1,42 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestChainCursorService_UpdateChainCursor(t *testing.T) {
+	// ensure a cursor is created on first save and moved on after
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewChainCursorService(db.DB)
+
+		// never saved
+		_, err := s.FindChainCursor(ctx, payapi.ChainCursorDeposits)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		for _, round := range []uint64{100, 101} {
+			err = s.UpdateChainCursor(ctx, payapi.ChainCursorDeposits, round)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := s.FindChainCursor(ctx, payapi.ChainCursorDeposits)
+			if err != nil {
+				t.Fatal(err)
+			} else if got, want := c.Round, round; got != want {
+				t.Fatalf("Round=%v, want %v", got, want)
+			}
+		}
+	})
+}
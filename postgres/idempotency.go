@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.IdempotencyService = (*IdempotencyService)(nil)
+
+// an in progress key older than this is assumed abandoned (crashed mid request) and can be claimed again
+const idempotencyLease = time.Minute
+
+type IdempotencyService struct {
+	db *pgxpool.Pool
+}
+
+func NewIdempotencyService(db *pgxpool.Pool) *IdempotencyService {
+	return &IdempotencyService{
+		db: db,
+	}
+}
+
+func (s *IdempotencyService) BeginIdempotentRequest(ctx context.Context, scope, key, requestHash string) (*payapi.IdempotentResponse, error) {
+	// claim the key, or reclaim it if the last claim was abandoned
+	sql := `
+		INSERT INTO idempotency_keys (scope, key, request_hash, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (scope, key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.completed_at IS NULL AND idempotency_keys.created_at < NOW() - make_interval(secs => $4)
+		RETURNING key
+	`
+
+	var claimed string
+
+	err := s.db.QueryRow(ctx, sql, scope, key, requestHash, idempotencyLease.Seconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// key is held, either finished or in progress
+	var (
+		hash       string
+		statusCode *int
+		body       []byte
+	)
+
+	err = s.db.QueryRow(ctx, `SELECT request_hash, status_code, response_body FROM idempotency_keys WHERE scope = $1 AND key = $2`, scope, key).Scan(&hash, &statusCode, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != requestHash {
+		return nil, payapi.ErrIdempotencyKeyMismatch
+	} else if statusCode == nil {
+		return nil, payapi.ErrIdempotencyKeyInProgress
+	}
+
+	return &payapi.IdempotentResponse{
+		StatusCode: *statusCode,
+		Body:       body,
+	}, nil
+}
+
+func (s *IdempotencyService) CompleteIdempotentRequest(ctx context.Context, scope, key string, res payapi.IdempotentResponse) error {
+	sql := `
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2, completed_at = NOW()
+		WHERE scope = $3 AND key = $4 AND completed_at IS NULL
+	`
+
+	_, err := s.db.Exec(ctx, sql, res.StatusCode, res.Body, scope, key)
+	return err
+}
+
+func (s *IdempotencyService) ReleaseIdempotentRequest(ctx context.Context, scope, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND completed_at IS NULL`, scope, key)
+	return err
+}
+
+func (s *IdempotencyService) DeleteIdempotencyKeys(ctx context.Context, before time.Time) (int, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
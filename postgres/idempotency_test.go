@@ -0,0 +1,101 @@
+package postgres_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestIdempotencyService_BeginIdempotentRequest(t *testing.T) {
+	// ensure a key is claimed once, and retries get the stored response
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewIdempotencyService(db.DB)
+
+		res, err := s.BeginIdempotentRequest(ctx, "platform:1", "KEY", "HASH")
+		if err != nil {
+			t.Fatal(err)
+		} else if res != nil {
+			t.Fatalf("res=%v, want nil", res)
+		}
+
+		// still being handled
+		_, err = s.BeginIdempotentRequest(ctx, "platform:1", "KEY", "HASH")
+		if err != payapi.ErrIdempotencyKeyInProgress {
+			t.Fatalf("err=%v, want %v", err, payapi.ErrIdempotencyKeyInProgress)
+		}
+
+		// same key in another scope is its own request
+		res, err = s.BeginIdempotentRequest(ctx, "platform:2", "KEY", "HASH")
+		if err != nil {
+			t.Fatal(err)
+		} else if res != nil {
+			t.Fatalf("res=%v, want nil", res)
+		}
+
+		err = s.CompleteIdempotentRequest(ctx, "platform:1", "KEY", payapi.IdempotentResponse{StatusCode: 201, Body: []byte(`{"id":1}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err = s.BeginIdempotentRequest(ctx, "platform:1", "KEY", "HASH")
+		if err != nil {
+			t.Fatal(err)
+		} else if res == nil {
+			t.Fatal("expected stored response")
+		} else if res.StatusCode != 201 {
+			t.Fatalf("StatusCode=%v, want %v", res.StatusCode, 201)
+		} else if !bytes.Equal(res.Body, []byte(`{"id":1}`)) {
+			t.Fatalf("Body=%s, want %s", res.Body, `{"id":1}`)
+		}
+
+		// key reused for a different request
+		_, err = s.BeginIdempotentRequest(ctx, "platform:1", "KEY", "OTHER")
+		if err != payapi.ErrIdempotencyKeyMismatch {
+			t.Fatalf("err=%v, want %v", err, payapi.ErrIdempotencyKeyMismatch)
+		}
+
+		n, err := s.DeleteIdempotencyKeys(ctx, time.Now().UTC().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 2 {
+			t.Fatalf("n=%v, want %v", n, 2)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewIdempotencyService(db.DB)
+
+		_, err := s.BeginIdempotentRequest(ctx, "public", "KEY", "HASH")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = s.ReleaseIdempotentRequest(ctx, "public", "KEY")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// can be claimed again, even for a different request
+		res, err := s.BeginIdempotentRequest(ctx, "public", "KEY", "OTHER")
+		if err != nil {
+			t.Fatal(err)
+		} else if res != nil {
+			t.Fatalf("res=%v, want nil", res)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+CREATE TABLE withdrawals (
+  id SERIAL PRIMARY KEY,
+  platform_id INT NOT NULL,
+  status INT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  approved_at TIMESTAMP WITH TIME ZONE,
+  signed_at TIMESTAMP WITH TIME ZONE,
+  broadcast_at TIMESTAMP WITH TIME ZONE,
+  confirmed_at TIMESTAMP WITH TIME ZONE,
+  failed_at TIMESTAMP WITH TIME ZONE,
+  sender VARCHAR(58), /* house account that paid out */
+  receiver VARCHAR(58) NOT NULL, /* algorand address */
+  asset_id BIGINT NOT NULL,
+  amount BIGINT NOT NULL,
+  transaction_id VARCHAR(52),
+  failure_reason TEXT,
+  external_id INT NOT NULL, /* platform withdrawal id, sent as the txn note */
+  CONSTRAINT fk_platform_id FOREIGN KEY (platform_id) REFERENCES platforms (id),
+  UNIQUE (transaction_id),
+  UNIQUE (platform_id, external_id)
+);
@@ -0,0 +1,31 @@
+ALTER TABLE platforms
+ADD COLUMN webhook_secret TEXT NOT NULL DEFAULT '';
+
+/* existing platforms get a secret, they can ignore the signature until they verify it */
+UPDATE platforms
+SET webhook_secret = md5(random()::TEXT) || md5(random()::TEXT)
+WHERE webhook_secret = '';
+
+CREATE TABLE webhook_deliveries (
+  id SERIAL PRIMARY KEY,
+  platform_id INT NOT NULL,
+  payment_id INT,
+  withdrawal_id INT,
+  event TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status INT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_attempt_at TIMESTAMP WITH TIME ZONE,
+  delivered_at TIMESTAMP WITH TIME ZONE,
+  last_status_code INT,
+  last_error TEXT,
+  CONSTRAINT fk_platform_id FOREIGN KEY (platform_id) REFERENCES platforms (id),
+  CONSTRAINT fk_payment_id FOREIGN KEY (payment_id) REFERENCES payments (id),
+  CONSTRAINT fk_withdrawal_id FOREIGN KEY (withdrawal_id) REFERENCES withdrawals (id)
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 0;
+CREATE INDEX webhook_deliveries_payment_id_idx ON webhook_deliveries (payment_id);
+CREATE INDEX webhook_deliveries_withdrawal_id_idx ON webhook_deliveries (withdrawal_id);
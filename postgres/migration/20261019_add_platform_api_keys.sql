@@ -0,0 +1,11 @@
+CREATE TABLE platform_api_keys (
+  id SERIAL PRIMARY KEY,
+  platform_id INT NOT NULL,
+  key_hash VARCHAR(64) NOT NULL, /* hex sha256 of the key, the key itself is never stored */
+  prefix VARCHAR(16) NOT NULL, /* start of the key so it can be recognised */
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  last_used_at TIMESTAMP WITH TIME ZONE,
+  revoked_at TIMESTAMP WITH TIME ZONE,
+  CONSTRAINT fk_platform_id FOREIGN KEY (platform_id) REFERENCES platforms (id),
+  UNIQUE (key_hash)
+);
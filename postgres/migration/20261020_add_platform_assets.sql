@@ -0,0 +1,19 @@
+CREATE TABLE platform_assets (
+  platform_id INT NOT NULL,
+  asset_id BIGINT NOT NULL, /* 0 for ALGO */
+  name TEXT NOT NULL,
+  decimals INT NOT NULL,
+  min_amount BIGINT NOT NULL DEFAULT 0, /* base units */
+  max_amount BIGINT, /* base units, NULL for no limit */
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  CONSTRAINT fk_platform_id FOREIGN KEY (platform_id) REFERENCES platforms (id),
+  PRIMARY KEY (platform_id, asset_id)
+);
+
+/* every existing platform only took CHIPS */
+INSERT INTO platform_assets (platform_id, asset_id, name, decimals, min_amount, created_at)
+SELECT id, 388592191, 'CHIPS', 1, 0, NOW() FROM platforms;
+
+/* ALGO and most ASA amounts (e.g. USDC) don't fit in INT */
+ALTER TABLE payments ALTER COLUMN asset_id TYPE BIGINT;
+ALTER TABLE payments ALTER COLUMN amount TYPE BIGINT;
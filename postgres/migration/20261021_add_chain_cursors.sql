@@ -0,0 +1,5 @@
+CREATE TABLE chain_cursors (
+  name TEXT PRIMARY KEY, /* which follower, e.g. deposits */
+  round BIGINT NOT NULL, /* last round fully processed */
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,25 @@
+ALTER TABLE platforms
+ADD COLUMN payment_expiry INT NOT NULL DEFAULT 3600, /* seconds */
+ADD COLUMN match_window INT NOT NULL DEFAULT 60, /* seconds */
+ADD COLUMN note_format TEXT NOT NULL DEFAULT '{externalId}',
+ADD COLUMN amount_tolerance_bps INT NOT NULL DEFAULT 0;
+
+ALTER TABLE payments
+ADD COLUMN expires_at TIMESTAMP,
+ADD COLUMN note TEXT,
+ADD COLUMN received_amount BIGINT;
+
+/* existing payments were matched on external id, within the hour the worker looked back */
+UPDATE payments
+SET expires_at = created_at + INTERVAL '1 hour', note = external_id::TEXT;
+
+/* anything already paid was paid in full */
+UPDATE payments
+SET received_amount = amount
+WHERE status = 2;
+
+ALTER TABLE payments
+ALTER COLUMN expires_at SET NOT NULL,
+ALTER COLUMN note SET NOT NULL;
+
+CREATE INDEX payments_open_expires_at_idx ON payments (expires_at) WHERE status = 0;
@@ -0,0 +1,15 @@
+ALTER TABLE payments
+ADD COLUMN matched_transaction_id VARCHAR(52), /* txid held for review, moves to transaction_id once approved */
+ADD COLUMN reviewed_at TIMESTAMP,
+ADD COLUMN review_note TEXT;
+
+/* payments over this are held for review instead of completing, NULL never holds */
+ALTER TABLE platform_assets
+ADD COLUMN review_threshold BIGINT;
+
+/* previously hard-coded 50,000 CHIPS */
+UPDATE platform_assets
+SET review_threshold = 500000
+WHERE asset_id = 388592191;
+
+CREATE INDEX payments_pending_review_idx ON payments (created_at) WHERE status = 4;
@@ -0,0 +1,21 @@
+CREATE TABLE orphan_deposits (
+  id SERIAL PRIMARY KEY,
+  platform_id INT NOT NULL,
+  status INT NOT NULL,
+  detected_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  resolved_at TIMESTAMP WITH TIME ZONE,
+  transaction_id VARCHAR(52) NOT NULL,
+  round BIGINT NOT NULL,
+  round_time TIMESTAMP WITH TIME ZONE NOT NULL,
+  sender VARCHAR(58) NOT NULL, /* algorand address */
+  asset_id BIGINT NOT NULL, /* 0 for ALGO */
+  amount BIGINT NOT NULL,
+  note BYTEA,
+  payment_id INT, /* set once linked */
+  resolution_note TEXT,
+  CONSTRAINT fk_platform_id FOREIGN KEY (platform_id) REFERENCES platforms (id),
+  CONSTRAINT fk_payment_id FOREIGN KEY (payment_id) REFERENCES payments (id),
+  UNIQUE (transaction_id)
+);
+
+CREATE INDEX orphan_deposits_open_idx ON orphan_deposits (platform_id) WHERE status = 0;
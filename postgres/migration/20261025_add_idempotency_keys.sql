@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys (
+  scope TEXT NOT NULL, /* who used the key, e.g. platform:1 */
+  key TEXT NOT NULL,
+  request_hash VARCHAR(64) NOT NULL, /* hex sha256 of method, path and body */
+  status_code INT, /* NULL while the request is in progress */
+  response_body BYTEA,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  completed_at TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
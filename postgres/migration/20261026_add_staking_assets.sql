@@ -0,0 +1,55 @@
+CREATE TABLE staking_assets (
+  id SERIAL PRIMARY KEY,
+  asset_id BIGINT NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  pool_address VARCHAR(58),
+  decimals INT NOT NULL,
+  weight NUMERIC NOT NULL DEFAULT 1,
+  price_source VARCHAR(20) NOT NULL,
+  auto_stake BOOLEAN NOT NULL DEFAULT FALSE,
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  UNIQUE (asset_id)
+);
+
+/* everything that had its own commitment column, in the order it was checked */
+INSERT INTO staking_assets (asset_id, name, decimals, weight, price_source, auto_stake, created_at) VALUES
+  (388592191, 'CHIPS', 1, 1, 'fixed', FALSE, NOW()),
+  (552665159, 'TinymanPool1.1 chip-ALGO', 6, 1, 'chip_ratio', TRUE, NOW()),
+  (1002609713, 'TinymanPool2.0 chip-ALGO', 6, 1, 'chip_ratio', TRUE, NOW()),
+  (2562903034, 'cALGO/chip', 6, 1, 'chip_ratio', TRUE, NOW()),
+  (2545480441, 'tALGO/chip', 6, 1, 'chip_ratio', TRUE, NOW()),
+  (2536627349, 'mALGO/chip', 6, 1, 'chip_ratio', TRUE, NOW()),
+  (2520645026, 'xALGO/chip', 6, 1, 'chip_ratio', TRUE, NOW());
+
+CREATE TABLE staking_commitment_items (
+  staking_commitment_id INT NOT NULL,
+  asset_id BIGINT NOT NULL,
+  amount NUMERIC NOT NULL,
+  CONSTRAINT fk_staking_commitment_id FOREIGN KEY (staking_commitment_id) REFERENCES staking_commitments (id) ON DELETE CASCADE,
+  CONSTRAINT fk_asset_id FOREIGN KEY (asset_id) REFERENCES staking_assets (asset_id),
+  PRIMARY KEY (staking_commitment_id, asset_id)
+);
+
+INSERT INTO staking_commitment_items (staking_commitment_id, asset_id, amount)
+SELECT c.id, v.asset_id, v.amount
+FROM staking_commitments c
+CROSS JOIN LATERAL (VALUES
+  (388592191, c.chip_commitment),
+  (552665159, c.liquidity_commitment),
+  (1002609713, COALESCE(c.liquidity_commitment_v2, 0)),
+  (2562903034, c.c_algo_commitment),
+  (2545480441, c.t_algo_commitment),
+  (2536627349, c.m_algo_commitment),
+  (2520645026, c.x_algo_commitment)
+) AS v (asset_id, amount)
+WHERE v.amount > 0;
+
+ALTER TABLE staking_commitments
+DROP COLUMN chip_commitment,
+DROP COLUMN liquidity_commitment,
+DROP COLUMN liquidity_commitment_v2,
+DROP COLUMN c_algo_commitment,
+DROP COLUMN t_algo_commitment,
+DROP COLUMN m_algo_commitment,
+DROP COLUMN x_algo_commitment;
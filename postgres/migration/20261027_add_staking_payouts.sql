@@ -0,0 +1,23 @@
+CREATE TABLE staking_payouts (
+  id SERIAL PRIMARY KEY,
+  staking_period_id INT NOT NULL,
+  staking_result_id INT NOT NULL,
+  address VARCHAR(58) NOT NULL,
+  asset_id BIGINT NOT NULL,
+  amount NUMERIC NOT NULL,
+  status INT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  group_id VARCHAR(44),
+  transaction_id VARCHAR(52),
+  last_valid_round BIGINT,
+  failure_reason TEXT,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  sent_at TIMESTAMP WITH TIME ZONE,
+  confirmed_at TIMESTAMP WITH TIME ZONE,
+  failed_at TIMESTAMP WITH TIME ZONE,
+  CONSTRAINT fk_staking_period_id FOREIGN KEY (staking_period_id) REFERENCES staking_periods (id),
+  CONSTRAINT fk_staking_result_id FOREIGN KEY (staking_result_id) REFERENCES staking_results (id),
+  UNIQUE (staking_result_id, address)
+);
+
+CREATE INDEX staking_payouts_status_idx ON staking_payouts (staking_period_id, status);
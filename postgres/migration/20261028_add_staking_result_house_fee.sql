@@ -0,0 +1,3 @@
+/* rewards are whole base units now, what isn't paid out is accounted for here */
+ALTER TABLE staking_results ADD COLUMN house_fee NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE staking_results ADD COLUMN unallocated NUMERIC NOT NULL DEFAULT 0;
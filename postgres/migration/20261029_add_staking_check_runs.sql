@@ -0,0 +1,21 @@
+CREATE TABLE staking_check_runs (
+  id SERIAL PRIMARY KEY,
+  staking_period_id INT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  CONSTRAINT fk_staking_period_id FOREIGN KEY (staking_period_id) REFERENCES staking_periods (id)
+);
+
+CREATE INDEX staking_check_runs_period_idx ON staking_check_runs (staking_period_id, created_at);
+
+/* balance of every committed asset of every commitment, zero when none was held */
+CREATE TABLE staking_holding_snapshots (
+  staking_check_run_id INT NOT NULL,
+  address VARCHAR(58) NOT NULL,
+  asset_id BIGINT NOT NULL,
+  amount NUMERIC NOT NULL,
+  CONSTRAINT fk_staking_check_run_id FOREIGN KEY (staking_check_run_id) REFERENCES staking_check_runs (id) ON DELETE CASCADE,
+  PRIMARY KEY (staking_check_run_id, address, asset_id)
+);
+
+/* how committed amounts were credited */
+ALTER TABLE staking_results ADD COLUMN weighting VARCHAR(20) NOT NULL DEFAULT 'commitment';
@@ -0,0 +1,2 @@
+/* set when an admin settles the period, everything else about its status follows from the timestamps */
+ALTER TABLE staking_periods ADD COLUMN closed_at TIMESTAMP WITH TIME ZONE;
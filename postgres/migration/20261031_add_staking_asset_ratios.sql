@@ -0,0 +1,21 @@
+/* chip ratio of each pooled asset, from its pool's reserves at period creation and every check run */
+CREATE TABLE staking_asset_ratios (
+  id SERIAL PRIMARY KEY,
+  staking_period_id INT NOT NULL,
+  staking_check_run_id INT,
+  asset_id BIGINT NOT NULL,
+  ratio NUMERIC NOT NULL,
+  pool_address VARCHAR(58) NOT NULL,
+  round BIGINT NOT NULL,
+  chip_reserve NUMERIC NOT NULL,
+  liquidity_issued NUMERIC NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  CONSTRAINT fk_staking_period_id FOREIGN KEY (staking_period_id) REFERENCES staking_periods (id),
+  CONSTRAINT fk_staking_check_run_id FOREIGN KEY (staking_check_run_id) REFERENCES staking_check_runs (id) ON DELETE CASCADE,
+  CONSTRAINT fk_asset_id FOREIGN KEY (asset_id) REFERENCES staking_assets (asset_id)
+);
+
+CREATE INDEX staking_asset_ratios_period_idx ON staking_asset_ratios (staking_period_id, asset_id);
+
+/* ratio each asset was valued at, null when the period's chip ratio was used for everything */
+ALTER TABLE staking_results ADD COLUMN asset_ratios JSONB;
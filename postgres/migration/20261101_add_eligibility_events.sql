@@ -0,0 +1,17 @@
+/* every change to a commitment's eligibility and why */
+CREATE TABLE eligibility_events (
+  id SERIAL PRIMARY KEY,
+  staking_commitment_id INT NOT NULL,
+  eligible BOOLEAN NOT NULL,
+  source VARCHAR(20) NOT NULL,
+  reason TEXT NOT NULL,
+  staking_check_run_id INT,
+  asset_id BIGINT,
+  committed NUMERIC,
+  balance NUMERIC,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  CONSTRAINT fk_staking_commitment_id FOREIGN KEY (staking_commitment_id) REFERENCES staking_commitments (id) ON DELETE CASCADE,
+  CONSTRAINT fk_staking_check_run_id FOREIGN KEY (staking_check_run_id) REFERENCES staking_check_runs (id)
+);
+
+CREATE INDEX eligibility_events_commitment_idx ON eligibility_events (staking_commitment_id, created_at);
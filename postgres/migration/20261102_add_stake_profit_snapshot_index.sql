@@ -0,0 +1,2 @@
+/* profit history is read by period in time order */
+CREATE INDEX stake_profit_snapshots_period_idx ON stake_profit_snapshots (staking_period_id, created_at);
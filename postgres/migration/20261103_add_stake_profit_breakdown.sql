@@ -0,0 +1,5 @@
+/* casino revenue by game type, currency and day behind each snapshot */
+ALTER TABLE stake_profit_snapshots ADD COLUMN breakdown JSONB;
+
+/* game types funding a period's rewards, null for every game */
+ALTER TABLE staking_periods ADD COLUMN funding_games TEXT[];
@@ -0,0 +1,2 @@
+/* saved with the txid when signed, a signed withdrawal missing on chain after this round never landed */
+ALTER TABLE withdrawals ADD COLUMN last_valid_round BIGINT;
@@ -0,0 +1,5 @@
+/* platforms already integrated keep the legacy GET call, new ones are created on signed events */
+ALTER TABLE platforms ADD COLUMN webhook_version INT NOT NULL DEFAULT 1;
+
+/* how each delivery is sent, fixed when queued */
+ALTER TABLE webhook_deliveries ADD COLUMN webhook_version INT NOT NULL DEFAULT 2;
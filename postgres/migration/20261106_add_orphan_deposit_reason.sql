@@ -0,0 +1,2 @@
+/* why the transfer can't be matched to a payment, e.g. an asset the platform doesn't accept */
+ALTER TABLE orphan_deposits ADD COLUMN reason TEXT;
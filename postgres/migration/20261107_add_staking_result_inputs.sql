@@ -0,0 +1,4 @@
+/* what a result was worked out with, exports of it stay the same when its period or commitments change later */
+ALTER TABLE staking_results ADD COLUMN policy JSONB;
+ALTER TABLE staking_results ADD COLUMN funding_games TEXT[];
+ALTER TABLE staking_results ADD COLUMN inputs JSONB;
@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.OrphanDepositService = (*OrphanDepositService)(nil)
+
+// every query returning a full orphan deposit selects these, in this order
+const orphanDepositColumns = `
+	id, platform_id, status, detected_at, resolved_at,
+	transaction_id, round, round_time, sender, asset_id, amount, note, reason,
+	payment_id, resolution_note
+`
+
+type OrphanDepositService struct {
+	db *pgxpool.Pool
+}
+
+func NewOrphanDepositService(db *pgxpool.Pool) *OrphanDepositService {
+	return &OrphanDepositService{
+		db: db,
+	}
+}
+
+func scanOrphanDeposit(row pgx.Row) (*payapi.OrphanDeposit, error) {
+	d := &payapi.OrphanDeposit{}
+
+	err := row.Scan(
+		&d.ID,
+		&d.PlatformId,
+		&d.Status,
+		&d.DetectedAt,
+		&d.ResolvedAt,
+		&d.TransactionID,
+		&d.Round,
+		&d.RoundTime,
+		&d.Sender,
+		&d.AssetId,
+		&d.Amount,
+		&d.Note,
+		&d.Reason,
+		&d.PaymentId,
+		&d.ResolutionNote,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (s *OrphanDepositService) FindOrphanDeposits(ctx context.Context, filter payapi.OrphanDepositFilter) ([]*payapi.OrphanDeposit, error) {
+	sql := `SELECT ` + orphanDepositColumns + `
+		FROM orphan_deposits
+		WHERE ($1::INT IS NULL OR platform_id = $1) AND ($2::INT IS NULL OR status = $2)
+		ORDER BY round_time DESC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.PlatformId, filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deposits := make([]*payapi.OrphanDeposit, 0)
+
+	for rows.Next() {
+		d, err := scanOrphanDeposit(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deposits = append(deposits, d)
+	}
+
+	return deposits, rows.Err()
+}
+
+func (s *OrphanDepositService) FindOrphanDepositByID(ctx context.Context, id int) (*payapi.OrphanDeposit, error) {
+	sql := `SELECT ` + orphanDepositColumns + ` FROM orphan_deposits WHERE id = $1 LIMIT 1`
+
+	d, err := scanOrphanDeposit(s.db.QueryRow(ctx, sql, id))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (s *OrphanDepositService) RecordOrphanDeposit(ctx context.Context, deposit *payapi.OrphanDeposit) (bool, error) {
+	// skipped if a payment was completed (or is held for review) with this txid
+	sql := `
+		INSERT INTO orphan_deposits (platform_id, status, detected_at, transaction_id, round, round_time, sender, asset_id, amount, note, reason)
+		SELECT $1, $2, NOW(), $3, $4, $5, $6, $7, $8, $9, $10
+		WHERE NOT EXISTS (
+			SELECT 1 FROM payments WHERE transaction_id = $3 OR matched_transaction_id = $3
+		)
+		ON CONFLICT (transaction_id) DO NOTHING
+		RETURNING id, detected_at
+	`
+
+	err := s.db.QueryRow(
+		ctx,
+		sql,
+		deposit.PlatformId,
+		payapi.OrphanDepositStatusOpen,
+		deposit.TransactionID,
+		deposit.Round,
+		deposit.RoundTime,
+		deposit.Sender,
+		deposit.AssetId,
+		deposit.Amount,
+		deposit.Note,
+		deposit.Reason,
+	).Scan(
+		&deposit.ID,
+		&deposit.DetectedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// already matched or recorded
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	deposit.Status = payapi.OrphanDepositStatusOpen
+
+	return true, nil
+}
+
+func (s *OrphanDepositService) LinkOrphanDeposit(ctx context.Context, id, paymentId int, note string) (*payapi.OrphanDeposit, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := scanOrphanDeposit(tx.QueryRow(ctx, `SELECT `+orphanDepositColumns+` FROM orphan_deposits WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, errors.New("orphan deposit not found")
+	} else if d.Status != payapi.OrphanDepositStatusOpen {
+		return nil, errors.New("orphan deposit already resolved")
+	}
+
+	// late payments will have expired, they can still be credited
+	sql := `
+		UPDATE payments
+		SET status = $1, transaction_id = $2, received_amount = $3, completed_at = NOW()
+		WHERE id = $4 AND platform_id = $5 AND asset_id = $6 AND status = ANY($7)
+		RETURNING ` + paymentColumns
+
+	payment, err := scanPayment(tx.QueryRow(
+		ctx,
+		sql,
+		payapi.StatusCompleted,
+		d.TransactionID,
+		d.Amount,
+		paymentId,
+		d.PlatformId,
+		d.AssetId,
+		[]int{payapi.StatusCreated, payapi.StatusExpired},
+	))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("payment must be open or expired, for the same platform and asset")
+	}
+
+	sql = `
+		UPDATE orphan_deposits
+		SET status = $1, payment_id = $2, resolution_note = $3, resolved_at = NOW()
+		WHERE id = $4
+		RETURNING ` + orphanDepositColumns
+
+	d, err = scanOrphanDeposit(tx.QueryRow(ctx, sql, payapi.OrphanDepositStatusLinked, payment.ID, note, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// call hook endpoint, if any
+	err = enqueueDepositWebhook(ctx, tx, payapi.StatusCompleted, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, tx.Commit(ctx)
+}
+
+func (s *OrphanDepositService) DismissOrphanDeposit(ctx context.Context, id int, note string) (*payapi.OrphanDeposit, error) {
+	sql := `
+		UPDATE orphan_deposits
+		SET status = $1, resolution_note = $2, resolved_at = NOW()
+		WHERE id = $3 AND status = $4
+		RETURNING ` + orphanDepositColumns
+
+	d, err := scanOrphanDeposit(s.db.QueryRow(ctx, sql, payapi.OrphanDepositStatusDismissed, note, id, payapi.OrphanDepositStatusOpen))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("orphan deposit not found or already resolved")
+	}
+
+	return d, nil
+}
@@ -0,0 +1,145 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestOrphanDepositService_LinkOrphanDeposit(t *testing.T) {
+	// ensure an orphan is only recorded once and linking completes the payment
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paymentService := postgres.NewPaymentService(db.DB)
+		paymentService.PlatformService = platformService
+
+		payment := &payapi.Payment{PlatformId: platform.ID, Sender: "BBBB", AssetId: 1337, Amount: 69, ExternalId: 420}
+
+		err = paymentService.CreatePayment(ctx, payment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewOrphanDepositService(db.DB)
+
+		deposit := &payapi.OrphanDeposit{
+			PlatformId:    platform.ID,
+			TransactionID: "TXID",
+			Round:         1,
+			RoundTime:     time.Now().UTC(),
+			Sender:        "BBBB",
+			AssetId:       1337,
+			Amount:        69,
+			Note:          []byte("wrong note"),
+		}
+
+		recorded, err := s.RecordOrphanDeposit(ctx, deposit)
+		if err != nil {
+			t.Fatal(err)
+		} else if !recorded {
+			t.Fatal("expected orphan to be recorded")
+		}
+
+		// second run sees the same transfer
+		recorded, err = s.RecordOrphanDeposit(ctx, &payapi.OrphanDeposit{PlatformId: platform.ID, TransactionID: "TXID", RoundTime: time.Now().UTC(), Sender: "BBBB", AssetId: 1337, Amount: 69})
+		if err != nil {
+			t.Fatal(err)
+		} else if recorded {
+			t.Fatal("expected orphan to be skipped")
+		}
+
+		linked, err := s.LinkOrphanDeposit(ctx, deposit.ID, payment.ID, "user used wrong note")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := linked.Status, payapi.OrphanDepositStatusLinked; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		}
+
+		fetched, err := paymentService.FindPaymentByID(ctx, payment.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := fetched.Status, payapi.StatusCompleted; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		}
+
+		// already resolved
+		_, err = s.DismissOrphanDeposit(ctx, deposit.ID, "")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// txid now belongs to a payment, never recorded again
+		recorded, err = s.RecordOrphanDeposit(ctx, &payapi.OrphanDeposit{PlatformId: platform.ID, TransactionID: "TXID", RoundTime: time.Now().UTC(), Sender: "BBBB", AssetId: 1337, Amount: 69})
+		if err != nil {
+			t.Fatal(err)
+		} else if recorded {
+			t.Fatal("expected orphan to be skipped")
+		}
+	})
+	t.Run("Reason", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		err := postgres.NewPlatformService(db.DB).CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		s := postgres.NewOrphanDepositService(db.DB)
+
+		// asset the platform doesn't accept
+		reason := "asset 42 is not accepted by the platform"
+		deposit := &payapi.OrphanDeposit{PlatformId: platform.ID, TransactionID: "TXID", RoundTime: time.Now().UTC(), Sender: "BBBB", AssetId: 42, Amount: 69, Reason: &reason}
+
+		recorded, err := s.RecordOrphanDeposit(ctx, deposit)
+		if err != nil {
+			t.Fatal(err)
+		} else if !recorded {
+			t.Fatal("expected orphan to be recorded")
+		}
+
+		fetched, err := s.FindOrphanDepositByID(ctx, deposit.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if fetched.Reason == nil || *fetched.Reason != reason {
+			t.Fatalf("Reason=%v, want %v", fetched.Reason, reason)
+		}
+	})
+}
@@ -4,17 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
-	"time"
 
 	"github.com/algo-casino/payapi"
 	"github.com/algo-casino/payapi/algo"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var _ payapi.PaymentService = (*PaymentService)(nil)
 
+// every query returning a full payment selects these, in this order
+const paymentColumns = `
+	id, platform_id, status, created_at, cancelled_at, completed_at, expires_at,
+	sender, asset_id, amount, note, transaction_id, received_amount, external_id,
+	matched_transaction_id, reviewed_at, review_note
+`
+
+// matches payapi.PaymentFilter, nil fields are ignored
+const paymentFilterWhere = `
+	WHERE ($1::INT IS NULL OR platform_id = $1)
+		AND ($2::INT IS NULL OR status = $2)
+		AND ($3::TEXT IS NULL OR sender = $3)
+		AND ($4::INT IS NULL OR external_id = $4)
+		AND ($5::TIMESTAMP IS NULL OR created_at >= $5)
+		AND ($6::TIMESTAMP IS NULL OR created_at <= $6)
+`
+
 type PaymentService struct {
 	db              *pgxpool.Pool
 	PlatformService payapi.PlatformService
@@ -28,31 +44,39 @@ func NewPaymentService(db *pgxpool.Pool) *PaymentService {
 	}
 }
 
-func (s *PaymentService) FindPaymentByID(ctx context.Context, id int) (*payapi.Payment, error) {
-	p := &payapi.Payment{
-		ID: id,
-	}
-
-	sql := `
-		SELECT platform_id, status, created_at, cancelled_at, completed_at, sender, asset_id, amount, transaction_id, external_id
-		FROM payments
-		WHERE id = $1
-		LIMIT 1
-	`
+func scanPayment(row pgx.Row) (*payapi.Payment, error) {
+	p := &payapi.Payment{}
 
-	err := s.db.QueryRow(ctx, sql, id).Scan(
+	err := row.Scan(
+		&p.ID,
 		&p.PlatformId,
 		&p.Status,
 		&p.CreatedAt,
 		&p.CancelledAt,
 		&p.CompletedAt,
+		&p.ExpiresAt,
 		&p.Sender,
 		&p.AssetId,
 		&p.Amount,
+		&p.Note,
 		&p.TransactionID,
+		&p.ReceivedAmount,
 		&p.ExternalId,
+		&p.MatchedTransactionID,
+		&p.ReviewedAt,
+		&p.ReviewNote,
 	)
+	if err != nil {
+		return nil, err
+	}
 
+	return p, nil
+}
+
+func (s *PaymentService) FindPaymentByID(ctx context.Context, id int) (*payapi.Payment, error) {
+	sql := `SELECT ` + paymentColumns + ` FROM payments WHERE id = $1 LIMIT 1`
+
+	p, err := scanPayment(s.db.QueryRow(ctx, sql, id))
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
 		return nil, err
@@ -61,41 +85,76 @@ func (s *PaymentService) FindPaymentByID(ctx context.Context, id int) (*payapi.P
 	return p, nil
 }
 
-func (s *PaymentService) FindPayments(ctx context.Context, filter payapi.PaymentFilter) ([]*payapi.Payment, error) {
-	if filter.PlatformId == nil || filter.Status == nil || filter.AfterTime == nil || filter.BeforeTime == nil {
-		return nil, errors.New("invalid parameters")
+func (s *PaymentService) FindPayments(ctx context.Context, filter payapi.PaymentFilter) ([]*payapi.Payment, int, error) {
+	// NULL limit returns everything
+	var limit *int
+	if filter.Limit > 0 {
+		limit = &filter.Limit
 	}
 
 	sql := `
-			SELECT id, transaction_id, created_at, completed_at, cancelled_at, sender, asset_id, amount, external_id
-			FROM payments
-			WHERE platform_id = $1 AND status = $2 AND external_id IS NOT NULL AND created_at >= $3 AND created_at <= $4
-			ORDER BY created_at DESC
-		`
+		SELECT ` + paymentColumns + `, COUNT(*) OVER()
+		FROM payments
+		` + paymentFilterWhere + `
+		ORDER BY created_at DESC, id DESC
+		OFFSET $7
+		LIMIT $8
+	`
+
+	args := []interface{}{filter.PlatformId, filter.Status, filter.Sender, filter.ExternalId, filter.AfterTime, filter.BeforeTime}
 
-	rows, err := s.db.Query(context.TODO(), sql, *filter.PlatformId, *filter.Status, *filter.AfterTime, *filter.BeforeTime)
+	rows, err := s.db.Query(ctx, sql, append(args, filter.Offset, limit)...)
 	if err != nil {
-		panic(err)
+		return nil, 0, err
 	}
 	defer rows.Close()
 
 	payments := make([]*payapi.Payment, 0)
+	n := 0
 
 	for rows.Next() {
 		var p payapi.Payment
 
-		err := rows.Scan(&p.ID, &p.TransactionID, &p.CreatedAt, &p.CompletedAt, &p.CancelledAt, &p.Sender, &p.AssetId, &p.Amount, &p.ExternalId)
+		err := rows.Scan(
+			&p.ID,
+			&p.PlatformId,
+			&p.Status,
+			&p.CreatedAt,
+			&p.CancelledAt,
+			&p.CompletedAt,
+			&p.ExpiresAt,
+			&p.Sender,
+			&p.AssetId,
+			&p.Amount,
+			&p.Note,
+			&p.TransactionID,
+			&p.ReceivedAmount,
+			&p.ExternalId,
+			&p.MatchedTransactionID,
+			&p.ReviewedAt,
+			&p.ReviewNote,
+			&n,
+		)
 		if err != nil {
-			panic(err)
+			return nil, 0, err
 		}
 
-		p.PlatformId = *filter.PlatformId
-		p.Status = *filter.Status
-
 		payments = append(payments, &p)
 	}
 
-	return payments, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// offset past the end, still report how many there are
+	if len(payments) == 0 && filter.Offset > 0 {
+		err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM payments `+paymentFilterWhere, args...).Scan(&n)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return payments, n, nil
 }
 
 func (s *PaymentService) CreatePayment(ctx context.Context, payment *payapi.Payment) error {
@@ -105,17 +164,41 @@ func (s *PaymentService) CreatePayment(ctx context.Context, payment *payapi.Paym
 		return err
 	}
 
+	// platform must accept the asset, in the given amount
+	asset, err := s.PlatformService.FindPlatformAsset(ctx, payment.PlatformId, payment.AssetId)
+	if err != nil {
+		return err
+	}
+
+	err = asset.CheckAmount(payment.Amount)
+	if err != nil {
+		return err
+	}
+
+	platform, err := s.PlatformService.FindPlatformByID(ctx, payment.PlatformId)
+	if err != nil {
+		return errors.New("failed to find platform")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// expiry is fixed at creation, later changes to the platform don't move it
 	sql := `
-		INSERT INTO payments (platform_id, status, created_at, sender, asset_id, amount, external_id)
-		VALUES ($1, $2, NOW(), $3, $4, $5, $6)
-		RETURNING id, created_at
+		INSERT INTO payments (platform_id, status, created_at, expires_at, sender, asset_id, amount, note, external_id)
+		VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3), $4, $5, $6, '', $7)
+		RETURNING id, created_at, expires_at
 	`
 
-	err = s.db.QueryRow(
+	err = tx.QueryRow(
 		ctx,
 		sql,
 		payment.PlatformId,
 		payapi.StatusCreated,
+		platform.PaymentExpiry,
 		payment.Sender,
 		payment.AssetId,
 		payment.Amount,
@@ -123,23 +206,35 @@ func (s *PaymentService) CreatePayment(ctx context.Context, payment *payapi.Paym
 	).Scan(
 		&payment.ID,
 		&payment.CreatedAt,
+		&payment.ExpiresAt,
 	)
+	if isUniqueViolation(err) {
+		return payapi.ErrPaymentExists
+	} else if err != nil {
+		return err
+	}
+
+	// note may contain the payment id, so only known once inserted
+	payment.Note = platform.PaymentNote(payment)
 
+	_, err = tx.Exec(ctx, `UPDATE payments SET note = $1 WHERE id = $2`, payment.Note, payment.ID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func (s *PaymentService) CancelPayment(ctx context.Context, id int) (*payapi.Payment, error) {
 	payment, err := s.FindPaymentByID(ctx, int(id))
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return nil, payapi.ErrPaymentNotFound
 	}
 
 	if payment.TransactionID != nil || payment.CompletedAt != nil {
-		return nil, errors.New("payment already completed")
+		return nil, payapi.ErrPaymentAlreadyCompleted
+	} else if payment.Status != payapi.StatusCreated {
+		return nil, payapi.ErrPaymentNotOpen
 	}
 
 	platform, err := s.PlatformService.FindPlatformByID(ctx, payment.PlatformId)
@@ -152,15 +247,25 @@ func (s *PaymentService) CancelPayment(ctx context.Context, id int) (*payapi.Pay
 		return nil, errors.New("platform is not currently active")
 	}
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// only open payments, it may have been completed since it was read
 	sql := `
 		UPDATE payments
 		SET status = $1, cancelled_at = NOW()
-		WHERE id = $2
+		WHERE id = $2 AND status = $3
 		RETURNING cancelled_at
 	`
 
-	err = s.db.QueryRow(ctx, sql, payapi.StatusCancelled, payment.ID).Scan(&payment.CancelledAt)
-	if err != nil {
+	err = tx.QueryRow(ctx, sql, payapi.StatusCancelled, payment.ID, payapi.StatusCreated).Scan(&payment.CancelledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// completed (or expired) since it was read
+		return nil, s.notOpenError(ctx, payment.ID)
+	} else if err != nil {
 		fmt.Printf("err: %v\n", err)
 		return nil, errors.New("failed to update")
 	}
@@ -168,43 +273,194 @@ func (s *PaymentService) CancelPayment(ctx context.Context, id int) (*payapi.Pay
 	payment.Status = payapi.StatusCancelled
 
 	// call hook endpoint, if any
-	s.PlatformService.NotifyDeposit(ctx, payapi.StatusCancelled, *payment)
+	err = enqueueDepositWebhook(ctx, tx, payapi.StatusCancelled, payment)
+	if err != nil {
+		return nil, err
+	}
 
-	return payment, nil
+	return payment, tx.Commit(ctx)
+}
+
+func (s *PaymentService) HoldPaymentForReview(ctx context.Context, id int, txid string, receivedAmount uint64) (*payapi.Payment, error) {
+	sql := `
+		UPDATE payments
+		SET status = $1, matched_transaction_id = $2, received_amount = $3
+		WHERE id = $4 AND status = $5
+		RETURNING ` + paymentColumns
+
+	p, err := scanPayment(s.db.QueryRow(ctx, sql, payapi.StatusPendingReview, txid, receivedAmount, id, payapi.StatusCreated))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("payment is not open")
+	}
+
+	return p, nil
 }
 
-func (s *PaymentService) completePayment(ctx context.Context, payment *payapi.Payment, txid string) error {
+func (s *PaymentService) ApprovePayment(ctx context.Context, id int, note string) (*payapi.Payment, error) {
+	// the held txid becomes the payment txid
 	sql := `
 		UPDATE payments
-		SET status = $1, transaction_id = $2, completed_at = NOW()
-		WHERE id = $3 AND status = 0
+		SET status = $1, transaction_id = matched_transaction_id, completed_at = NOW(), reviewed_at = NOW(), review_note = $2
+		WHERE id = $3 AND status = $4 AND matched_transaction_id IS NOT NULL
+		RETURNING ` + paymentColumns
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	payment, err := scanPayment(tx.QueryRow(ctx, sql, payapi.StatusCompleted, note, id, payapi.StatusPendingReview))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("payment is not pending review")
+	}
+
+	// call hook endpoint, if any
+	err = enqueueDepositWebhook(ctx, tx, payapi.StatusCompleted, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, tx.Commit(ctx)
+}
+
+func (s *PaymentService) RejectPayment(ctx context.Context, id int, note string) (*payapi.Payment, error) {
+	sql := `
+		UPDATE payments
+		SET status = $1, cancelled_at = NOW(), reviewed_at = NOW(), review_note = $2
+		WHERE id = $3 AND status = $4
+		RETURNING ` + paymentColumns
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	payment, err := scanPayment(tx.QueryRow(ctx, sql, payapi.StatusCancelled, note, id, payapi.StatusPendingReview))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("payment is not pending review")
+	}
+
+	// call hook endpoint, if any
+	err = enqueueDepositWebhook(ctx, tx, payapi.StatusCancelled, payment)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, tx.Commit(ctx)
+}
+
+func (s *PaymentService) ExpirePayments(ctx context.Context) ([]*payapi.Payment, error) {
+	sql := `
+		UPDATE payments
+		SET status = $1
+		WHERE status = $2 AND expires_at < NOW()
+		RETURNING ` + paymentColumns
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, sql, payapi.StatusExpired, payapi.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]*payapi.Payment, 0)
+
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		payments = append(payments, p)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, p := range payments {
+		// call hook endpoint, if any
+		err = enqueueDepositWebhook(ctx, tx, payapi.StatusExpired, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return payments, tx.Commit(ctx)
+}
+
+// why a payment could not be moved out of the created state
+func (s *PaymentService) notOpenError(ctx context.Context, id int) error {
+	var status int
+
+	err := s.db.QueryRow(ctx, `SELECT status FROM payments WHERE id = $1`, id).Scan(&status)
+	if err != nil {
+		return payapi.ErrPaymentNotFound
+	} else if status == payapi.StatusCompleted {
+		return payapi.ErrPaymentAlreadyCompleted
+	}
+
+	return payapi.ErrPaymentNotOpen
+}
+
+func (s *PaymentService) completePayment(ctx context.Context, payment *payapi.Payment, txid string, receivedAmount uint64) error {
+	sql := `
+		UPDATE payments
+		SET status = $1, transaction_id = $2, received_amount = $3, completed_at = NOW()
+		WHERE id = $4 AND status = $5
 		RETURNING completed_at
 	`
 
-	err := s.db.QueryRow(ctx, sql, payapi.StatusCompleted, txid, payment.ID).Scan(&payment.CompletedAt)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, sql, payapi.StatusCompleted, txid, receivedAmount, payment.ID, payapi.StatusCreated).Scan(&payment.CompletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// raced, usually the worker matching it on chain first
+		return s.notOpenError(ctx, payment.ID)
+	} else if err != nil {
 		fmt.Printf("err: %v\n", err)
 		return errors.New("failed to update")
 	}
 
 	// update payment field with txid and status, already known as above succeeded
 	payment.TransactionID = &txid
+	payment.ReceivedAmount = &receivedAmount
 	payment.Status = payapi.StatusCompleted
 
 	// call hook endpoint, if any
-	s.PlatformService.NotifyDeposit(ctx, payapi.StatusCompleted, *payment)
+	err = enqueueDepositWebhook(ctx, tx, payapi.StatusCompleted, payment)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func (s *PaymentService) CheckAndCompletePayment(ctx context.Context, id int, txid string, round *uint64) (*payapi.Payment, error) {
 	payment, err := s.FindPaymentByID(ctx, int(id))
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return nil, payapi.ErrPaymentNotFound
 	}
 
 	if payment.TransactionID != nil || payment.CompletedAt != nil {
-		return nil, errors.New("payment already completed")
+		return nil, payapi.ErrPaymentAlreadyCompleted
+	} else if payment.Status != payapi.StatusCreated {
+		return nil, payapi.ErrPaymentNotOpen
 	}
 
 	platform, err := s.PlatformService.FindPlatformByID(ctx, payment.PlatformId)
@@ -227,40 +483,44 @@ func (s *PaymentService) CheckAndCompletePayment(ctx context.Context, id int, tx
 	}
 
 	// check deposit and verify
-	ok, err := s.IndexerService.CheckTransaction(
-		ctx,
-		txid,
-		payment.Sender,
-		platform.Address,
-		payment.AssetId,
-		payment.Amount,
-		payment.CreatedAt,
-		payment.CreatedAt.Add(60*time.Second), // previously 30 second range, leading to few outside this range
-		strconv.FormatInt(int64(payment.ExternalId), 10),
-	)
-	if err != nil || !ok {
+	t, err := s.IndexerService.GetTransfer(ctx, txid)
+	if err != nil {
 		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("failed to check for deposit")
+	}
+
+	err = payment.Match(platform, t)
+	if err != nil {
+		fmt.Printf("payment %d txid: %s did not match err: %v\n", payment.ID, txid, err)
 		// TODO: provide distinct errors
 		return nil, errors.New("failed to check for deposit")
 	}
 
-	err = s.completePayment(ctx, payment, txid)
+	// large deposits wait for an admin, even when the user completes them
+	asset, err := s.PlatformService.FindPlatformAsset(ctx, payment.PlatformId, payment.AssetId)
+	if err == nil && asset.RequiresReview(t.Amount) {
+		return s.HoldPaymentForReview(ctx, payment.ID, txid, t.Amount)
+	}
+
+	err = s.completePayment(ctx, payment, txid, t.Amount)
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
-		return nil, errors.New("failed to complete payment")
+		return nil, err
 	}
 
 	return payment, nil
 }
 
-func (s *PaymentService) CompletePayment(ctx context.Context, id int, txid string) (*payapi.Payment, error) {
+func (s *PaymentService) CompletePayment(ctx context.Context, id int, txid string, receivedAmount uint64) (*payapi.Payment, error) {
 	payment, err := s.FindPaymentByID(ctx, int(id))
 	if err != nil {
-		return nil, errors.New("payment not found")
+		return nil, payapi.ErrPaymentNotFound
 	}
 
 	if payment.TransactionID != nil || payment.CompletedAt != nil {
-		return nil, errors.New("payment already completed")
+		return nil, payapi.ErrPaymentAlreadyCompleted
+	} else if payment.Status != payapi.StatusCreated {
+		return nil, payapi.ErrPaymentNotOpen
 	}
 
 	platform, err := s.PlatformService.FindPlatformByID(ctx, payment.PlatformId)
@@ -273,10 +533,10 @@ func (s *PaymentService) CompletePayment(ctx context.Context, id int, txid strin
 		return nil, errors.New("platform is not currently active")
 	}
 
-	err = s.completePayment(ctx, payment, txid)
+	err = s.completePayment(ctx, payment, txid, receivedAmount)
 	if err != nil {
 		fmt.Printf("err: %v\n", err)
-		return nil, errors.New("failed to complete payment")
+		return nil, err
 	}
 
 	return payment, nil
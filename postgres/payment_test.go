@@ -3,7 +3,9 @@ package postgres_test
 import (
 	"context"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/algo-casino/payapi"
 
@@ -35,7 +37,14 @@ func TestPaymentService_CreatePayment(t *testing.T) {
 			t.Fatalf("failed to create test platform err: %v\n", err)
 		}
 
+		// platform must accept the asset
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		s := postgres.NewPaymentService(db.DB)
+		s.PlatformService = platformService
 
 		payment := &payapi.Payment{
 			PlatformId: platform.ID,
@@ -90,4 +99,295 @@ func TestPaymentService_CreatePayment(t *testing.T) {
 			t.Fatal("expected error")
 		}
 	})
+
+	t.Run("ErrAssetNotAccepted", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     false,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		max := uint64(100)
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 0, Name: "ALGO", Decimals: 6, MaxAmount: &max})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewPaymentService(db.DB)
+		s.PlatformService = platformService
+
+		// not on the allowlist
+		err = s.CreatePayment(ctx, &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 420})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// over the maximum
+		err = s.CreatePayment(ctx, &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 0, Amount: 101, ExternalId: 420})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// ALGO within limits
+		err = s.CreatePayment(ctx, &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 0, Amount: 100, ExternalId: 420})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestPaymentService_FindPayments(t *testing.T) {
+	// ensure payments can be filtered and paged
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewPaymentService(db.DB)
+		s.PlatformService = platformService
+
+		for i, sender := range []string{"AAAA", "BBBB", "AAAA"} {
+			err = s.CreatePayment(ctx, &payapi.Payment{PlatformId: platform.ID, Sender: sender, AssetId: 1337, Amount: 69, ExternalId: i + 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// no filters, everything
+		payments, n, err := s.FindPayments(ctx, payapi.PaymentFilter{})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(payments), 3; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := n, 3; got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+
+		// page of one, total still counts all matching
+		sender := "AAAA"
+
+		payments, n, err = s.FindPayments(ctx, payapi.PaymentFilter{Sender: &sender, Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(payments), 1; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := n, 2; got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+
+		// past the end
+		payments, n, err = s.FindPayments(ctx, payapi.PaymentFilter{Sender: &sender, Offset: 5})
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(payments), 0; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := n, 2; got != want {
+			t.Fatalf("n=%v, want %v", got, want)
+		}
+
+		externalId := 2
+
+		payments, _, err = s.FindPayments(ctx, payapi.PaymentFilter{ExternalId: &externalId})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(payments) != 1 || payments[0].Sender != "BBBB" {
+			t.Fatalf("unexpected payments: %#v", payments)
+		}
+	})
+}
+
+func TestPaymentService_ExpirePayments(t *testing.T) {
+	// ensure open payments past their expiry are expired, with the note from the platform format
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+			NoteFormat: "deposit-{paymentId}",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewPaymentService(db.DB)
+		s.PlatformService = platformService
+
+		payment := &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 420}
+
+		err = s.CreatePayment(ctx, payment)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := payment.Note, "deposit-1"; got != want {
+			t.Fatalf("Note=%v, want %v", got, want)
+		} else if got, want := payment.ExpiresAt.Sub(payment.CreatedAt), time.Duration(payapi.DefaultPaymentExpiry)*time.Second; got != want {
+			t.Fatalf("expiry=%v, want %v", got, want)
+		}
+
+		// not yet expired
+		expired, err := s.ExpirePayments(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(expired), 0; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		}
+
+		_, err = db.DB.Exec(ctx, `UPDATE payments SET expires_at = NOW() - INTERVAL '1 minute' WHERE id = $1`, payment.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expired, err = s.ExpirePayments(ctx)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := len(expired), 1; got != want {
+			t.Fatalf("len=%v, want %v", got, want)
+		} else if got, want := expired[0].Status, payapi.StatusExpired; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		}
+
+		// can no longer be cancelled or completed
+		_, err = s.CancelPayment(ctx, payment.ID)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		_, err = s.CompletePayment(ctx, payment.ID, "TXID", 69)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestPaymentService_ReviewPayment(t *testing.T) {
+	// ensure held payments can only be approved or rejected once
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		threshold := uint64(50)
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST", ReviewThreshold: &threshold})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewPaymentService(db.DB)
+		s.PlatformService = platformService
+
+		approved := &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 1}
+		rejected := &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 2}
+
+		for i, payment := range []*payapi.Payment{approved, rejected} {
+			err = s.CreatePayment(ctx, payment)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			held, err := s.HoldPaymentForReview(ctx, payment.ID, "TXID"+strconv.Itoa(i), 69)
+			if err != nil {
+				t.Fatal(err)
+			} else if got, want := held.Status, payapi.StatusPendingReview; got != want {
+				t.Fatalf("Status=%v, want %v", got, want)
+			}
+		}
+
+		p, err := s.ApprovePayment(ctx, approved.ID, "checked on chain")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := p.Status, payapi.StatusCompleted; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		} else if got, want := *p.TransactionID, "TXID0"; got != want {
+			t.Fatalf("TransactionID=%v, want %v", got, want)
+		}
+
+		p, err = s.RejectPayment(ctx, rejected.ID, "sender flagged")
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := p.Status, payapi.StatusCancelled; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		}
+
+		// already reviewed
+		_, err = s.RejectPayment(ctx, approved.ID, "too late")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		_, err = s.ApprovePayment(ctx, rejected.ID, "too late")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
 }
@@ -1,21 +1,29 @@
 package postgres
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"net/http"
-	"os"
-	"time"
 
 	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var _ payapi.PlatformService = (*PlatformService)(nil)
 
+// every query returning a full platform selects these, in this order
+const platformColumns = `
+	id, name, active, address, webhook_url, webhook_secret, webhook_version,
+	payment_expiry, match_window, note_format, amount_tolerance_bps
+`
+
+// api keys are handed out as `payapi_<hex>`
+const apiKeyPrefix = "payapi_"
+
 type PlatformService struct {
 	db *pgxpool.Pool
 }
@@ -26,68 +34,95 @@ func NewPlatformService(db *pgxpool.Pool) *PlatformService {
 	}
 }
 
-// paymentId - the PayAPI ID (stored as `external_id` column on casino `deposits` table)
-func callCompleteDeposit(webhookUrl string, paymentId int, transactionId string) bool {
-	type completeDepositRequest struct {
-		ExternalId    int    `json:"externalId"`    // PayAPI payment ID
-		TransactionId string `json:"transactionId"` // algorand txid
-	}
+// random hex encoded secret, used for webhook signing keys
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
 
-	cdr := &completeDepositRequest{
-		ExternalId:    paymentId,
-		TransactionId: transactionId,
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
 	}
 
-	buf, err := json.Marshal(cdr)
+	return hex.EncodeToString(buf), nil
+}
+
+// api keys are only ever stored and looked up by their hash
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func scanPlatform(row pgx.Row) (*payapi.Platform, error) {
+	p := &payapi.Platform{}
+
+	err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Active,
+		&p.Address,
+		&p.WebhookUrl,
+		&p.WebhookSecret,
+		&p.WebhookVersion,
+		&p.PaymentExpiry,
+		&p.MatchWindow,
+		&p.NoteFormat,
+		&p.AmountToleranceBps,
+	)
 	if err != nil {
-		fmt.Printf("err: %v\n", err)
-		return false
+		return nil, err
 	}
 
-	req, err := http.NewRequest("GET", webhookUrl, bytes.NewReader(buf))
+	return p, nil
+}
+
+func (s *PlatformService) FindPlatforms(ctx context.Context) ([]*payapi.Platform, error) {
+	sql := `SELECT ` + platformColumns + ` FROM platforms ORDER BY id ASC`
+
+	rows, err := s.db.Query(ctx, sql)
 	if err != nil {
-		return false
+		return nil, err
 	}
+	defer rows.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	platforms := make([]*payapi.Platform, 0)
 
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
+	for rows.Next() {
+		p, err := scanPlatform(rows)
+		if err != nil {
+			return nil, err
+		}
 
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "got error %s", err.Error())
-		return false
+		platforms = append(platforms, p)
 	}
-	defer res.Body.Close()
 
-	return res.StatusCode == http.StatusOK
+	return platforms, rows.Err()
 }
 
 func (s *PlatformService) FindPlatformByID(ctx context.Context, id int) (*payapi.Platform, error) {
-	p := &payapi.Platform{
-		ID: id,
+	sql := `SELECT ` + platformColumns + ` FROM platforms WHERE id = $1 LIMIT 1`
+
+	p, err := scanPlatform(s.db.QueryRow(ctx, sql, id))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, err
 	}
 
+	return p, nil
+}
+
+func (s *PlatformService) FindPlatformByApiKey(ctx context.Context, key string) (*payapi.Platform, error) {
 	sql := `
-		SELECT name, active, address, webhook_url
-		FROM platforms
-		WHERE id = $1
-		LIMIT 1
+		UPDATE platform_api_keys k
+		SET last_used_at = NOW()
+		FROM platforms p
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND p.id = k.platform_id
+		RETURNING p.id, p.name, p.active, p.address, p.webhook_url, p.webhook_secret, p.webhook_version,
+			p.payment_expiry, p.match_window, p.note_format, p.amount_tolerance_bps
 	`
 
-	err := s.db.QueryRow(ctx, sql, id).Scan(
-		&p.Name,
-		&p.Active,
-		&p.Address,
-		&p.WebhookUrl,
-	)
-
+	p, err := scanPlatform(s.db.QueryRow(ctx, sql, hashApiKey(key)))
 	if err != nil {
-		fmt.Printf("err: %v\n", err)
-		return nil, err
+		return nil, errors.New("invalid api key")
 	}
 
 	return p, nil
@@ -99,19 +134,56 @@ func (s *PlatformService) CreatePlatform(ctx context.Context, platform *payapi.P
 		return errors.New("invalid parameters")
 	}
 
+	if platform.WebhookSecret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return err
+		}
+
+		platform.WebhookSecret = secret
+	}
+
+	// unset settings take the defaults
+	if platform.PaymentExpiry == 0 {
+		platform.PaymentExpiry = payapi.DefaultPaymentExpiry
+	}
+
+	if platform.MatchWindow == 0 {
+		platform.MatchWindow = payapi.DefaultMatchWindow
+	}
+
+	if platform.NoteFormat == "" {
+		platform.NoteFormat = payapi.DefaultNoteFormat
+	}
+
+	if platform.WebhookVersion == 0 {
+		platform.WebhookVersion = payapi.DefaultWebhookVersion
+	}
+
+	err := platform.ValidateSettings()
+	if err != nil {
+		return err
+	}
+
 	sql := `
-		INSERT INTO platforms (name, address, active, webhook_url)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO platforms (name, address, active, webhook_url, webhook_secret, webhook_version, payment_expiry, match_window, note_format, amount_tolerance_bps)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id
 	`
 
-	err := s.db.QueryRow(
+	err = s.db.QueryRow(
 		ctx,
 		sql,
 		platform.Name,
 		platform.Address,
 		platform.Active,
 		platform.WebhookUrl,
+		platform.WebhookSecret,
+		platform.WebhookVersion,
+		platform.PaymentExpiry,
+		platform.MatchWindow,
+		platform.NoteFormat,
+		platform.AmountToleranceBps,
 	).Scan(
 		&platform.ID,
 	)
@@ -123,18 +195,292 @@ func (s *PlatformService) CreatePlatform(ctx context.Context, platform *payapi.P
 	return nil
 }
 
-func (s *PlatformService) NotifyDeposit(ctx context.Context, status int, payment payapi.Payment) error {
-	platform, err := s.FindPlatformByID(ctx, payment.PlatformId)
+func (s *PlatformService) UpdatePlatform(ctx context.Context, id int, upd payapi.PlatformUpdate) (*payapi.Platform, error) {
+	if (upd.Name != nil && *upd.Name == "") || (upd.Address != nil && *upd.Address == "") || (upd.WebhookUrl != nil && *upd.WebhookUrl == "") {
+		return nil, errors.New("invalid parameters")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	platform, err := scanPlatform(tx.QueryRow(ctx, `SELECT `+platformColumns+` FROM platforms WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, errors.New("platform not found")
+	}
+
+	// open payments are matched against the current address, moving it would strand them
+	if upd.Address != nil && *upd.Address != platform.Address {
+		var open int
+
+		err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM payments WHERE platform_id = $1 AND status = $2`, id, payapi.StatusCreated).Scan(&open)
+		if err != nil {
+			return nil, err
+		} else if open > 0 {
+			return nil, fmt.Errorf("platform has %d open payments, cannot change address", open)
+		}
+
+		platform.Address = *upd.Address
+	}
+
+	if upd.Name != nil {
+		platform.Name = *upd.Name
+	}
+
+	if upd.Active != nil {
+		platform.Active = *upd.Active
+	}
+
+	if upd.WebhookUrl != nil {
+		platform.WebhookUrl = *upd.WebhookUrl
+	}
+
+	// deliveries already queued go out as they were queued
+	if upd.WebhookVersion != nil {
+		platform.WebhookVersion = *upd.WebhookVersion
+	}
+
+	// open payments keep the expiry and note they were created with
+	if upd.PaymentExpiry != nil {
+		platform.PaymentExpiry = *upd.PaymentExpiry
+	}
+
+	if upd.MatchWindow != nil {
+		platform.MatchWindow = *upd.MatchWindow
+	}
+
+	if upd.NoteFormat != nil {
+		platform.NoteFormat = *upd.NoteFormat
+	}
+
+	if upd.AmountToleranceBps != nil {
+		platform.AmountToleranceBps = *upd.AmountToleranceBps
+	}
+
+	err = platform.ValidateSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+		UPDATE platforms
+		SET name = $1, active = $2, address = $3, webhook_url = $4, webhook_version = $5,
+			payment_expiry = $6, match_window = $7, note_format = $8, amount_tolerance_bps = $9
+		WHERE id = $10
+	`
+
+	_, err = tx.Exec(
+		ctx,
+		sql,
+		platform.Name,
+		platform.Active,
+		platform.Address,
+		platform.WebhookUrl,
+		platform.WebhookVersion,
+		platform.PaymentExpiry,
+		platform.MatchWindow,
+		platform.NoteFormat,
+		platform.AmountToleranceBps,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return platform, tx.Commit(ctx)
+}
+
+func (s *PlatformService) RotateWebhookSecret(ctx context.Context, id int) (*payapi.Platform, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `UPDATE platforms SET webhook_secret = $1 WHERE id = $2 RETURNING ` + platformColumns
+
+	p, err := scanPlatform(s.db.QueryRow(ctx, sql, secret, id))
+	if err != nil {
+		return nil, errors.New("platform not found")
+	}
+
+	return p, nil
+}
+
+func (s *PlatformService) FindPlatformApiKeys(ctx context.Context, platformId int) ([]*payapi.PlatformApiKey, error) {
+	sql := `
+		SELECT id, prefix, created_at, last_used_at, revoked_at
+		FROM platform_api_keys
+		WHERE platform_id = $1
+		ORDER BY id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, platformId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*payapi.PlatformApiKey, 0)
+
+	for rows.Next() {
+		k := payapi.PlatformApiKey{PlatformId: platformId}
+
+		err := rows.Scan(&k.ID, &k.Prefix, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *PlatformService) CreatePlatformApiKey(ctx context.Context, platformId int) (*payapi.PlatformApiKey, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	k := &payapi.PlatformApiKey{
+		PlatformId: platformId,
+		Key:        apiKeyPrefix + secret,
+	}
+	k.Prefix = k.Key[:len(apiKeyPrefix)+6]
+
+	sql := `
+		INSERT INTO platform_api_keys (platform_id, key_hash, prefix, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, created_at
+	`
+
+	err = s.db.QueryRow(ctx, sql, platformId, hashApiKey(k.Key), k.Prefix).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (s *PlatformService) RevokePlatformApiKey(ctx context.Context, platformId, id int) error {
+	sql := `
+		UPDATE platform_api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND platform_id = $2 AND revoked_at IS NULL
+	`
+
+	tag, err := s.db.Exec(ctx, sql, id, platformId)
+	if err != nil {
+		return err
+	} else if tag.RowsAffected() == 0 {
+		return errors.New("api key not found")
+	}
+
+	return nil
+}
+
+func scanPlatformAsset(row pgx.Row) (*payapi.PlatformAsset, error) {
+	a := &payapi.PlatformAsset{}
+
+	err := row.Scan(
+		&a.PlatformId,
+		&a.AssetId,
+		&a.Name,
+		&a.Decimals,
+		&a.MinAmount,
+		&a.MaxAmount,
+		&a.ReviewThreshold,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (s *PlatformService) FindPlatformAssets(ctx context.Context, platformId int) ([]*payapi.PlatformAsset, error) {
+	sql := `
+		SELECT platform_id, asset_id, name, decimals, min_amount, max_amount, review_threshold, created_at
+		FROM platform_assets
+		WHERE platform_id = $1
+		ORDER BY asset_id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, platformId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := make([]*payapi.PlatformAsset, 0)
+
+	for rows.Next() {
+		a, err := scanPlatformAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		assets = append(assets, a)
+	}
+
+	return assets, rows.Err()
+}
+
+func (s *PlatformService) FindPlatformAsset(ctx context.Context, platformId int, assetId uint64) (*payapi.PlatformAsset, error) {
+	sql := `
+		SELECT platform_id, asset_id, name, decimals, min_amount, max_amount, review_threshold, created_at
+		FROM platform_assets
+		WHERE platform_id = $1 AND asset_id = $2
+		LIMIT 1
+	`
+
+	a, err := scanPlatformAsset(s.db.QueryRow(ctx, sql, platformId, assetId))
+	if err != nil {
+		return nil, fmt.Errorf("asset %d is not accepted by platform", assetId)
+	}
+
+	return a, nil
+}
+
+func (s *PlatformService) SavePlatformAsset(ctx context.Context, asset *payapi.PlatformAsset) error {
+	err := asset.Validate()
 	if err != nil {
 		return err
 	}
 
-	switch status {
-	case payapi.StatusCancelled:
-		fmt.Println("not yet implemented for cancelled event")
-	case payapi.StatusCompleted:
-		// call webhook url with payment id
-		callCompleteDeposit(platform.WebhookUrl, payment.ID, *payment.TransactionID)
+	sql := `
+		INSERT INTO platform_assets (platform_id, asset_id, name, decimals, min_amount, max_amount, review_threshold, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (platform_id, asset_id) DO UPDATE
+		SET name = EXCLUDED.name, decimals = EXCLUDED.decimals, min_amount = EXCLUDED.min_amount, max_amount = EXCLUDED.max_amount,
+			review_threshold = EXCLUDED.review_threshold
+		RETURNING created_at
+	`
+
+	return s.db.QueryRow(
+		ctx,
+		sql,
+		asset.PlatformId,
+		asset.AssetId,
+		asset.Name,
+		asset.Decimals,
+		asset.MinAmount,
+		asset.MaxAmount,
+		asset.ReviewThreshold,
+	).Scan(
+		&asset.CreatedAt,
+	)
+}
+
+func (s *PlatformService) DeletePlatformAsset(ctx context.Context, platformId int, assetId uint64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM platform_assets WHERE platform_id = $1 AND asset_id = $2`, platformId, assetId)
+	if err != nil {
+		return err
+	} else if tag.RowsAffected() == 0 {
+		return errors.New("asset not found")
 	}
 
 	return nil
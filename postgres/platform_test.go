@@ -56,3 +56,108 @@ func TestPlatformService_CreatePlatform(t *testing.T) {
 		}
 	})
 }
+
+func TestPlatformService_ApiKeys(t *testing.T) {
+	// ensure api keys authenticate their own platform until revoked
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		err := s.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := s.CreatePlatformApiKey(ctx, platform.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if key.Key == "" {
+			t.Fatal("expected key")
+		}
+
+		fetched, err := s.FindPlatformByApiKey(ctx, key.Key)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(platform, fetched) {
+			t.Fatalf("mismatch: %#v != %#v", platform, fetched)
+		}
+
+		keys, err := s.FindPlatformApiKeys(ctx, platform.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(keys) != 1 || keys[0].Key != "" || keys[0].Prefix != key.Prefix {
+			t.Fatalf("unexpected keys: %#v", keys)
+		}
+
+		err = s.RevokePlatformApiKey(ctx, platform.ID, key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.FindPlatformByApiKey(ctx, key.Key)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("ErrAddressWithOpenPayments", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		err := s.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// platform must accept the asset
+		err = s.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paymentService := postgres.NewPaymentService(db.DB)
+		paymentService.PlatformService = s
+
+		err = paymentService.CreatePayment(ctx, &payapi.Payment{
+			PlatformId: platform.ID,
+			Status:     payapi.StatusCreated,
+			Sender:     "AAAA",
+			AssetId:    1337,
+			Amount:     69,
+			ExternalId: 420,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		address := "BBBB"
+
+		_, err = s.UpdatePlatform(ctx, platform.ID, payapi.PlatformUpdate{Address: &address})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
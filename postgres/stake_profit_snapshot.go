@@ -2,6 +2,10 @@ package postgres
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/algo-casino/payapi"
 	"github.com/algo-casino/payapi/stake"
@@ -15,6 +19,16 @@ type (
 		db                   *pgxpool.Pool
 		StakeService         stake.StakeService
 		StakingPeriodService payapi.StakingPeriodService
+
+		// revenue of whole days already over doesn't change, by period then day
+		// unless the period's funding games are edited, which starts its days over
+		dailyMu sync.Mutex
+		daily   map[int]*dailyProfits
+	}
+
+	dailyProfits struct {
+		fundingGames string // fundingGamesKey of the games the days were summed over
+		days         map[time.Time]float64
 	}
 )
 
@@ -26,7 +40,7 @@ func NewStakeProfitSnapshotService(db *pgxpool.Pool) *StakeProfitSnapshotService
 
 func (s *StakeProfitSnapshotService) GetLastKnownProfitForPeriod(ctx context.Context, stakingPeriodId int) (*payapi.StakeProfitSnapshot, error) {
 	sql := `
-		SELECT id, created_at, profit
+		SELECT id, created_at, profit, breakdown
 		FROM stake_profit_snapshots
 		WHERE staking_period_id = $1
 		ORDER BY created_at DESC
@@ -37,7 +51,7 @@ func (s *StakeProfitSnapshotService) GetLastKnownProfitForPeriod(ctx context.Con
 		StakingPeriodID: stakingPeriodId,
 	}
 
-	err := s.db.QueryRow(context.Background(), sql, stakingPeriodId).Scan(&snapshot.ID, &snapshot.CreatedAt, &snapshot.Profit)
+	err := s.db.QueryRow(ctx, sql, stakingPeriodId).Scan(&snapshot.ID, &snapshot.CreatedAt, &snapshot.Profit, &snapshot.Breakdown)
 	if err != nil {
 		return nil, err
 	}
@@ -45,24 +59,166 @@ func (s *StakeProfitSnapshotService) GetLastKnownProfitForPeriod(ctx context.Con
 	return snapshot, nil
 }
 
+func (s *StakeProfitSnapshotService) FindStakeProfitSnapshots(ctx context.Context, filter payapi.StakeProfitSnapshotFilter) ([]*payapi.StakeProfitSnapshot, error) {
+	sql := `
+		SELECT id, staking_period_id, created_at, profit, breakdown
+		FROM stake_profit_snapshots
+		WHERE ($1::INT IS NULL OR staking_period_id = $1)
+		AND ($2::TIMESTAMPTZ IS NULL OR created_at >= $2)
+		AND ($3::TIMESTAMPTZ IS NULL OR created_at <= $3)
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]*payapi.StakeProfitSnapshot, 0)
+
+	for rows.Next() {
+		var snapshot payapi.StakeProfitSnapshot
+
+		err := rows.Scan(&snapshot.ID, &snapshot.StakingPeriodID, &snapshot.CreatedAt, &snapshot.Profit, &snapshot.Breakdown)
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, &snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+func (s *StakeProfitSnapshotService) GetDailyGrossProfitForPeriod(ctx context.Context, stakingPeriodId int) ([]*payapi.StakeProfitDay, error) {
+	sp, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, stakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+
+	// same range snapshots are taken over, up to now while it's running
+	begin := sp.RegistrationBegin.UTC()
+	end := sp.CommitmentEnd.UTC()
+
+	now := time.Now().UTC()
+	if now.Before(end) {
+		end = now
+	}
+
+	days := make([]*payapi.StakeProfitDay, 0)
+	cumulative := float64(0)
+
+	for day := begin.Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+		from, to := day, day.Add(24*time.Hour)
+
+		if from.Before(begin) {
+			from = begin
+		}
+
+		// a whole day over can be cached
+		complete := !to.After(end)
+		if !complete {
+			to = end
+		}
+
+		profit, ok := s.cachedDay(sp, day)
+		if !ok {
+			// ranges are inclusive, stop short of the next day
+			profit, err = s.grossProfitForRange(ctx, sp, from, to.Add(-time.Second))
+			if err != nil {
+				return nil, err
+			}
+
+			if complete {
+				s.cacheDay(sp, day, profit)
+			}
+		}
+
+		cumulative += profit
+
+		days = append(days, &payapi.StakeProfitDay{
+			Day:        day,
+			Profit:     profit,
+			Cumulative: cumulative,
+		})
+	}
+
+	return days, nil
+}
+
+// revenue of the period's funding games between two times, every game's when it has none
+func (s *StakeProfitSnapshotService) grossProfitForRange(ctx context.Context, sp *payapi.StakingPeriod, startTime, endTime time.Time) (float64, error) {
+	if len(sp.FundingGames) == 0 {
+		return s.StakeService.GetGrossProfitForRange(ctx, startTime, endTime)
+	}
+
+	breakdown, err := s.StakeService.GetGrossProfitBreakdownForRange(ctx, startTime, endTime)
+	if err != nil {
+		return 0, err
+	}
+
+	return stake.GrossProfit(breakdown, sp.FundingGames), nil
+}
+
+// order doesn't matter, the same games give the same key
+func fundingGamesKey(games []string) string {
+	sorted := append([]string(nil), games...)
+	sort.Strings(sorted)
+
+	return strings.Join(sorted, "\n")
+}
+
+func (s *StakeProfitSnapshotService) cachedDay(sp *payapi.StakingPeriod, day time.Time) (float64, bool) {
+	s.dailyMu.Lock()
+	defer s.dailyMu.Unlock()
+
+	cached := s.daily[sp.ID]
+	if cached == nil || cached.fundingGames != fundingGamesKey(sp.FundingGames) {
+		return 0, false
+	}
+
+	profit, ok := cached.days[day]
+
+	return profit, ok
+}
+
+func (s *StakeProfitSnapshotService) cacheDay(sp *payapi.StakingPeriod, day time.Time, profit float64) {
+	s.dailyMu.Lock()
+	defer s.dailyMu.Unlock()
+
+	if s.daily == nil {
+		s.daily = make(map[int]*dailyProfits)
+	}
+
+	// days summed over other funding games are stale
+	games := fundingGamesKey(sp.FundingGames)
+	if s.daily[sp.ID] == nil || s.daily[sp.ID].fundingGames != games {
+		s.daily[sp.ID] = &dailyProfits{fundingGames: games, days: make(map[time.Time]float64)}
+	}
+
+	s.daily[sp.ID].days[day] = profit
+}
+
 func (s *StakeProfitSnapshotService) CreateStakeProfitSnapshot(ctx context.Context, sp *payapi.StakingPeriod) (*payapi.StakeProfitSnapshot, error) {
-	profit, err := s.StakeService.GetGrossProfitForRange(ctx, sp.RegistrationBegin, sp.CommitmentEnd)
+	breakdown, err := s.StakeService.GetGrossProfitBreakdownForRange(ctx, sp.RegistrationBegin, sp.CommitmentEnd)
 	if err != nil {
 		return nil, err
 	}
 
 	sql := `
-	INSERT INTO stake_profit_snapshots (created_at, staking_period_id, profit)
-	VALUES (NOW(), $1, $2)
+	INSERT INTO stake_profit_snapshots (created_at, staking_period_id, profit, breakdown)
+	VALUES (NOW(), $1, $2, $3)
 	RETURNING id, created_at
 `
 
 	snapshot := &payapi.StakeProfitSnapshot{
 		StakingPeriodID: sp.ID,
-		Profit:          profit,
+		Profit:          stake.GrossProfit(breakdown, sp.FundingGames),
+		Breakdown:       breakdown,
 	}
 
-	err = s.db.QueryRow(ctx, sql, sp.ID, profit).Scan(&snapshot.ID, &snapshot.CreatedAt)
+	err = s.db.QueryRow(ctx, sql, sp.ID, snapshot.Profit, snapshot.Breakdown).Scan(&snapshot.ID, &snapshot.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
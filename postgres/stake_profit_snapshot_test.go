@@ -0,0 +1,67 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestStakeProfitSnapshotService_FindStakeProfitSnapshots(t *testing.T) {
+	// ensure history comes back in time order and thins out
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+		s := postgres.NewStakeProfitSnapshotService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// every 6 hours over 3 days, newest first
+		begin := time.Now().UTC().Truncate(time.Hour).Add(-72 * time.Hour)
+		for i := 12; i >= 0; i-- {
+			_, err = db.DB.Exec(ctx, `INSERT INTO stake_profit_snapshots (created_at, staking_period_id, profit) VALUES ($1, $2, $3)`, begin.Add(time.Duration(i)*6*time.Hour), stakingPeriod.ID, float64(i*100))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		snapshots, err := s.FindStakeProfitSnapshots(ctx, payapi.StakeProfitSnapshotFilter{StakingPeriodId: &stakingPeriod.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(snapshots) != 13 || snapshots[0].Profit != 0 || snapshots[12].Profit != 1200 {
+			t.Fatalf("unexpected snapshots: %v", snapshots)
+		}
+
+		from := begin.Add(24 * time.Hour)
+		ranged, err := s.FindStakeProfitSnapshots(ctx, payapi.StakeProfitSnapshotFilter{StakingPeriodId: &stakingPeriod.ID, From: &from})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(ranged) != 9 || ranged[0].Profit != 400 {
+			t.Fatalf("unexpected snapshots: %v", ranged)
+		}
+
+		// last of each day
+		daily := payapi.DownsampleProfitSnapshots(snapshots, 24*time.Hour, 0)
+		if len(daily) != 4 || daily[0].Profit != 300 || daily[3].Profit != 1200 {
+			t.Fatalf("unexpected daily: %v", daily)
+		}
+
+		// first and last kept
+		points := payapi.DownsampleProfitSnapshots(snapshots, 0, 5)
+		if len(points) != 5 || points[0].Profit != 0 || points[2].Profit != 600 || points[4].Profit != 1200 {
+			t.Fatalf("unexpected points: %v", points)
+		}
+	})
+}
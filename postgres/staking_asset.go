@@ -0,0 +1,213 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.StakingAssetService = (*StakingAssetService)(nil)
+
+// every query returning a full staking asset selects these, in this order
+const stakingAssetColumns = `id, asset_id, name, pool_address, decimals, weight, price_source, auto_stake, active, created_at`
+
+type StakingAssetService struct {
+	db *pgxpool.Pool
+}
+
+func NewStakingAssetService(db *pgxpool.Pool) *StakingAssetService {
+	return &StakingAssetService{
+		db: db,
+	}
+}
+
+func scanStakingAsset(row pgx.Row) (*payapi.StakingAsset, error) {
+	a := &payapi.StakingAsset{}
+
+	err := row.Scan(
+		&a.ID,
+		&a.AssetId,
+		&a.Name,
+		&a.PoolAddress,
+		&a.Decimals,
+		&a.Weight,
+		&a.PriceSource,
+		&a.AutoStake,
+		&a.Active,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (s *StakingAssetService) FindStakingAssets(ctx context.Context, filter payapi.StakingAssetFilter) ([]*payapi.StakingAsset, error) {
+	sql := `SELECT ` + stakingAssetColumns + `
+		FROM staking_assets
+		WHERE ($1::BOOLEAN IS NULL OR active = $1)
+		ORDER BY id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.Active)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assets := make([]*payapi.StakingAsset, 0)
+
+	for rows.Next() {
+		a, err := scanStakingAsset(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		assets = append(assets, a)
+	}
+
+	return assets, rows.Err()
+}
+
+func (s *StakingAssetService) FindStakingAssetByAssetID(ctx context.Context, assetId uint64) (*payapi.StakingAsset, error) {
+	sql := `SELECT ` + stakingAssetColumns + ` FROM staking_assets WHERE asset_id = $1 LIMIT 1`
+
+	a, err := scanStakingAsset(s.db.QueryRow(ctx, sql, assetId))
+	if err != nil {
+		return nil, fmt.Errorf("asset %d is not a staking asset", assetId)
+	}
+
+	return a, nil
+}
+
+func (s *StakingAssetService) CreateStakingAsset(ctx context.Context, asset *payapi.StakingAsset) error {
+	err := asset.Validate()
+	if err != nil {
+		return err
+	}
+
+	sql := `
+		INSERT INTO staking_assets (asset_id, name, pool_address, decimals, weight, price_source, auto_stake, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING id, created_at
+	`
+
+	return s.db.QueryRow(
+		ctx,
+		sql,
+		asset.AssetId,
+		asset.Name,
+		asset.PoolAddress,
+		asset.Decimals,
+		asset.Weight,
+		asset.PriceSource,
+		asset.AutoStake,
+		asset.Active,
+	).Scan(
+		&asset.ID,
+		&asset.CreatedAt,
+	)
+}
+
+func (s *StakingAssetService) UpdateStakingAsset(ctx context.Context, asset *payapi.StakingAsset) error {
+	err := asset.Validate()
+	if err != nil {
+		return err
+	}
+
+	sql := `
+		UPDATE staking_assets
+		SET name = $1, pool_address = $2, weight = $3, price_source = $4, auto_stake = $5, active = $6
+		WHERE asset_id = $7
+		RETURNING id, decimals, created_at
+	`
+
+	err = s.db.QueryRow(
+		ctx,
+		sql,
+		asset.Name,
+		asset.PoolAddress,
+		asset.Weight,
+		asset.PriceSource,
+		asset.AutoStake,
+		asset.Active,
+		asset.AssetId,
+	).Scan(
+		&asset.ID,
+		&asset.Decimals,
+		&asset.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("asset %d is not a staking asset", asset.AssetId)
+	}
+
+	return nil
+}
+
+func (s *StakingAssetService) FindStakingAssetRatios(ctx context.Context, filter payapi.StakingAssetRatioFilter) ([]*payapi.StakingAssetRatio, error) {
+	sql := `
+		SELECT id, staking_period_id, staking_check_run_id, asset_id, ratio, pool_address, round, chip_reserve, liquidity_issued, created_at
+		FROM staking_asset_ratios
+		WHERE ($1::INT IS NULL OR staking_period_id = $1)
+		AND ($2::BIGINT IS NULL OR asset_id = $2)
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId, filter.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratios := make([]*payapi.StakingAssetRatio, 0)
+
+	for rows.Next() {
+		var r payapi.StakingAssetRatio
+
+		err := rows.Scan(&r.ID, &r.StakingPeriodId, &r.StakingCheckRunId, &r.AssetId, &r.Ratio, &r.PoolAddress, &r.Round, &r.ChipReserve, &r.LiquidityIssued, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		ratios = append(ratios, &r)
+	}
+
+	return ratios, rows.Err()
+}
+
+func (s *StakingAssetService) CreateStakingAssetRatios(ctx context.Context, ratios []*payapi.StakingAssetRatio) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = insertStakingAssetRatios(ctx, tx, ratios)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// shared with check runs, which record ratios alongside holdings
+func insertStakingAssetRatios(ctx context.Context, tx pgx.Tx, ratios []*payapi.StakingAssetRatio) error {
+	sql := `
+		INSERT INTO staking_asset_ratios (staking_period_id, staking_check_run_id, asset_id, ratio, pool_address, round, chip_reserve, liquidity_issued, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING id, created_at
+	`
+
+	for _, r := range ratios {
+		err := tx.QueryRow(ctx, sql, r.StakingPeriodId, r.StakingCheckRunId, r.AssetId, r.Ratio, r.PoolAddress, r.Round, r.ChipReserve, r.LiquidityIssued).Scan(&r.ID, &r.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package postgres_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestStakingAssetService_CreateStakingAsset(t *testing.T) {
+	// ensure a pool can be added to the registry and reweighted
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingAssetService(db.DB)
+
+		asset := &payapi.StakingAsset{
+			AssetId:     1337,
+			Name:        "TEST/chip",
+			Decimals:    6,
+			Weight:      1,
+			PriceSource: payapi.StakingPriceSourceChipRatio,
+			AutoStake:   true,
+			Active:      true,
+		}
+
+		err := s.CreateStakingAsset(ctx, asset)
+		if err != nil {
+			t.Fatal(err)
+		} else if asset.ID == 0 {
+			t.Fatal("expected id")
+		}
+
+		// 2 tokens at 50 chips each
+		if v := asset.ChipEquivalent(2000000, 50); v.Cmp(big.NewRat(100, 1)) != 0 {
+			t.Fatalf("ChipEquivalent=%v, want %v", v, 100)
+		}
+
+		asset.Weight = 0.5
+		asset.Active = false
+		asset.Decimals = 0 // fixed once registered
+
+		err = s.UpdateStakingAsset(ctx, asset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := s.FindStakingAssetByAssetID(ctx, 1337)
+		if err != nil {
+			t.Fatal(err)
+		} else if found.Weight != 0.5 {
+			t.Fatalf("Weight=%v, want %v", found.Weight, 0.5)
+		} else if found.Active {
+			t.Fatalf("Active=%v, want %v", found.Active, false)
+		} else if found.Decimals != 6 {
+			t.Fatalf("Decimals=%v, want %v", found.Decimals, 6)
+		}
+
+		active := true
+
+		assets, err := s.FindStakingAssets(ctx, payapi.StakingAssetFilter{Active: &active})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, a := range assets {
+			if a.AssetId == 1337 {
+				t.Fatal("inactive asset returned")
+			}
+		}
+	})
+
+	t.Run("ErrBadParameters", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		s := postgres.NewStakingAssetService(db.DB)
+
+		err := s.CreateStakingAsset(context.Background(), &payapi.StakingAsset{AssetId: 1337, Name: "TEST", PriceSource: "oracle"})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestStakingAssetService_CreateStakingAssetRatios(t *testing.T) {
+	// ensure recorded pool ratios value pooled assets in results, in place of the period's chip ratio
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingAssetService(db.DB)
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		srs := postgres.NewStakingResultService(db.DB)
+		srs.StakingPeriodService = sps
+		srs.StakingCommitmentService = scs
+		srs.StakingAssetService = s
+		srs.StakingCheckRunService = postgres.NewStakingCheckRunService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tinyman v1 pool token, priced at creation then at a check run
+		lpAssetId := uint64(552665159)
+
+		ratios := []*payapi.StakingAssetRatio{
+			{StakingPeriodId: stakingPeriod.ID, AssetId: lpAssetId, Ratio: 2.5, PoolAddress: "POOL", Round: 1, ChipReserve: 1250, LiquidityIssued: 100000000},
+			{StakingPeriodId: stakingPeriod.ID, AssetId: lpAssetId, Ratio: 3.5, PoolAddress: "POOL", Round: 2, ChipReserve: 1750, LiquidityIssued: 100000000},
+		}
+
+		err = s.CreateStakingAssetRatios(ctx, ratios)
+		if err != nil {
+			t.Fatal(err)
+		} else if ratios[0].ID == 0 {
+			t.Fatal("expected id")
+		}
+
+		found, err := s.FindStakingAssetRatios(ctx, payapi.StakingAssetRatioFilter{StakingPeriodId: &stakingPeriod.ID, AssetId: &lpAssetId})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(found) != 2 {
+			t.Fatalf("len(ratios)=%v, want %v", len(found), 2)
+		} else if found[1].Ratio != 3.5 {
+			t.Fatalf("Ratio=%v, want %v", found[1].Ratio, 3.5)
+		}
+
+		// 10 pool tokens at a mean of 3 chips, against 60 chips
+		commitments := map[string]*payapi.StakingCommitmentItem{
+			"AAAA": {AssetId: lpAssetId, Amount: 10000000},
+			"BBBB": {AssetId: payapi.StakingRewardAssetId, Amount: 600},
+		}
+
+		for address, item := range commitments {
+			err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+				StakingPeriodID: stakingPeriod.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{item},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		res, err := srs.CreateStakingResult(ctx, stakingPeriod.ID, 900, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if res.AssetRatios[lpAssetId] != 3 {
+			t.Fatalf("AssetRatios=%v, want %v", res.AssetRatios[lpAssetId], 3)
+		}
+
+		rewards := make(map[string]uint64)
+		for _, item := range res.Results {
+			rewards[item.Address] = item.Reward
+		}
+
+		if rewards["AAAA"] != 300 {
+			t.Fatalf("AAAA Reward=%v, want %v", rewards["AAAA"], 300)
+		} else if rewards["BBBB"] != 600 {
+			t.Fatalf("BBBB Reward=%v, want %v", rewards["BBBB"], 600)
+		}
+	})
+}
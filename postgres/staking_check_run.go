@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.StakingCheckRunService = (*StakingCheckRunService)(nil)
+
+type StakingCheckRunService struct {
+	db *pgxpool.Pool
+}
+
+func NewStakingCheckRunService(db *pgxpool.Pool) *StakingCheckRunService {
+	return &StakingCheckRunService{
+		db: db,
+	}
+}
+
+func (s *StakingCheckRunService) FindStakingCheckRuns(ctx context.Context, filter payapi.StakingCheckRunFilter) ([]*payapi.StakingCheckRun, error) {
+	sql := `
+		SELECT id, staking_period_id, created_at
+		FROM staking_check_runs
+		WHERE ($1::INT IS NULL OR staking_period_id = $1)
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*payapi.StakingCheckRun, 0)
+
+	for rows.Next() {
+		var run payapi.StakingCheckRun
+
+		err := rows.Scan(&run.ID, &run.StakingPeriodId, &run.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, &run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *StakingCheckRunService) FindStakingHoldings(ctx context.Context, filter payapi.StakingHoldingFilter) ([]*payapi.StakingHolding, error) {
+	sql := `
+		SELECT h.staking_check_run_id, h.address, h.asset_id, h.amount, r.created_at
+		FROM staking_holding_snapshots h
+		JOIN staking_check_runs r ON r.id = h.staking_check_run_id
+		WHERE ($1::INT IS NULL OR r.staking_period_id = $1)
+		AND ($2::TEXT IS NULL OR h.address = $2)
+		ORDER BY h.address ASC, h.asset_id ASC, r.created_at ASC, r.id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId, filter.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holdings := make([]*payapi.StakingHolding, 0)
+
+	for rows.Next() {
+		var h payapi.StakingHolding
+
+		err := rows.Scan(&h.StakingCheckRunId, &h.Address, &h.AssetId, &h.Amount, &h.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		holdings = append(holdings, &h)
+	}
+
+	return holdings, rows.Err()
+}
+
+func (s *StakingCheckRunService) CreateStakingCheckRun(ctx context.Context, run *payapi.StakingCheckRun) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `
+		INSERT INTO staking_check_runs (staking_period_id, created_at)
+		VALUES ($1, NOW())
+		RETURNING id, created_at
+	`
+
+	err = tx.QueryRow(ctx, sql, run.StakingPeriodId).Scan(&run.ID, &run.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	sql = `
+		INSERT INTO staking_holding_snapshots (staking_check_run_id, address, asset_id, amount)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	for _, h := range run.Holdings {
+		_, err := tx.Exec(ctx, sql, run.ID, h.Address, h.AssetId, h.Amount)
+		if err != nil {
+			return err
+		}
+
+		h.StakingCheckRunId = run.ID
+		h.CreatedAt = run.CreatedAt
+	}
+
+	for _, r := range run.Ratios {
+		r.StakingPeriodId = run.StakingPeriodId
+		r.StakingCheckRunId = &run.ID
+	}
+
+	err = insertStakingAssetRatios(ctx, tx, run.Ratios)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,114 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestStakingCheckRunService_CreateStakingCheckRun(t *testing.T) {
+	// ensure holdings are recorded per run and weight results by what was held
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		s := postgres.NewStakingCheckRunService(db.DB)
+
+		srs := postgres.NewStakingResultService(db.DB)
+		srs.StakingPeriodService = sps
+		srs.StakingCommitmentService = scs
+		srs.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		srs.StakingCheckRunService = s
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, address := range []string{"AAAA", "BBBB"} {
+			err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+				StakingPeriodID: stakingPeriod.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		// nothing to weight by yet
+		_, err = srs.CreateStakingResult(ctx, stakingPeriod.ID, 900, payapi.StakingWeightingMinimum)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// BBBB dropped to half on the second run
+		for _, amount := range []uint64{100, 50} {
+			run := &payapi.StakingCheckRun{
+				StakingPeriodId: stakingPeriod.ID,
+				Holdings: []*payapi.StakingHolding{
+					{Address: "AAAA", AssetId: payapi.StakingRewardAssetId, Amount: 1000}, // more than committed
+					{Address: "BBBB", AssetId: payapi.StakingRewardAssetId, Amount: amount},
+				},
+			}
+
+			err = s.CreateStakingCheckRun(ctx, run)
+			if err != nil {
+				t.Fatal(err)
+			} else if run.ID == 0 {
+				t.Fatal("expected id")
+			}
+		}
+
+		runs, err := s.FindStakingCheckRuns(ctx, payapi.StakingCheckRunFilter{StakingPeriodId: &stakingPeriod.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(runs) != 2 {
+			t.Fatalf("len(runs)=%v, want %v", len(runs), 2)
+		}
+
+		address := "BBBB"
+		holdings, err := s.FindStakingHoldings(ctx, payapi.StakingHoldingFilter{StakingPeriodId: &stakingPeriod.ID, Address: &address})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(holdings) != 2 {
+			t.Fatalf("len(holdings)=%v, want %v", len(holdings), 2)
+		} else if holdings[0].Amount != 100 || holdings[1].Amount != 50 {
+			t.Fatalf("Amounts=%v,%v, want %v,%v", holdings[0].Amount, holdings[1].Amount, 100, 50)
+		}
+
+		// credited 100 and 50
+		res, err := srs.CreateStakingResult(ctx, stakingPeriod.ID, 900, payapi.StakingWeightingMinimum)
+		if err != nil {
+			t.Fatal(err)
+		} else if res.Weighting != payapi.StakingWeightingMinimum {
+			t.Fatalf("Weighting=%v, want %v", res.Weighting, payapi.StakingWeightingMinimum)
+		}
+
+		rewards := make(map[string]uint64)
+		for _, item := range res.Results {
+			rewards[item.Address] = item.Reward
+		}
+
+		if rewards["AAAA"] != 600 {
+			t.Fatalf("AAAA Reward=%v, want %v", rewards["AAAA"], 600)
+		} else if rewards["BBBB"] != 300 {
+			t.Fatalf("BBBB Reward=%v, want %v", rewards["BBBB"], 300)
+		}
+	})
+}
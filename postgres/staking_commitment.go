@@ -3,14 +3,26 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var _ payapi.StakingCommitmentService = (*StakingCommitmentService)(nil)
 
+// every query returning a full commitment selects these from staking_commitments c, in this order
+const stakingCommitmentColumns = `
+	c.id, c.staking_period_id, c.algorand_address, c.created_at, c.updated_at, c.eligible,
+	(
+		SELECT COALESCE(json_agg(json_build_object('assetId', i.asset_id, 'amount', i.amount) ORDER BY i.asset_id), '[]')
+		FROM staking_commitment_items i
+		WHERE i.staking_commitment_id = c.id
+	)
+`
+
 type (
 	StakingCommitmentService struct {
 		db                   *pgxpool.Pool
@@ -24,61 +36,95 @@ func NewStakingCommitmentService(db *pgxpool.Pool) *StakingCommitmentService {
 	}
 }
 
-func (s *StakingCommitmentService) FindStakingCommitments(ctx context.Context, filter payapi.StakingCommitmentFilter) ([]*payapi.StakingCommitment, error) {
-	if filter.StakingPeriodId == nil {
-		return nil, errors.New("invalid parameters")
+func scanStakingCommitment(row pgx.Row) (*payapi.StakingCommitment, error) {
+	sc := &payapi.StakingCommitment{}
+
+	err := row.Scan(
+		&sc.ID,
+		&sc.StakingPeriodID,
+		&sc.AlgorandAddress,
+		&sc.CreatedAt,
+		&sc.UpdatedAt,
+		&sc.Eligible,
+		&sc.Assets,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	stakingPeriodId := *filter.StakingPeriodId
+	return sc, nil
+}
+
+// replaces the commitment's items, every asset must be active in the registry
+func saveStakingCommitmentItems(ctx context.Context, tx pgx.Tx, stakingCommitment *payapi.StakingCommitment) error {
+	_, err := tx.Exec(ctx, `DELETE FROM staking_commitment_items WHERE staking_commitment_id = $1`, stakingCommitment.ID)
+	if err != nil {
+		return err
+	}
 
 	sql := `
-		SELECT id, algorand_address, created_at, updated_at, chip_commitment, liquidity_commitment, liquidity_commitment_v2, c_algo_commitment, t_algo_commitment, m_algo_commitment, x_algo_commitment, eligible
-		FROM staking_commitments
-		WHERE staking_period_id = $1
+		INSERT INTO staking_commitment_items (staking_commitment_id, asset_id, amount)
+		SELECT $1, asset_id, $3
+		FROM staking_assets
+		WHERE asset_id = $2 AND active
+	`
+
+	for _, item := range stakingCommitment.Assets {
+		tag, err := tx.Exec(ctx, sql, stakingCommitment.ID, item.AssetId, item.Amount)
+		if err != nil {
+			return err
+		} else if tag.RowsAffected() == 0 {
+			return fmt.Errorf("asset %d is not accepted for staking", item.AssetId)
+		}
+	}
+
+	return nil
+}
+
+func (s *StakingCommitmentService) FindStakingCommitments(ctx context.Context, filter payapi.StakingCommitmentFilter) ([]*payapi.StakingCommitment, error) {
+	if filter.StakingPeriodId == nil && filter.AlgorandAddress == nil {
+		return nil, errors.New("invalid parameters")
+	}
+
+	sql := `SELECT ` + stakingCommitmentColumns + `
+		FROM staking_commitments c
+		WHERE ($1::INT IS NULL OR c.staking_period_id = $1)
+		AND ($2::TEXT IS NULL OR c.algorand_address = $2)
+		ORDER BY c.staking_period_id ASC, c.id ASC
 	`
 
-	rows, err := s.db.Query(ctx, sql, stakingPeriodId)
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId, filter.AlgorandAddress)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	scs := make([]*payapi.StakingCommitment, 0)
 
 	for rows.Next() {
-		var sc payapi.StakingCommitment
-
-		err := rows.Scan(&sc.ID, &sc.AlgorandAddress, &sc.CreatedAt, &sc.UpdatedAt, &sc.ChipCommitment, &sc.LiquidityCommitment, &sc.LiquidityCommitmentV2, &sc.CAlgoCommitment, &sc.TAlgoCommitment, &sc.MAlgoCommitment, &sc.XAlgoCommitment, &sc.Eligible)
+		sc, err := scanStakingCommitment(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		sc.StakingPeriodID = stakingPeriodId
-
-		scs = append(scs, &sc)
+		scs = append(scs, sc)
 	}
 
-	return scs, nil
+	return scs, rows.Err()
 }
 
 func (s *StakingCommitmentService) FindStakingCommitmentByID(ctx context.Context, id int) (*payapi.StakingCommitment, error) {
-	sql := `
-		SELECT staking_period_id, algorand_address, created_at, updated_at, chip_commitment, liquidity_commitment, liquidity_commitment_v2, c_algo_commitment, t_algo_commitment, m_algo_commitment, x_algo_commitment, eligible
-		FROM staking_commitments
-		WHERE id = $1
-	`
-	sc := &payapi.StakingCommitment{
-		ID: id,
-	}
+	sql := `SELECT ` + stakingCommitmentColumns + ` FROM staking_commitments c WHERE c.id = $1`
 
-	err := s.db.QueryRow(context.Background(), sql, id).Scan(&sc.StakingPeriodID, &sc.AlgorandAddress, &sc.CreatedAt, &sc.UpdatedAt, &sc.ChipCommitment, &sc.LiquidityCommitment, &sc.LiquidityCommitmentV2, &sc.CAlgoCommitment, &sc.TAlgoCommitment, &sc.MAlgoCommitment, &sc.XAlgoCommitment, &sc.Eligible)
-	if err != nil {
-		return nil, err
-	}
-
-	return sc, nil
+	return scanStakingCommitment(s.db.QueryRow(ctx, sql, id))
 }
 
 func (s *StakingCommitmentService) CreateStakingCommitment(ctx context.Context, stakingCommitment *payapi.StakingCommitment) error {
+	err := stakingCommitment.ValidateAssets()
+	if err != nil {
+		return err
+	}
+
 	stakingPeriod, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, stakingCommitment.StakingPeriodID)
 	if err != nil {
 		return err
@@ -94,14 +140,25 @@ func (s *StakingCommitmentService) CreateStakingCommitment(ctx context.Context,
 		return errors.New("registration period has not begun")
 	}
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	// we are within the registration period
 	sql := `
-		INSERT INTO staking_commitments (staking_period_id, algorand_address, created_at, chip_commitment, liquidity_commitment, liquidity_commitment_v2, c_algo_commitment, t_algo_commitment, m_algo_commitment, x_algo_commitment, eligible)
-		VALUES ($1, $2, NOW(), $3, $4, $5, $6, $7, $8, $9, TRUE)
+		INSERT INTO staking_commitments (staking_period_id, algorand_address, created_at, eligible)
+		VALUES ($1, $2, NOW(), TRUE)
 		RETURNING id, created_at
 	`
 
-	err = s.db.QueryRow(ctx, sql, stakingCommitment.StakingPeriodID, stakingCommitment.AlgorandAddress, stakingCommitment.ChipCommitment, stakingCommitment.LiquidityCommitment, stakingCommitment.LiquidityCommitmentV2, stakingCommitment.CAlgoCommitment, stakingCommitment.TAlgoCommitment, stakingCommitment.MAlgoCommitment, stakingCommitment.XAlgoCommitment).Scan(&stakingCommitment.ID, &stakingCommitment.CreatedAt)
+	err = tx.QueryRow(ctx, sql, stakingCommitment.StakingPeriodID, stakingCommitment.AlgorandAddress).Scan(&stakingCommitment.ID, &stakingCommitment.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = saveStakingCommitmentItems(ctx, tx, stakingCommitment)
 	if err != nil {
 		return err
 	}
@@ -109,16 +166,14 @@ func (s *StakingCommitmentService) CreateStakingCommitment(ctx context.Context,
 	// always will be eligible on creation
 	stakingCommitment.Eligible = true
 
-	return nil
+	return tx.Commit(ctx)
 }
 
 func (s *StakingCommitmentService) UpdateStakingCommitment(ctx context.Context, stakingCommitment *payapi.StakingCommitment) error {
-	sql := `
-		UPDATE staking_commitments
-		SET chip_commitment = $1, liquidity_commitment = $2, liquidity_commitment_v2 = $3, c_algo_commitment = $4, t_algo_commitment = $5, m_algo_commitment = $6, x_algo_commitment = $7, created_at = NOW()
-		WHERE id = $8
-		RETURNING staking_period_id, algorand_address, created_at, eligible
-	`
+	err := stakingCommitment.ValidateAssets()
+	if err != nil {
+		return err
+	}
 
 	stakingPeriod, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, stakingCommitment.StakingPeriodID)
 	if err != nil {
@@ -135,31 +190,114 @@ func (s *StakingCommitmentService) UpdateStakingCommitment(ctx context.Context,
 		return errors.New("registration period has not begun")
 	}
 
-	err = s.db.QueryRow(ctx, sql, stakingCommitment.ChipCommitment, stakingCommitment.LiquidityCommitment, stakingCommitment.LiquidityCommitmentV2, stakingCommitment.CAlgoCommitment, stakingCommitment.TAlgoCommitment, stakingCommitment.MAlgoCommitment, stakingCommitment.XAlgoCommitment, stakingCommitment.ID).Scan(&stakingCommitment.StakingPeriodID, &stakingCommitment.AlgorandAddress, &stakingCommitment.CreatedAt, &stakingCommitment.Eligible)
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	sql := `
+		UPDATE staking_commitments
+		SET created_at = NOW()
+		WHERE id = $1
+		RETURNING staking_period_id, algorand_address, created_at, eligible
+	`
+
+	err = tx.QueryRow(ctx, sql, stakingCommitment.ID).Scan(&stakingCommitment.StakingPeriodID, &stakingCommitment.AlgorandAddress, &stakingCommitment.CreatedAt, &stakingCommitment.Eligible)
+	if err != nil {
+		return err
+	}
+
+	err = saveStakingCommitmentItems(ctx, tx, stakingCommitment)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *StakingCommitmentService) UpdateEligibility(ctx context.Context, id int, eligible bool) (*payapi.StakingCommitment, error) {
+func (s *StakingCommitmentService) UpdateEligibility(ctx context.Context, id int, event *payapi.EligibilityEvent) (*payapi.StakingCommitment, error) {
+	err := event.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
 	sql := `
 		UPDATE staking_commitments
 		SET eligible = $1, updated_at = NOW()
-		WHERE id = $2
-		RETURNING staking_period_id, algorand_address, created_at, updated_at, chip_commitment, liquidity_commitment, liquidity_commitment_v2, c_algo_commitment, t_algo_commitment, m_algo_commitment, x_algo_commitment
+		WHERE id = $2 AND eligible <> $1
 	`
 
-	sc := &payapi.StakingCommitment{
-		ID:       id,
-		Eligible: eligible,
+	tag, err := tx.Exec(ctx, sql, event.Eligible, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// already as asked, or not there at all
+	if tag.RowsAffected() == 0 {
+		sc, err := s.FindStakingCommitmentByID(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, payapi.ErrStakingCommitmentNotFound
+		}
+		return sc, err
 	}
 
-	err := s.db.QueryRow(ctx, sql, eligible, id).Scan(&sc.StakingPeriodID, &sc.AlgorandAddress, &sc.CreatedAt, &sc.UpdatedAt, &sc.ChipCommitment, &sc.LiquidityCommitment, &sc.LiquidityCommitmentV2, &sc.CAlgoCommitment, &sc.TAlgoCommitment, &sc.MAlgoCommitment, &sc.XAlgoCommitment)
+	sql = `
+		INSERT INTO eligibility_events (staking_commitment_id, eligible, source, reason, staking_check_run_id, asset_id, committed, balance, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING id, created_at
+	`
+
+	event.StakingCommitmentId = id
+
+	err = tx.QueryRow(ctx, sql, id, event.Eligible, event.Source, event.Reason, event.StakingCheckRunId, event.AssetId, event.Committed, event.Balance).Scan(&event.ID, &event.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	return sc, nil
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindStakingCommitmentByID(ctx, id)
+}
+
+func (s *StakingCommitmentService) FindEligibilityEvents(ctx context.Context, filter payapi.EligibilityEventFilter) ([]*payapi.EligibilityEvent, error) {
+	sql := `
+		SELECT e.id, e.staking_commitment_id, e.eligible, e.source, e.reason, e.staking_check_run_id, e.asset_id, e.committed, e.balance, e.created_at
+		FROM eligibility_events e
+		JOIN staking_commitments c ON c.id = e.staking_commitment_id
+		WHERE ($1::INT IS NULL OR e.staking_commitment_id = $1)
+		AND ($2::INT IS NULL OR c.staking_period_id = $2)
+		AND ($3::TEXT IS NULL OR c.algorand_address = $3)
+		ORDER BY e.created_at ASC, e.id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingCommitmentId, filter.StakingPeriodId, filter.AlgorandAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*payapi.EligibilityEvent, 0)
+
+	for rows.Next() {
+		var e payapi.EligibilityEvent
+
+		err := rows.Scan(&e.ID, &e.StakingCommitmentId, &e.Eligible, &e.Source, &e.Reason, &e.StakingCheckRunId, &e.AssetId, &e.Committed, &e.Balance, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &e)
+	}
+
+	return events, rows.Err()
 }
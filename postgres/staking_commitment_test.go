@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -9,6 +10,34 @@ import (
 	"github.com/algo-casino/payapi/postgres"
 )
 
+// assets seeded into the staking asset registry by migration
+var testStakingAssetIds = []uint64{388592191, 552665159, 1002609713, 2562903034, 2545480441, 2536627349, 2520645026}
+
+// one item per seeded asset, amounts n, 2n, 3n...
+func testStakingCommitmentItems(n uint64) []*payapi.StakingCommitmentItem {
+	items := make([]*payapi.StakingCommitmentItem, 0, len(testStakingAssetIds))
+
+	for i, assetId := range testStakingAssetIds {
+		items = append(items, &payapi.StakingCommitmentItem{AssetId: assetId, Amount: n * uint64(i+1)})
+	}
+
+	return items
+}
+
+func checkStakingCommitmentItems(t *testing.T, sc *payapi.StakingCommitment, n uint64) {
+	t.Helper()
+
+	if len(sc.Assets) != len(testStakingAssetIds) {
+		t.Fatalf("len(Assets)=%v, want %v", len(sc.Assets), len(testStakingAssetIds))
+	}
+
+	for i, assetId := range testStakingAssetIds {
+		if amount := sc.AssetAmount(assetId); amount != n*uint64(i+1) {
+			t.Fatalf("AssetAmount(%d)=%v, want %v", assetId, amount, n*uint64(i+1))
+		}
+	}
+}
+
 func TestStakingCommitmentService_CreateStakingCommitment(t *testing.T) {
 	// ensure a platform can be created
 
@@ -35,14 +64,8 @@ func TestStakingCommitmentService_CreateStakingCommitment(t *testing.T) {
 		}
 
 		sc := &payapi.StakingCommitment{
-			StakingPeriodID:       stakingPeriod.ID,
-			ChipCommitment:        10,
-			LiquidityCommitment:   20,
-			LiquidityCommitmentV2: 30,
-			CAlgoCommitment:       40,
-			TAlgoCommitment:       50,
-			MAlgoCommitment:       60,
-			XAlgoCommitment:       70,
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          testStakingCommitmentItems(10),
 		}
 
 		err = scs.CreateStakingCommitment(ctx, sc)
@@ -50,22 +73,13 @@ func TestStakingCommitmentService_CreateStakingCommitment(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		if sc.ChipCommitment != 10 {
-			t.Fatalf("ChipCommitment=%v, want %v", sc.ChipCommitment, 10)
-		} else if sc.LiquidityCommitment != 20 {
-			t.Fatalf("LiquidityCommitment=%v, want %v", sc.LiquidityCommitment, 20)
-		} else if sc.LiquidityCommitmentV2 != 30 {
-			t.Fatalf("LiquidityCommitmentV2=%v, want %v", sc.LiquidityCommitmentV2, 30)
-		} else if sc.CAlgoCommitment != 40 {
-			t.Fatalf("CAlgoCommitment=%v, want %v", sc.CAlgoCommitment, 40)
-		} else if sc.TAlgoCommitment != 50 {
-			t.Fatalf("TAlgoCommitment=%v, want %v", sc.TAlgoCommitment, 50)
-		} else if sc.MAlgoCommitment != 60 {
-			t.Fatalf("MAlgoCommitment=%v, want %v", sc.MAlgoCommitment, 60)
-		} else if sc.XAlgoCommitment != 70 {
-			t.Fatalf("XAlgoCommitment=%v, want %v", sc.XAlgoCommitment, 70)
+		found, err := scs.FindStakingCommitmentByID(ctx, sc.ID)
+		if err != nil {
+			t.Fatal(err)
 		}
 
+		checkStakingCommitmentItems(t, found, 10)
+
 	})
 
 	t.Run("ErrBadParameters", func(t *testing.T) {
@@ -89,6 +103,43 @@ func TestStakingCommitmentService_CreateStakingCommitment(t *testing.T) {
 			t.Fatal("expected error")
 		}
 	})
+
+	t.Run("ErrAssetNotAccepted", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingPeriodService(db.DB)
+		scs := postgres.NewStakingCommitmentService(db.DB)
+
+		scs.StakingPeriodService = s
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := s.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// not in the registry
+		err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          []*payapi.StakingCommitmentItem{{AssetId: 1337, Amount: 10}},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// same asset twice
+		err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          []*payapi.StakingCommitmentItem{{AssetId: 388592191, Amount: 10}, {AssetId: 388592191, Amount: 20}},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
 }
 
 func TestStakingCommitmentService_UpdateStakingCommitment(t *testing.T) {
@@ -117,14 +168,8 @@ func TestStakingCommitmentService_UpdateStakingCommitment(t *testing.T) {
 		}
 
 		sc := &payapi.StakingCommitment{
-			StakingPeriodID:       stakingPeriod.ID,
-			ChipCommitment:        10,
-			LiquidityCommitment:   20,
-			LiquidityCommitmentV2: 30,
-			CAlgoCommitment:       40,
-			TAlgoCommitment:       50,
-			MAlgoCommitment:       60,
-			XAlgoCommitment:       70,
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          testStakingCommitmentItems(10),
 		}
 
 		err = scs.CreateStakingCommitment(ctx, sc)
@@ -132,34 +177,19 @@ func TestStakingCommitmentService_UpdateStakingCommitment(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		sc.ChipCommitment = 11
-		sc.LiquidityCommitment = 22
-		sc.LiquidityCommitmentV2 = 33
-		sc.CAlgoCommitment = 44
-		sc.TAlgoCommitment = 55
-		sc.MAlgoCommitment = 66
-		sc.XAlgoCommitment = 77
+		sc.Assets = testStakingCommitmentItems(11)
 
 		err = scs.UpdateStakingCommitment(ctx, sc)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if sc.ChipCommitment != 11 {
-			t.Fatalf("ChipCommitment=%v, want %v", sc.ChipCommitment, 11)
-		} else if sc.LiquidityCommitment != 22 {
-			t.Fatalf("LiquidityCommitment=%v, want %v", sc.LiquidityCommitment, 22)
-		} else if sc.LiquidityCommitmentV2 != 33 {
-			t.Fatalf("LiquidityCommitmentV2=%v, want %v", sc.LiquidityCommitmentV2, 33)
-		} else if sc.CAlgoCommitment != 44 {
-			t.Fatalf("CAlgoCommitment=%v, want %v", sc.CAlgoCommitment, 44)
-		} else if sc.TAlgoCommitment != 55 {
-			t.Fatalf("TAlgoCommitment=%v, want %v", sc.TAlgoCommitment, 55)
-		} else if sc.MAlgoCommitment != 66 {
-			t.Fatalf("MAlgoCommitment=%v, want %v", sc.MAlgoCommitment, 66)
-		} else if sc.XAlgoCommitment != 77 {
-			t.Fatalf("XAlgoCommitment=%v, want %v", sc.XAlgoCommitment, 77)
+		found, err := scs.FindStakingCommitmentByID(ctx, sc.ID)
+		if err != nil {
+			t.Fatal(err)
 		}
+
+		checkStakingCommitmentItems(t, found, 11)
 	})
 
 	t.Run("ErrBadParameters", func(t *testing.T) {
@@ -179,14 +209,8 @@ func TestStakingCommitmentService_UpdateStakingCommitment(t *testing.T) {
 		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
 
 		sc := &payapi.StakingCommitment{
-			StakingPeriodID:       stakingPeriod.ID,
-			ChipCommitment:        10,
-			LiquidityCommitment:   20,
-			LiquidityCommitmentV2: 30,
-			CAlgoCommitment:       40,
-			TAlgoCommitment:       50,
-			MAlgoCommitment:       60,
-			XAlgoCommitment:       70,
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          testStakingCommitmentItems(10),
 		}
 
 		err := scs.CreateStakingCommitment(ctx, sc)
@@ -227,14 +251,8 @@ func TestStakingCommitmentService_UpdateEligibility(t *testing.T) {
 		}
 
 		sc := &payapi.StakingCommitment{
-			StakingPeriodID:       stakingPeriod.ID,
-			ChipCommitment:        10,
-			LiquidityCommitment:   20,
-			LiquidityCommitmentV2: 30,
-			CAlgoCommitment:       40,
-			TAlgoCommitment:       50,
-			MAlgoCommitment:       60,
-			XAlgoCommitment:       70,
+			StakingPeriodID: stakingPeriod.ID,
+			Assets:          testStakingCommitmentItems(10),
 		}
 
 		err = scs.CreateStakingCommitment(ctx, sc)
@@ -242,25 +260,64 @@ func TestStakingCommitmentService_UpdateEligibility(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		newSc, err := scs.UpdateEligibility(ctx, sc.ID, false)
+		assetId := uint64(1)
+		committed := uint64(10)
+		balance := uint64(4)
+
+		newSc, err := scs.UpdateEligibility(ctx, sc.ID, &payapi.EligibilityEvent{
+			Eligible:  false,
+			Source:    payapi.EligibilitySourceCheck,
+			Reason:    "committed 10, holds 4",
+			AssetId:   &assetId,
+			Committed: &committed,
+			Balance:   &balance,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if newSc.Eligible {
+			t.Fatalf("Eligible=%v, want %v", newSc.Eligible, false)
+		}
+
+		checkStakingCommitmentItems(t, newSc, 10)
+
+		// already ineligible, nothing recorded
+		_, err = scs.UpdateEligibility(ctx, sc.ID, &payapi.EligibilityEvent{Eligible: false, Source: payapi.EligibilitySourceCheck, Reason: "again"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		newSc, err = scs.UpdateEligibility(ctx, sc.ID, &payapi.EligibilityEvent{Eligible: true, Source: payapi.EligibilitySourceAdmin, Reason: "indexer outage"})
+		if err != nil {
+			t.Fatal(err)
+		} else if !newSc.Eligible {
+			t.Fatalf("Eligible=%v, want %v", newSc.Eligible, true)
+		}
+
+		events, err := scs.FindEligibilityEvents(ctx, payapi.EligibilityEventFilter{StakingPeriodId: &stakingPeriod.ID})
 		if err != nil {
 			t.Fatal(err)
+		} else if len(events) != 2 {
+			t.Fatalf("len(events)=%d, want %d", len(events), 2)
 		}
 
-		if newSc.ChipCommitment != 10 {
-			t.Fatalf("ChipCommitment=%v, want %v", newSc.ChipCommitment, 10)
-		} else if newSc.LiquidityCommitment != 20 {
-			t.Fatalf("LiquidityCommitment=%v, want %v", newSc.LiquidityCommitment, 20)
-		} else if newSc.LiquidityCommitmentV2 != 30 {
-			t.Fatalf("LiquidityCommitmentV2=%v, want %v", newSc.LiquidityCommitmentV2, 30)
-		} else if newSc.CAlgoCommitment != 40 {
-			t.Fatalf("CAlgoCommitment=%v, want %v", newSc.CAlgoCommitment, 40)
-		} else if newSc.TAlgoCommitment != 50 {
-			t.Fatalf("TAlgoCommitment=%v, want %v", newSc.TAlgoCommitment, 50)
-		} else if newSc.MAlgoCommitment != 60 {
-			t.Fatalf("MAlgoCommitment=%v, want %v", newSc.MAlgoCommitment, 60)
-		} else if newSc.XAlgoCommitment != 70 {
-			t.Fatalf("XAlgoCommitment=%v, want %v", newSc.XAlgoCommitment, 70)
+		if e := events[0]; e.Eligible || e.Source != payapi.EligibilitySourceCheck || e.Balance == nil || *e.Balance != balance || e.StakingCommitmentId != sc.ID {
+			t.Fatalf("unexpected first event %+v", e)
+		} else if e := events[1]; !e.Eligible || e.Source != payapi.EligibilitySourceAdmin || e.AssetId != nil {
+			t.Fatalf("unexpected second event %+v", e)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+
+		_, err := scs.UpdateEligibility(context.Background(), 1, &payapi.EligibilityEvent{Eligible: true, Source: payapi.EligibilitySourceAdmin, Reason: "test"})
+		if !errors.Is(err, payapi.ErrStakingCommitmentNotFound) {
+			t.Fatalf("err=%v, want %v", err, payapi.ErrStakingCommitmentNotFound)
 		}
 	})
 }
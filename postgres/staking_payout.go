@@ -0,0 +1,408 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.StakingPayoutService = (*StakingPayoutService)(nil)
+
+const (
+	stakingPayoutValidRounds = 200 // ~10 minutes, after which an unconfirmed group is failed and can be resent
+	stakingPayoutMaxAttempts = 5   // failed payouts are retried this many times unless forced
+)
+
+// every query returning a full payout selects these, in this order
+const stakingPayoutColumns = `
+	id, staking_period_id, staking_result_id, address, asset_id, amount, status, attempts,
+	group_id, transaction_id, last_valid_round, failure_reason, created_at, sent_at, confirmed_at, failed_at
+`
+
+type StakingPayoutService struct {
+	db                   *pgxpool.Pool
+	StakingResultService payapi.StakingResultService
+	IndexerService       algo.IndexerService
+
+	// house account paying out rewards, only required to distribute
+	AccountService *algo.AccountService
+}
+
+func NewStakingPayoutService(db *pgxpool.Pool) *StakingPayoutService {
+	return &StakingPayoutService{
+		db: db,
+	}
+}
+
+func scanStakingPayout(row pgx.Row) (*payapi.StakingPayout, error) {
+	p := &payapi.StakingPayout{}
+
+	err := row.Scan(
+		&p.ID,
+		&p.StakingPeriodId,
+		&p.StakingResultId,
+		&p.Address,
+		&p.AssetId,
+		&p.Amount,
+		&p.Status,
+		&p.Attempts,
+		&p.GroupID,
+		&p.TransactionID,
+		&p.LastValidRound,
+		&p.FailureReason,
+		&p.CreatedAt,
+		&p.SentAt,
+		&p.ConfirmedAt,
+		&p.FailedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *StakingPayoutService) FindStakingPayouts(ctx context.Context, filter payapi.StakingPayoutFilter) ([]*payapi.StakingPayout, error) {
+	sql := `SELECT ` + stakingPayoutColumns + `
+		FROM staking_payouts
+		WHERE ($1::INT IS NULL OR staking_period_id = $1) AND ($2::INT IS NULL OR status = $2)
+		AND ($3::TEXT IS NULL OR address = $3)
+		ORDER BY id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.StakingPeriodId, filter.Status, filter.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := make([]*payapi.StakingPayout, 0)
+
+	for rows.Next() {
+		p, err := scanStakingPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		payouts = append(payouts, p)
+	}
+
+	return payouts, rows.Err()
+}
+
+func (s *StakingPayoutService) QueueStakingPayouts(ctx context.Context, stakingPeriodId int) (*payapi.StakingDistribution, error) {
+	dist := &payapi.StakingDistribution{
+		StakingPeriodId: stakingPeriodId,
+		Warnings:        make([]string, 0),
+	}
+
+	err := s.createStakingPayouts(ctx, dist)
+	if err != nil {
+		return nil, err
+	}
+
+	// asked for by hand, so past the automatic retry limit too
+	err = s.retryFailedStakingPayouts(ctx, dist, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return dist, s.countRemainingStakingPayouts(ctx, dist)
+}
+
+func (s *StakingPayoutService) DistributeStakingPayouts(ctx context.Context, stakingPeriodId int) (*payapi.StakingDistribution, error) {
+	if s.AccountService == nil {
+		return nil, errors.New("no house account configured")
+	}
+
+	dist := &payapi.StakingDistribution{
+		StakingPeriodId: stakingPeriodId,
+		Warnings:        make([]string, 0),
+	}
+
+	// settle what was sent last time before sending anything new
+	err := s.checkSentStakingPayouts(ctx, dist)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.retryFailedStakingPayouts(ctx, dist, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// a group at a time until nothing is left pending
+	for {
+		n, err := s.sendStakingPayoutGroup(ctx, dist)
+		if err != nil {
+			return dist, err
+		} else if n == 0 {
+			break
+		}
+	}
+
+	return dist, s.countRemainingStakingPayouts(ctx, dist)
+}
+
+func (s *StakingPayoutService) countRemainingStakingPayouts(ctx context.Context, dist *payapi.StakingDistribution) error {
+	sql := `SELECT COUNT(*) FROM staking_payouts WHERE staking_period_id = $1 AND status <> $2`
+
+	return s.db.QueryRow(ctx, sql, dist.StakingPeriodId, payapi.StakingPayoutStatusConfirmed).Scan(&dist.Remaining)
+}
+
+// a pending payout per rewarded address of the period's result, created once
+func (s *StakingPayoutService) createStakingPayouts(ctx context.Context, dist *payapi.StakingDistribution) error {
+	results, err := s.StakingResultService.FindStakingResults(ctx, payapi.StakingResultFilter{StakingPeriodId: &dist.StakingPeriodId})
+	if err != nil {
+		return err
+	} else if len(results) == 0 {
+		return errors.New("staking period has no result")
+	}
+
+	result := results[0]
+
+	// never pay out more than was made
+	total := uint64(0)
+	for _, item := range result.Results {
+		total += item.Reward
+	}
+
+	if total+result.HouseFee+result.Unallocated > result.Profit {
+		return fmt.Errorf("rewards total %d with house fee %d exceeds profit %d", total, result.HouseFee, result.Profit)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `
+		INSERT INTO staking_payouts (staking_period_id, staking_result_id, address, asset_id, amount, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (staking_result_id, address) DO NOTHING
+	`
+
+	for _, item := range result.Results {
+		amount := item.Reward
+		if amount == 0 {
+			continue
+		}
+
+		tag, err := tx.Exec(ctx, sql, dist.StakingPeriodId, result.ID, item.Address, payapi.StakingRewardAssetId, amount, payapi.StakingPayoutStatusPending)
+		if err != nil {
+			return err
+		}
+
+		dist.Created += int(tag.RowsAffected())
+	}
+
+	return tx.Commit(ctx)
+}
+
+// confirms sent payouts found on chain, fails ones whose group can no longer be confirmed
+func (s *StakingPayoutService) checkSentStakingPayouts(ctx context.Context, dist *payapi.StakingDistribution) error {
+	status := payapi.StakingPayoutStatusSent
+
+	sent, err := s.FindStakingPayouts(ctx, payapi.StakingPayoutFilter{StakingPeriodId: &dist.StakingPeriodId, Status: &status})
+	if err != nil {
+		return err
+	} else if len(sent) == 0 {
+		return nil
+	}
+
+	// a missing txn only means it never landed once the indexer is past its last valid round
+	indexed, err := s.IndexerService.LatestRound(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range sent {
+		t, err := s.IndexerService.GetTransfer(ctx, *p.TransactionID)
+		if errors.Is(err, algo.ErrTransactionNotFound) && indexed > *p.LastValidRound {
+			err = s.failStakingPayout(ctx, p, "group expired without confirming")
+			if err != nil {
+				return err
+			}
+			dist.Failed++
+			continue
+		} else if err != nil {
+			// not indexed yet, check again next run
+			continue
+		}
+
+		if t.Sender != s.AccountService.AccountAddress || t.Receiver != p.Address || t.AssetId != p.AssetId || t.Amount != p.Amount {
+			// left sent, resending could pay twice
+			dist.Warnings = append(dist.Warnings, fmt.Sprintf("staking payout %d txid: %s does not match what was sent, needs looking at by hand", p.ID, *p.TransactionID))
+			continue
+		}
+
+		sql := `
+			UPDATE staking_payouts
+			SET status = $1, confirmed_at = NOW()
+			WHERE id = $2 AND status = $3 AND transaction_id = $4
+		`
+
+		_, err = s.db.Exec(ctx, sql, payapi.StakingPayoutStatusConfirmed, p.ID, payapi.StakingPayoutStatusSent, *p.TransactionID)
+		if err != nil {
+			return err
+		}
+		dist.Confirmed++
+	}
+
+	return nil
+}
+
+func (s *StakingPayoutService) failStakingPayout(ctx context.Context, p *payapi.StakingPayout, reason string) error {
+	sql := `
+		UPDATE staking_payouts
+		SET status = $1, failure_reason = $2, failed_at = NOW()
+		WHERE id = $3 AND status = $4
+	`
+
+	_, err := s.db.Exec(ctx, sql, payapi.StakingPayoutStatusFailed, reason, p.ID, p.Status)
+	return err
+}
+
+// failed payouts never landed, so they can go out again
+func (s *StakingPayoutService) retryFailedStakingPayouts(ctx context.Context, dist *payapi.StakingDistribution, force bool) error {
+	sql := `
+		UPDATE staking_payouts
+		SET status = $1
+		WHERE staking_period_id = $2 AND status = $3 AND ($4 OR attempts < $5)
+	`
+
+	tag, err := s.db.Exec(ctx, sql, payapi.StakingPayoutStatusPending, dist.StakingPeriodId, payapi.StakingPayoutStatusFailed, force, stakingPayoutMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	dist.Retried = int(tag.RowsAffected())
+
+	return nil
+}
+
+// claims up to a group's worth of pending payouts, records them as sent then broadcasts them
+// returns how many payouts were claimed, zero when none are left
+func (s *StakingPayoutService) sendStakingPayoutGroup(ctx context.Context, dist *payapi.StakingDistribution) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `SELECT ` + stakingPayoutColumns + `
+		FROM staking_payouts
+		WHERE staking_period_id = $1 AND status = $2
+		ORDER BY id ASC
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.Query(ctx, sql, dist.StakingPeriodId, payapi.StakingPayoutStatusPending, algo.MaxGroupSize)
+	if err != nil {
+		return 0, err
+	}
+
+	claimed := make([]*payapi.StakingPayout, 0, algo.MaxGroupSize)
+
+	for rows.Next() {
+		p, err := scanStakingPayout(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		claimed = append(claimed, p)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	} else if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	payouts := make([]*payapi.StakingPayout, 0, len(claimed))
+	transfers := make([]algo.GroupTransfer, 0, len(claimed))
+
+	for _, p := range claimed {
+		// one receiver that can't hold the asset would sink the whole group
+		_, err := s.AccountService.NodeService.CheckAssetBalance(ctx, p.Address, p.AssetId)
+		if errors.Is(err, algo.ErrAssetNotOptedIn) {
+			sql := `
+				UPDATE staking_payouts
+				SET status = $1, attempts = attempts + 1, failure_reason = $2, failed_at = NOW()
+				WHERE id = $3
+			`
+
+			_, err = tx.Exec(ctx, sql, payapi.StakingPayoutStatusFailed, fmt.Sprintf("receiver has not opted in to asset %d", p.AssetId), p.ID)
+			if err != nil {
+				return 0, err
+			}
+			dist.Failed++
+			continue
+		} else if err != nil {
+			// couldn't tell, left pending for the next run
+			return 0, fmt.Errorf("CheckAssetBalance() %s failed: %w", p.Address, err)
+		}
+
+		payouts = append(payouts, p)
+		transfers = append(transfers, algo.GroupTransfer{
+			Receiver: p.Address,
+			AssetId:  p.AssetId,
+			Amount:   p.Amount,
+			Note:     []byte(fmt.Sprintf("staking period %d reward", p.StakingPeriodId)),
+		})
+	}
+
+	if len(transfers) == 0 {
+		return len(claimed), tx.Commit(ctx)
+	}
+
+	group, err := s.AccountService.SignTransferGroup(ctx, transfers, stakingPayoutValidRounds)
+	if err != nil {
+		return 0, err
+	}
+
+	// recorded before broadcasting, so whatever happens next the txids can be checked before anything is resent
+	sql = `
+		UPDATE staking_payouts
+		SET status = $1, attempts = attempts + 1, group_id = $2, transaction_id = $3, last_valid_round = $4, failure_reason = NULL, sent_at = NOW()
+		WHERE id = $5
+	`
+
+	for i, p := range payouts {
+		_, err := tx.Exec(ctx, sql, payapi.StakingPayoutStatusSent, group.GroupID, group.TxIDs[i], group.LastValidRound, p.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.AccountService.SendSignedGroup(ctx, group)
+	if err != nil {
+		// left sent, it's failed once its last valid round passes without it on chain
+		_, uerr := s.db.Exec(ctx, `UPDATE staking_payouts SET failure_reason = $1 WHERE group_id = $2`, fmt.Sprintf("failed to broadcast: %v", err), group.GroupID)
+		if uerr != nil {
+			dist.Warnings = append(dist.Warnings, fmt.Sprintf("group %s failed to broadcast, saving why failed err: %v", group.GroupID, uerr))
+		}
+
+		return 0, fmt.Errorf("failed to broadcast group %s: %w", group.GroupID, err)
+	}
+
+	dist.Sent += len(payouts)
+	dist.Groups++
+
+	return len(claimed), nil
+}
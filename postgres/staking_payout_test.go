@@ -0,0 +1,112 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+	"github.com/algo-casino/payapi/reward"
+)
+
+func TestStakingPayoutService_QueueStakingPayouts(t *testing.T) {
+	// ensure a result is queued for payout once, however many times it's asked for
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		srs := postgres.NewStakingResultService(db.DB)
+		srs.StakingPeriodService = sps
+		srs.StakingCommitmentService = scs
+		srs.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		srs.StakingCheckRunService = postgres.NewStakingCheckRunService(db.DB)
+
+		s := postgres.NewStakingPayoutService(db.DB)
+		s.StakingResultService = srs
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// no result yet
+		_, err = s.QueueStakingPayouts(ctx, stakingPeriod.ID)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+			StakingPeriodID: stakingPeriod.ID,
+			AlgorandAddress: "AAAA",
+			Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 1000}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		// 10% to the house
+		srs.RewardPolicy = reward.Policy{HouseFeeBps: 1000}
+
+		res, err := srs.CreateStakingResult(ctx, stakingPeriod.ID, 5000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if res.HouseFee != 500 {
+			t.Fatalf("HouseFee=%v, want %v", res.HouseFee, 500)
+		}
+
+		dist, err := s.QueueStakingPayouts(ctx, stakingPeriod.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if dist.Created != 1 {
+			t.Fatalf("Created=%v, want %v", dist.Created, 1)
+		} else if dist.Remaining != 1 {
+			t.Fatalf("Remaining=%v, want %v", dist.Remaining, 1)
+		}
+
+		// resumed, nothing new
+		dist, err = s.QueueStakingPayouts(ctx, stakingPeriod.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if dist.Created != 0 {
+			t.Fatalf("Created=%v, want %v", dist.Created, 0)
+		}
+
+		payouts, err := s.FindStakingPayouts(ctx, payapi.StakingPayoutFilter{StakingPeriodId: &stakingPeriod.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(payouts) != 1 {
+			t.Fatalf("len(payouts)=%v, want %v", len(payouts), 1)
+		} else if payouts[0].Address != "AAAA" {
+			t.Fatalf("Address=%v, want %v", payouts[0].Address, "AAAA")
+		} else if payouts[0].Amount != 4500 {
+			t.Fatalf("Amount=%v, want %v", payouts[0].Amount, 4500)
+		} else if payouts[0].Status != payapi.StakingPayoutStatusPending {
+			t.Fatalf("Status=%v, want %v", payouts[0].Status, payapi.StakingPayoutStatusPending)
+		}
+	})
+
+	t.Run("ErrNoHouseAccount", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		s := postgres.NewStakingPayoutService(db.DB)
+
+		_, err := s.DistributeStakingPayouts(context.Background(), 1)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -3,16 +3,26 @@ package postgres
 import (
 	"context"
 	"errors"
+	"log"
+	"time"
 
 	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 var _ payapi.StakingPeriodService = (*StakingPeriodService)(nil)
 
+// every query returning a full staking period selects these, in this order
+const stakingPeriodColumns = `id, registration_begin, registration_end, commitment_begin, commitment_end, chip_ratio, funding_games, closed_at`
+
 type (
 	StakingPeriodService struct {
 		db *pgxpool.Pool
+
+		// pooled assets are priced when a period is created, if set
+		StakingPricingService payapi.StakingPricingService
+		StakingAssetService   payapi.StakingAssetService
 	}
 )
 
@@ -22,47 +32,57 @@ func NewStakingPeriodService(db *pgxpool.Pool) *StakingPeriodService {
 	}
 }
 
+func scanStakingPeriod(row pgx.Row) (*payapi.StakingPeriod, error) {
+	sp := &payapi.StakingPeriod{}
+
+	err := row.Scan(&sp.ID, &sp.RegistrationBegin, &sp.RegistrationEnd, &sp.CommitmentBegin, &sp.CommitmentEnd, &sp.ChipRatio, &sp.FundingGames, &sp.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	sp.Status = sp.StatusAt(time.Now().UTC())
+
+	return sp, nil
+}
+
 func (s *StakingPeriodService) FindStakingPeriods(ctx context.Context, filter payapi.StakingPeriodFilter) ([]*payapi.StakingPeriod, error) {
 	sql := `
-		SELECT id, registration_begin, registration_end, commitment_begin, commitment_end, chip_ratio
+		SELECT ` + stakingPeriodColumns + `
 		FROM staking_periods
-		ORDER BY id ASC 
+		ORDER BY id ASC
 	`
 
 	rows, err := s.db.Query(ctx, sql)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	sps := make([]*payapi.StakingPeriod, 0)
 
 	for rows.Next() {
-		var sp payapi.StakingPeriod
-
-		err := rows.Scan(&sp.ID, &sp.RegistrationBegin, &sp.RegistrationEnd, &sp.CommitmentBegin, &sp.CommitmentEnd, &sp.ChipRatio)
+		sp, err := scanStakingPeriod(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		sps = append(sps, &sp)
+		sps = append(sps, sp)
 	}
 
-	return sps, nil
+	return sps, rows.Err()
 }
 
 func (s *StakingPeriodService) FindStakingPeriodByID(ctx context.Context, id int) (*payapi.StakingPeriod, error) {
-	sp := &payapi.StakingPeriod{
-		ID: id,
-	}
-
 	sql := `
-		SELECT registration_begin, registration_end, commitment_begin, commitment_end, chip_ratio
+		SELECT ` + stakingPeriodColumns + `
 		FROM staking_periods
 		WHERE id = $1
 	`
 
-	err := s.db.QueryRow(context.Background(), sql, id).Scan(&sp.RegistrationBegin, &sp.RegistrationEnd, &sp.CommitmentBegin, &sp.CommitmentEnd, &sp.ChipRatio)
-	if err != nil {
+	sp, err := scanStakingPeriod(s.db.QueryRow(ctx, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, payapi.ErrStakingPeriodNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -70,25 +90,99 @@ func (s *StakingPeriodService) FindStakingPeriodByID(ctx context.Context, id int
 }
 
 func (s *StakingPeriodService) CreateStakingPeriod(ctx context.Context, stakingPeriod *payapi.StakingPeriod) error {
-	if stakingPeriod == nil ||
-		stakingPeriod.RegistrationBegin.IsZero() ||
-		stakingPeriod.RegistrationEnd.IsZero() ||
-		stakingPeriod.CommitmentBegin.IsZero() ||
-		stakingPeriod.CommitmentEnd.IsZero() ||
-		stakingPeriod.ChipRatio <= 0 {
+	if stakingPeriod == nil {
 		return errors.New("invalid parameters")
+	} else if err := stakingPeriod.Validate(); err != nil {
+		return err
 	}
 
 	sql := `
-		INSERT INTO staking_periods (registration_begin, registration_end, commitment_begin, commitment_end, chip_ratio)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO staking_periods (registration_begin, registration_end, commitment_begin, commitment_end, chip_ratio, funding_games)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
 	`
 
-	err := s.db.QueryRow(ctx, sql, stakingPeriod.RegistrationBegin, stakingPeriod.RegistrationEnd, stakingPeriod.CommitmentBegin, stakingPeriod.CommitmentEnd, stakingPeriod.ChipRatio).Scan(&stakingPeriod.ID)
+	err := s.db.QueryRow(ctx, sql, stakingPeriod.RegistrationBegin, stakingPeriod.RegistrationEnd, stakingPeriod.CommitmentBegin, stakingPeriod.CommitmentEnd, stakingPeriod.ChipRatio, stakingPeriod.FundingGames).Scan(&stakingPeriod.ID)
 	if err != nil {
 		return err
 	}
 
+	stakingPeriod.Status = stakingPeriod.StatusAt(time.Now().UTC())
+
+	// check runs price them again, the period's chip ratio stands in until then
+	if s.StakingPricingService != nil {
+		err = s.recordStakingAssetRatios(ctx, stakingPeriod.ID)
+		if err != nil {
+			log.Printf("failed to price staking assets for period %d err: %v\n", stakingPeriod.ID, err)
+		}
+	}
+
 	return nil
 }
+
+func (s *StakingPeriodService) recordStakingAssetRatios(ctx context.Context, stakingPeriodId int) error {
+	ratios, err := s.StakingPricingService.PriceStakingAssets(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range ratios {
+		r.StakingPeriodId = stakingPeriodId
+	}
+
+	return s.StakingAssetService.CreateStakingAssetRatios(ctx, ratios)
+}
+
+func (s *StakingPeriodService) UpdateStakingPeriod(ctx context.Context, stakingPeriod *payapi.StakingPeriod) error {
+	if stakingPeriod == nil {
+		return errors.New("invalid parameters")
+	} else if err := stakingPeriod.Validate(); err != nil {
+		return err
+	}
+
+	// registration_begin is checked in the update, a period can't slip into registration between reading and writing
+	sql := `
+		UPDATE staking_periods
+		SET registration_begin = $2, registration_end = $3, commitment_begin = $4, commitment_end = $5, chip_ratio = $6, funding_games = $7
+		WHERE id = $1 AND registration_begin > NOW() AND closed_at IS NULL
+		RETURNING ` + stakingPeriodColumns
+
+	sp, err := scanStakingPeriod(s.db.QueryRow(ctx, sql, stakingPeriod.ID, stakingPeriod.RegistrationBegin, stakingPeriod.RegistrationEnd, stakingPeriod.CommitmentBegin, stakingPeriod.CommitmentEnd, stakingPeriod.ChipRatio, stakingPeriod.FundingGames))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := s.FindStakingPeriodByID(ctx, stakingPeriod.ID); err != nil {
+			return err
+		}
+		return payapi.ErrStakingPeriodNotEditable
+	} else if err != nil {
+		return err
+	}
+
+	*stakingPeriod = *sp
+
+	return nil
+}
+
+func (s *StakingPeriodService) CloseStakingPeriod(ctx context.Context, id int) (*payapi.StakingPeriod, error) {
+	sp, err := s.FindStakingPeriodByID(ctx, id)
+	if err != nil {
+		return nil, err
+	} else if sp.Status != payapi.StakingPeriodStatusSettling {
+		return nil, payapi.ErrStakingPeriodNotSettling
+	}
+
+	sql := `
+		UPDATE staking_periods
+		SET closed_at = NOW()
+		WHERE id = $1 AND closed_at IS NULL
+		AND EXISTS (SELECT 1 FROM staking_results WHERE staking_period_id = $1)
+		RETURNING ` + stakingPeriodColumns
+
+	sp, err = scanStakingPeriod(s.db.QueryRow(ctx, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, payapi.ErrStakingPeriodNoResult
+	} else if err != nil {
+		return nil, err
+	}
+
+	return sp, nil
+}
@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -22,6 +23,24 @@ func createNewStakingPeriod(registrationStart time.Time) *payapi.StakingPeriod {
 	return s
 }
 
+// moves a period's commitment into the past, commitments are only made during registration
+// and results only after the commitment ends
+func mustEndStakingPeriod(tb testing.TB, db *postgres.Database, id int) {
+	tb.Helper()
+
+	sql := `
+		UPDATE staking_periods
+		SET registration_begin = NOW() - INTERVAL '4 days', registration_end = NOW() - INTERVAL '3 days',
+		commitment_begin = NOW() - INTERVAL '3 days', commitment_end = NOW() - INTERVAL '1 second'
+		WHERE id = $1
+	`
+
+	_, err := db.DB.Exec(context.Background(), sql, id)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
 func TestStakingPeriodService_CreateStakingPeriod(t *testing.T) {
 	// ensure a platform can be created
 
@@ -94,3 +113,163 @@ func TestStakingPeriodService_CreateStakingPeriod(t *testing.T) {
 		}
 	})
 }
+
+func TestStakingPeriodService_UpdateStakingPeriod(t *testing.T) {
+	// ensure a period can only be edited before registration begins
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingPeriodService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC().Add(time.Hour))
+
+		err := s.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		} else if stakingPeriod.Status != payapi.StakingPeriodStatusScheduled {
+			t.Fatalf("Status=%v, want %v", stakingPeriod.Status, payapi.StakingPeriodStatusScheduled)
+		}
+
+		stakingPeriod.ChipRatio = 42
+		stakingPeriod.FundingGames = []string{"Packages\\GameDice\\Models\\Dice"}
+
+		err = s.UpdateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fetched, err := s.FindStakingPeriodByID(ctx, stakingPeriod.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if fetched.ChipRatio != 42 {
+			t.Fatalf("ChipRatio=%v, want %v", fetched.ChipRatio, 42)
+		} else if len(fetched.FundingGames) != 1 || fetched.FundingGames[0] != stakingPeriod.FundingGames[0] {
+			t.Fatalf("FundingGames=%v, want %v", fetched.FundingGames, stakingPeriod.FundingGames)
+		}
+	})
+
+	t.Run("ErrStakingPeriodNotEditable", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingPeriodService(db.DB)
+
+		// registering already
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := s.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		} else if stakingPeriod.Status != payapi.StakingPeriodStatusRegistration {
+			t.Fatalf("Status=%v, want %v", stakingPeriod.Status, payapi.StakingPeriodStatusRegistration)
+		}
+
+		stakingPeriod.ChipRatio = 42
+
+		err = s.UpdateStakingPeriod(ctx, stakingPeriod)
+		if !errors.Is(err, payapi.ErrStakingPeriodNotEditable) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrStakingPeriodNotFound", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		s := postgres.NewStakingPeriodService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC().Add(time.Hour))
+		stakingPeriod.ID = 1337
+
+		err := s.UpdateStakingPeriod(context.Background(), stakingPeriod)
+		if !errors.Is(err, payapi.ErrStakingPeriodNotFound) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrBadTimes", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		s := postgres.NewStakingPeriodService(db.DB)
+
+		// commitment ends before it begins
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC().Add(time.Hour))
+		stakingPeriod.CommitmentEnd = stakingPeriod.CommitmentBegin.Add(-time.Minute)
+
+		err := s.CreateStakingPeriod(context.Background(), stakingPeriod)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestStakingPeriodService_CloseStakingPeriod(t *testing.T) {
+	// ensure a period settles once, after its one result
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewStakingPeriodService(db.DB)
+
+		srs := postgres.NewStakingResultService(db.DB)
+		srs.StakingPeriodService = s
+		srs.StakingCommitmentService = postgres.NewStakingCommitmentService(db.DB)
+		srs.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		srs.StakingCheckRunService = postgres.NewStakingCheckRunService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := s.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// too early
+		_, err = srs.CreateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if !errors.Is(err, payapi.ErrStakingPeriodNotSettling) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		_, err = s.CloseStakingPeriod(ctx, stakingPeriod.ID)
+		if !errors.Is(err, payapi.ErrStakingPeriodNoResult) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err = srs.CreateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only once
+		_, err = srs.CreateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if !errors.Is(err, payapi.ErrStakingResultExists) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		closed, err := s.CloseStakingPeriod(ctx, stakingPeriod.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if closed.Status != payapi.StakingPeriodStatusSettled {
+			t.Fatalf("Status=%v, want %v", closed.Status, payapi.StakingPeriodStatusSettled)
+		} else if closed.ClosedAt == nil {
+			t.Fatal("expected closedAt")
+		}
+
+		_, err = s.CloseStakingPeriod(ctx, stakingPeriod.ID)
+		if !errors.Is(err, payapi.ErrStakingPeriodNotSettling) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math"
+	"math/big"
+	"sort"
+	"time"
 
 	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+	"github.com/algo-casino/payapi/reward"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -17,6 +22,15 @@ type (
 		db                       *pgxpool.Pool
 		StakingPeriodService     payapi.StakingPeriodService
 		StakingCommitmentService payapi.StakingCommitmentService
+		StakingAssetService      payapi.StakingAssetService
+		StakingCheckRunService   payapi.StakingCheckRunService
+
+		// house fee and minimum payout applied to new results
+		RewardPolicy reward.Policy
+
+		// multiply weights of addresses they apply to, hold_asset rules need HoldingsSource
+		BoostRules     []payapi.StakingBoostRule
+		HoldingsSource algo.HoldingsSource
 	}
 )
 
@@ -26,13 +40,66 @@ func NewStakingResultService(db *pgxpool.Pool) *StakingResultService {
 	}
 }
 
-func (s *StakingResultService) CreateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64) (*payapi.StakingResult, error) {
+func (s *StakingResultService) CalculateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*payapi.StakingResult, error) {
+	err := payapi.ValidateStakingWeighting(weighting)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, stakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.calculateStakingResult(ctx, sp, totalProfit, weighting)
+}
+
+func (s *StakingResultService) CreateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*payapi.StakingResult, error) {
+	err := payapi.ValidateStakingWeighting(weighting)
+	if err != nil {
+		return nil, err
+	}
+
 	sp, err := s.StakingPeriodService.FindStakingPeriodByID(ctx, stakingPeriodId)
 	if err != nil {
 		return nil, err
+	} else if sp.Status != payapi.StakingPeriodStatusSettling {
+		return nil, payapi.ErrStakingPeriodNotSettling
+	}
+
+	sr, err := s.calculateStakingResult(ctx, sp, totalProfit, weighting)
+	if err != nil {
+		return nil, err
+	}
+
+	// exports are of the inputs as they are now
+	sr.Inputs, err = s.hashStakingInputs(ctx, stakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+
+	sql := `
+		INSERT INTO staking_results (staking_period_id, profit, house_fee, unallocated, weighting, asset_ratios, results, policy, funding_games, inputs, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+		RETURNING id, created_at
+	`
+
+	// one result per period
+	err = s.db.QueryRow(ctx, sql, sr.StakingPeriodId, sr.Profit, sr.HouseFee, sr.Unallocated, sr.Weighting, sr.AssetRatios, sr.Results, sr.Policy, sr.FundingGames, sr.Inputs).Scan(&sr.ID, &sr.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, payapi.ErrStakingResultExists
+	} else if err != nil {
+		return nil, err
 	}
 
-	stakingCommitments, err := s.StakingCommitmentService.FindStakingCommitments(context.Background(), payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
+	return sr, nil
+}
+
+// result of sp as it stands, unsaved
+func (s *StakingResultService) calculateStakingResult(ctx context.Context, sp *payapi.StakingPeriod, totalProfit uint64, weighting string) (*payapi.StakingResult, error) {
+	stakingPeriodId := sp.ID
+
+	stakingCommitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
 	if err != nil {
 		fmt.Printf("failed to get staking commitments. err: %v\n", err)
 		return nil, err
@@ -40,48 +107,95 @@ func (s *StakingResultService) CreateStakingResult(ctx context.Context, stakingP
 
 	fmt.Printf("len(stakingCommitments): %v\n", len(stakingCommitments))
 
-	//initialize map
-	resultsMap := make(map[string]float64)
-	totalEquivalent := float64(0)
+	assets, err := s.StakingAssetService.FindStakingAssets(ctx, payapi.StakingAssetFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	// balances seen by check runs, by address then asset
+	holdings, err := s.findStakingHoldings(ctx, stakingPeriodId, weighting)
+	if err != nil {
+		return nil, err
+	}
+
+	// what pooled assets were worth over the period
+	assetRatios, err := s.findStakingAssetRatios(ctx, stakingPeriodId)
+	if err != nil {
+		return nil, err
+	}
+
+	// credit up to now if the commitment period isn't over
+	end := sp.CommitmentEnd
+	if now := time.Now().UTC(); now.Before(end) {
+		end = now
+	}
+
+	// chip equivalent of each credited address
+	shares := make([]reward.Share, 0)
+
+	// eligibility in this period, only eligible addresses count towards a streak
+	eligible := make(map[string]bool, len(stakingCommitments))
 
 	for _, sc := range stakingCommitments {
-		if sc.Eligible {
-			address := sc.AlgorandAddress
-			chipAmount := sc.ChipCommitment
+		eligible[sc.AlgorandAddress] = sc.Eligible
+
+		// weighted by what was held, dropping below the commitment only reduces the reward
+		if !sc.Eligible && weighting == payapi.StakingWeightingCommitment {
+			continue
+		}
 
-			var lpAmount float64
+		// value every committed asset in chips
+		equivAmt := new(big.Rat)
 
-			if sc.LiquidityCommitment > 0 || sc.LiquidityCommitmentV2 > 0 {
-				lpAmount = (float64(sc.LiquidityCommitment+sc.LiquidityCommitmentV2) * sp.ChipRatio) / 1000000
+		for _, asset := range assets {
+			committed := sc.AssetAmount(asset.AssetId)
+			if committed == 0 {
+				continue
 			}
 
-			var liquidAmount float64
+			amount := payapi.WeightedStakingAmount(weighting, committed, holdings[sc.AlgorandAddress][asset.AssetId], sp.CommitmentBegin, end)
+			if amount == 0 {
+				continue
+			}
 
-			if sc.CAlgoCommitment > 0 || sc.TAlgoCommitment > 0 || sc.MAlgoCommitment > 0 || sc.XAlgoCommitment > 0 {
-				liquidAmount = (float64(sc.CAlgoCommitment+sc.TAlgoCommitment+sc.MAlgoCommitment+sc.XAlgoCommitment) * sp.ChipRatio) / 1000000
+			// the period's chip ratio when the pool was never priced
+			if ratio, ok := assetRatios[asset.AssetId]; ok {
+				equivAmt.Add(equivAmt, asset.ChipValue(amount, ratio))
+			} else {
+				equivAmt.Add(equivAmt, asset.ChipEquivalent(amount, sp.ChipRatio))
 			}
+		}
 
-			equivAmt := lpAmount + liquidAmount + float64(chipAmount/10)
-			resultsMap[address] = equivAmt
+		shares = append(shares, reward.Share{Key: sc.AlgorandAddress, Weight: equivAmt})
+	}
 
-			totalEquivalent += equivAmt
-			//fmt.Printf("%s,%d,%d,%.1f\n", address, chipAmount, sc.LiquidityCommitment, equivAmt)
-		} else {
+	boosts, err := s.findStakingBoosts(ctx, sp, shares, eligible)
+	if err != nil {
+		return nil, err
+	}
 
+	for i := range shares {
+		if b := boosts[shares[i].Key]; len(b) > 0 {
+			shares[i].Weight = payapi.BoostedWeight(shares[i].Weight, b)
 		}
 	}
 
-	items := make([]*payapi.StakingResultItem, 0)
+	// rewards add up to exactly what's distributable
+	allocation, err := reward.Allocate(totalProfit, shares, s.RewardPolicy)
+	if err != nil {
+		return nil, err
+	}
 
-	for k, sc := range resultsMap {
-		percentHolding := (sc / totalEquivalent) * 100
+	items := make([]*payapi.StakingResultItem, 0)
 
-		rewardAmt := math.Floor(float64(totalProfit) * percentHolding)
+	for _, a := range allocation.Allocations {
+		percentHolding, _ := new(big.Rat).Mul(a.Quota, big.NewRat(100, 1)).Float64()
 
 		item := &payapi.StakingResultItem{
-			Address: k,
+			Address: a.Key,
 			Percent: percentHolding,
-			Reward:  rewardAmt,
+			Reward:  a.Amount,
+			Boosts:  boosts[a.Key],
 		}
 
 		items = append(items, item)
@@ -90,20 +204,210 @@ func (s *StakingResultService) CreateStakingResult(ctx context.Context, stakingP
 	sr := &payapi.StakingResult{
 		StakingPeriodId: stakingPeriodId,
 		Profit:          totalProfit,
+		HouseFee:        allocation.HouseFee,
+		Unallocated:     allocation.Unallocated,
+		Weighting:       weighting,
 		Results:         items,
+		FundingGames:    sp.FundingGames,
 	}
-	sql := `
-		INSERT INTO staking_results (staking_period_id, profit, results, created_at)
-		VALUES ($1, $2, $3, NOW())
-		RETURNING id, created_at
-	`
 
-	err = s.db.QueryRow(ctx, sql, stakingPeriodId, totalProfit, items).Scan(&sr.ID, &sr.CreatedAt)
+	policy := s.RewardPolicy
+	sr.Policy = &policy
+
+	if len(assetRatios) > 0 {
+		sr.AssetRatios = make(map[uint64]float64, len(assetRatios))
+		for assetId, ratio := range assetRatios {
+			sr.AssetRatios[assetId], _ = ratio.Float64()
+		}
+	}
+	return sr, nil
+}
+
+// hashes of what a result of the period is worked out from, saved with it
+func (s *StakingResultService) hashStakingInputs(ctx context.Context, stakingPeriodId int) (*payapi.StakingExportInputs, error) {
+	commitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriodId})
 	if err != nil {
 		return nil, err
 	}
 
-	return sr, nil
+	holdings, err := s.StakingCheckRunService.FindStakingHoldings(ctx, payapi.StakingHoldingFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	ratios, err := s.StakingAssetService.FindStakingAssetRatios(ctx, payapi.StakingAssetRatioFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	return payapi.HashStakingInputs(commitments, holdings, ratios)
+}
+
+// boosts of every address with a share, in rule order
+// eligible is each address's eligibility in sp itself
+func (s *StakingResultService) findStakingBoosts(ctx context.Context, sp *payapi.StakingPeriod, shares []reward.Share, eligible map[string]bool) (map[string][]*payapi.StakingBoost, error) {
+	boosts := make(map[string][]*payapi.StakingBoost)
+
+	if len(s.BoostRules) == 0 {
+		return boosts, nil
+	}
+
+	// eligible addresses of the periods before sp, nearest first, fetched as far back as a rule needs
+	var previous []map[string]bool
+
+	for i := range s.BoostRules {
+		rule := &s.BoostRules[i]
+
+		err := rule.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		// addresses the rule applies to
+		applies := make(map[string]bool)
+
+		switch rule.Type {
+		case payapi.StakingBoostHoldAsset:
+			if s.HoldingsSource == nil {
+				return nil, fmt.Errorf("boost %s needs a holdings source", rule.Name)
+			}
+
+			held := make(map[string]uint64)
+
+			for _, assetId := range rule.AssetIds {
+				holding, err := s.HoldingsSource.GetAccountsWithAsset(ctx, assetId)
+				if err != nil {
+					return nil, fmt.Errorf("GetAccountsWithAsset() ASA ID: %d failed: %w", assetId, err)
+				}
+
+				for _, h := range holding {
+					held[h.Address] += h.Amount
+				}
+			}
+
+			for address, amount := range held {
+				applies[address] = amount >= rule.MinHeld()
+			}
+		case payapi.StakingBoostConsecutivePeriods:
+			if len(previous) < rule.MinPeriods-1 {
+				previous, err = s.findPreviousEligible(ctx, sp, rule.MinPeriods-1)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// not enough periods before this one, nobody qualifies
+			if len(previous) < rule.MinPeriods-1 {
+				continue
+			}
+
+			// the streak includes this period, a share weighted by holdings alone doesn't count
+			for _, share := range shares {
+				applies[share.Key] = eligible[share.Key]
+				for _, before := range previous[:rule.MinPeriods-1] {
+					applies[share.Key] = applies[share.Key] && before[share.Key]
+				}
+			}
+		}
+
+		for _, share := range shares {
+			if applies[share.Key] && share.Weight.Sign() > 0 {
+				boosts[share.Key] = append(boosts[share.Key], &payapi.StakingBoost{Name: rule.Name, MultiplierBps: rule.MultiplierBps})
+			}
+		}
+	}
+
+	return boosts, nil
+}
+
+// eligible addresses of up to n periods registering before sp, nearest first
+func (s *StakingResultService) findPreviousEligible(ctx context.Context, sp *payapi.StakingPeriod, n int) ([]map[string]bool, error) {
+	sps, err := s.StakingPeriodService.FindStakingPeriods(ctx, payapi.StakingPeriodFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	before := make([]*payapi.StakingPeriod, 0)
+	for _, p := range sps {
+		if p.ID != sp.ID && p.RegistrationBegin.Before(sp.RegistrationBegin) {
+			before = append(before, p)
+		}
+	}
+
+	sort.Slice(before, func(i, j int) bool {
+		return before[i].RegistrationBegin.After(before[j].RegistrationBegin)
+	})
+
+	if len(before) > n {
+		before = before[:n]
+	}
+
+	previous := make([]map[string]bool, 0, len(before))
+
+	for _, p := range before {
+		id := p.ID
+
+		commitments, err := s.StakingCommitmentService.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &id})
+		if err != nil {
+			return nil, err
+		}
+
+		eligible := make(map[string]bool, len(commitments))
+		for _, c := range commitments {
+			eligible[c.AlgorandAddress] = c.Eligible
+		}
+
+		previous = append(previous, eligible)
+	}
+
+	return previous, nil
+}
+
+// holdings of the period's check runs by address then asset, ordered by time
+// none are needed when crediting the committed amount
+func (s *StakingResultService) findStakingHoldings(ctx context.Context, stakingPeriodId int, weighting string) (map[string]map[uint64][]*payapi.StakingHolding, error) {
+	holdings := make(map[string]map[uint64][]*payapi.StakingHolding)
+
+	if weighting == payapi.StakingWeightingCommitment {
+		return holdings, nil
+	}
+
+	hs, err := s.StakingCheckRunService.FindStakingHoldings(ctx, payapi.StakingHoldingFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	} else if len(hs) == 0 {
+		return nil, fmt.Errorf("staking period %d has no check runs to weight by", stakingPeriodId)
+	}
+
+	for _, h := range hs {
+		if holdings[h.Address] == nil {
+			holdings[h.Address] = make(map[uint64][]*payapi.StakingHolding)
+		}
+
+		holdings[h.Address][h.AssetId] = append(holdings[h.Address][h.AssetId], h)
+	}
+
+	return holdings, nil
+}
+
+// mean of each pooled asset's ratios recorded for the period
+func (s *StakingResultService) findStakingAssetRatios(ctx context.Context, stakingPeriodId int) (map[uint64]*big.Rat, error) {
+	ratios, err := s.StakingAssetService.FindStakingAssetRatios(ctx, payapi.StakingAssetRatioFilter{StakingPeriodId: &stakingPeriodId})
+	if err != nil {
+		return nil, err
+	}
+
+	byAsset := make(map[uint64][]*payapi.StakingAssetRatio)
+	for _, r := range ratios {
+		byAsset[r.AssetId] = append(byAsset[r.AssetId], r)
+	}
+
+	means := make(map[uint64]*big.Rat, len(byAsset))
+	for assetId, rs := range byAsset {
+		means[assetId] = payapi.MeanStakingAssetRatio(rs)
+	}
+
+	return means, nil
 }
 
 // // gets the result for the given staking period id, failing otherwise if not exists
@@ -113,13 +417,15 @@ func (s *StakingResultService) FindStakingResultByID(ctx context.Context, id int
 	}
 
 	sql := `
-		SELECT staking_period_id, profit, results, created_at
+		SELECT staking_period_id, profit, house_fee, unallocated, weighting, asset_ratios, results, policy, funding_games, inputs, created_at
 		FROM staking_results
 		WHERE id = $1
 	`
 
-	err := s.db.QueryRow(context.Background(), sql, id).Scan(&sr.StakingPeriodId, &sr.Profit, &sr.Results, &sr.CreatedAt)
-	if err != nil {
+	err := s.db.QueryRow(ctx, sql, id).Scan(&sr.StakingPeriodId, &sr.Profit, &sr.HouseFee, &sr.Unallocated, &sr.Weighting, &sr.AssetRatios, &sr.Results, &sr.Policy, &sr.FundingGames, &sr.Inputs, &sr.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, payapi.ErrStakingResultNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -134,7 +440,7 @@ func (s *StakingResultService) FindStakingResults(ctx context.Context, filter pa
 	stakingPeriodId := *filter.StakingPeriodId
 
 	sql := `
-		SELECT id, profit, results, created_at
+		SELECT id, profit, house_fee, unallocated, weighting, asset_ratios, results, policy, funding_games, inputs, created_at
 		FROM staking_results
 		WHERE staking_period_id = $1
 	`
@@ -143,13 +449,14 @@ func (s *StakingResultService) FindStakingResults(ctx context.Context, filter pa
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	srs := make([]*payapi.StakingResult, 0)
 
 	for rows.Next() {
 		var sr payapi.StakingResult
 
-		err := rows.Scan(&sr.ID, &sr.Profit, &sr.Results, &sr.CreatedAt)
+		err := rows.Scan(&sr.ID, &sr.Profit, &sr.HouseFee, &sr.Unallocated, &sr.Weighting, &sr.AssetRatios, &sr.Results, &sr.Policy, &sr.FundingGames, &sr.Inputs, &sr.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -159,6 +466,5 @@ func (s *StakingResultService) FindStakingResults(ctx context.Context, filter pa
 		srs = append(srs, &sr)
 	}
 
-	return srs, nil
-
+	return srs, rows.Err()
 }
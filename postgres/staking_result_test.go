@@ -0,0 +1,452 @@
+package postgres_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+	"github.com/algo-casino/payapi/chip"
+	"github.com/algo-casino/payapi/postgres"
+	"github.com/algorand/go-algorand-sdk/client/v2/common/models"
+	"github.com/algorand/go-algorand-sdk/crypto"
+	"github.com/algorand/go-algorand-sdk/mnemonic"
+)
+
+func TestStakingResultService_CalculateStakingResult(t *testing.T) {
+	// ensure a result can be projected at any time without saving it
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		s := postgres.NewStakingResultService(db.DB)
+		s.StakingPeriodService = sps
+		s.StakingCommitmentService = scs
+		s.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+			StakingPeriodID: stakingPeriod.ID,
+			AlgorandAddress: "AAAA",
+			Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// still registering
+		sr, err := s.CalculateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if sr.ID != 0 {
+			t.Fatalf("ID=%v, want %v", sr.ID, 0)
+		} else if len(sr.Results) != 1 || sr.Results[0].Reward != 1000 {
+			t.Fatalf("unexpected results: %v", sr.Results)
+		}
+
+		results, err := s.FindStakingResults(ctx, payapi.StakingResultFilter{StakingPeriodId: &stakingPeriod.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(results) != 0 {
+			t.Fatalf("len(results)=%v, want %v", len(results), 0)
+		}
+
+		// and by address
+		address := "AAAA"
+		commitments, err := scs.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{AlgorandAddress: &address})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(commitments) != 1 || commitments[0].StakingPeriodID != stakingPeriod.ID {
+			t.Fatalf("unexpected commitments: %v", commitments)
+		}
+	})
+}
+
+func TestStakingCheckService_PreviewStakingResult(t *testing.T) {
+	// ensure a preview is diffed against the saved result
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		s := postgres.NewStakingResultService(db.DB)
+		s.StakingPeriodService = sps
+		s.StakingCommitmentService = scs
+		s.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		s.StakingCheckRunService = postgres.NewStakingCheckRunService(db.DB)
+
+		cs := chip.NewStakingCheckService()
+		cs.StakingResultService = s
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err := sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, address := range []string{"AAAA", "BBBB"} {
+			err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+				StakingPeriodID: stakingPeriod.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// nothing saved, every reward differs
+		preview, err := cs.PreviewStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if preview.Current != nil {
+			t.Fatalf("Current=%v, want nil", preview.Current)
+		} else if len(preview.Changes) != 2 || preview.Changes[0].Address != "AAAA" || preview.Changes[0].Preview != 500 {
+			t.Fatalf("unexpected changes: %v", preview.Changes)
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		_, err = s.CreateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// same inputs, nothing differs
+		preview, err = cs.PreviewStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if preview.Current == nil {
+			t.Fatal("expected current result")
+		} else if len(preview.Changes) != 0 {
+			t.Fatalf("unexpected changes: %v", preview.Changes)
+		}
+
+		preview, err = cs.PreviewStakingResult(ctx, stakingPeriod.ID, 2000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(preview.Changes) != 2 || preview.Changes[1].Current != 500 || preview.Changes[1].Preview != 1000 {
+			t.Fatalf("unexpected changes: %v", preview.Changes)
+		}
+	})
+}
+
+func TestStakingExportService_SignStakingResultExport(t *testing.T) {
+	// ensure an export is canonical and signed by the house key
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		sas := postgres.NewStakingAssetService(db.DB)
+		scrs := postgres.NewStakingCheckRunService(db.DB)
+
+		s := postgres.NewStakingResultService(db.DB)
+		s.StakingPeriodService = sps
+		s.StakingCommitmentService = scs
+		s.StakingAssetService = sas
+		s.StakingCheckRunService = scrs
+
+		house := crypto.GenerateAccount()
+
+		m, err := mnemonic.FromPrivateKey(house.PrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		as, err := algo.NewAccountService(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		es := chip.NewStakingExportService()
+		es.StakingPeriodService = sps
+		es.StakingCommitmentService = scs
+		es.StakingCheckRunService = scrs
+		es.StakingAssetService = sas
+		es.StakingResultService = s
+
+		stakingPeriod := createNewStakingPeriod(time.Now().UTC())
+
+		err = sps.CreateStakingPeriod(ctx, stakingPeriod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, address := range []string{"BBBB", "AAAA"} {
+			err = scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+				StakingPeriodID: stakingPeriod.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		mustEndStakingPeriod(t, db, stakingPeriod.ID)
+
+		sr, err := s.CreateStakingResult(ctx, stakingPeriod.ID, 1000, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		export, err := es.ExportStakingResult(ctx, sr.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(export.Rewards) != 2 || export.Rewards[0].Address != "AAAA" || export.Rewards[0].Reward != 500 {
+			t.Fatalf("unexpected rewards: %v", export.Rewards)
+		}
+
+		// no key, nothing signed
+		_, err = es.SignStakingResultExport(ctx, export)
+		if !errors.Is(err, payapi.ErrNoSigningKey) {
+			t.Fatalf("err=%v, want %v", err, payapi.ErrNoSigningKey)
+		}
+
+		es.AccountService = as
+
+		signed, err := es.SignStakingResultExport(ctx, export)
+		if err != nil {
+			t.Fatal(err)
+		} else if signed.Signer != house.Address.String() {
+			t.Fatalf("Signer=%v, want %v", signed.Signer, house.Address.String())
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+		if err != nil {
+			t.Fatal(err)
+		} else if !crypto.VerifyBytes(house.PublicKey, signed.Document, sig) {
+			t.Fatal("signature does not verify")
+		}
+
+		if export.Policy == nil || export.Inputs == nil || len(export.Rewards[0].Boosts) != 0 {
+			t.Fatalf("unexpected export: %+v", export)
+		}
+
+		// inputs changing after the result was saved, e.g. an eligibility reinstated by hand
+		commitments, err := scs.FindStakingCommitments(ctx, payapi.StakingCommitmentFilter{StakingPeriodId: &stakingPeriod.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = scs.UpdateEligibility(ctx, commitments[0].ID, &payapi.EligibilityEvent{Eligible: false, Source: payapi.EligibilitySourceAdmin, Reason: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// exporting again gives the same document
+		again, err := es.ExportStakingResult(ctx, sr.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(again)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(b) != string(signed.Document) {
+			t.Fatalf("document=%s, want %s", b, signed.Document)
+		}
+
+		_, err = es.ExportStakingResult(ctx, sr.ID+1)
+		if !errors.Is(err, payapi.ErrStakingResultNotFound) {
+			t.Fatalf("err=%v, want %v", err, payapi.ErrStakingResultNotFound)
+		}
+	})
+}
+
+// balances by asset id
+type fakeHoldingsSource map[uint64][]models.MiniAssetHolding
+
+func (f fakeHoldingsSource) GetAccountsWithAsset(ctx context.Context, assetId uint64) ([]models.MiniAssetHolding, error) {
+	return f[assetId], nil
+}
+
+func TestStakingResultService_Boosts(t *testing.T) {
+	// ensure boosts multiply weights and are recorded on result items
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		s := postgres.NewStakingResultService(db.DB)
+		s.StakingPeriodService = sps
+		s.StakingCommitmentService = scs
+		s.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		s.HoldingsSource = fakeHoldingsSource{5: {{Address: "BBBB", Amount: 1}, {Address: "CCCC", Amount: 1}}}
+		s.BoostRules = []payapi.StakingBoostRule{
+			{Name: "nft", Type: payapi.StakingBoostHoldAsset, MultiplierBps: 15000, AssetIds: []uint64{5}},
+			{Name: "streak", Type: payapi.StakingBoostConsecutivePeriods, MultiplierBps: 20000, MinPeriods: 2},
+		}
+
+		previous := createNewStakingPeriod(time.Now().UTC().Add(-time.Hour))
+		current := createNewStakingPeriod(time.Now().UTC())
+
+		for _, sp := range []*payapi.StakingPeriod{previous, current} {
+			err := sps.CreateStakingPeriod(ctx, sp)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		commit := func(sp *payapi.StakingPeriod, address string) {
+			err := scs.CreateStakingCommitment(ctx, &payapi.StakingCommitment{
+				StakingPeriodID: sp.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		commit(previous, "AAAA")
+		commit(current, "AAAA")
+		commit(current, "BBBB")
+
+		// AAAA 100 * 2, BBBB 100 * 1.5, CCCC has nothing committed
+		sr, err := s.CalculateStakingResult(ctx, current.ID, 350, payapi.StakingWeightingCommitment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rewards := make(map[string]*payapi.StakingResultItem)
+		for _, item := range sr.Results {
+			rewards[item.Address] = item
+		}
+
+		if a := rewards["AAAA"]; a == nil || a.Reward != 200 || len(a.Boosts) != 1 || a.Boosts[0].Name != "streak" {
+			t.Fatalf("unexpected AAAA: %+v", a)
+		} else if b := rewards["BBBB"]; b == nil || b.Reward != 150 || len(b.Boosts) != 1 || b.Boosts[0].Name != "nft" {
+			t.Fatalf("unexpected BBBB: %+v", b)
+		} else if len(rewards) != 2 {
+			t.Fatalf("len(results)=%d, want %d", len(rewards), 2)
+		}
+	})
+	t.Run("IneligibleNow", func(t *testing.T) {
+		// weighted by holdings an ineligible commitment still has a share, but no streak
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		sps := postgres.NewStakingPeriodService(db.DB)
+
+		scs := postgres.NewStakingCommitmentService(db.DB)
+		scs.StakingPeriodService = sps
+
+		crs := postgres.NewStakingCheckRunService(db.DB)
+
+		s := postgres.NewStakingResultService(db.DB)
+		s.StakingPeriodService = sps
+		s.StakingCommitmentService = scs
+		s.StakingCheckRunService = crs
+		s.StakingAssetService = postgres.NewStakingAssetService(db.DB)
+		s.BoostRules = []payapi.StakingBoostRule{
+			{Name: "streak", Type: payapi.StakingBoostConsecutivePeriods, MultiplierBps: 20000, MinPeriods: 2},
+		}
+
+		previous := createNewStakingPeriod(time.Now().UTC().Add(-time.Hour))
+		current := createNewStakingPeriod(time.Now().UTC())
+
+		for _, sp := range []*payapi.StakingPeriod{previous, current} {
+			err := sps.CreateStakingPeriod(ctx, sp)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		commit := func(sp *payapi.StakingPeriod, address string) *payapi.StakingCommitment {
+			sc := &payapi.StakingCommitment{
+				StakingPeriodID: sp.ID,
+				AlgorandAddress: address,
+				Assets:          []*payapi.StakingCommitmentItem{{AssetId: payapi.StakingRewardAssetId, Amount: 100}},
+			}
+
+			err := scs.CreateStakingCommitment(ctx, sc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return sc
+		}
+
+		commit(previous, "AAAA")
+		commit(previous, "BBBB")
+		commit(current, "AAAA")
+		sc := commit(current, "BBBB")
+
+		_, err := scs.UpdateEligibility(ctx, sc.ID, &payapi.EligibilityEvent{Eligible: false, Source: payapi.EligibilitySourceCheck, Reason: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = crs.CreateStakingCheckRun(ctx, &payapi.StakingCheckRun{
+			StakingPeriodId: current.ID,
+			Holdings: []*payapi.StakingHolding{
+				{Address: "AAAA", AssetId: payapi.StakingRewardAssetId, Amount: 100},
+				{Address: "BBBB", AssetId: payapi.StakingRewardAssetId, Amount: 100},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// AAAA 100 * 2, BBBB 100 unboosted
+		sr, err := s.CalculateStakingResult(ctx, current.ID, 300, payapi.StakingWeightingMinimum)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rewards := make(map[string]*payapi.StakingResultItem)
+		for _, item := range sr.Results {
+			rewards[item.Address] = item
+		}
+
+		if a := rewards["AAAA"]; a == nil || a.Reward != 200 || len(a.Boosts) != 1 {
+			t.Fatalf("unexpected AAAA: %+v", a)
+		} else if b := rewards["BBBB"]; b == nil || b.Reward != 100 || len(b.Boosts) != 0 {
+			t.Fatalf("unexpected BBBB: %+v", b)
+		}
+	})
+}
@@ -0,0 +1,382 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.WebhookService = (*WebhookService)(nil)
+
+const (
+	webhookMaxAttempts = 12               // ~1 day of retries with the backoff below
+	webhookBaseBackoff = 30 * time.Second // doubled after every failed attempt
+	webhookMaxBackoff  = 6 * time.Hour
+	webhookLease       = 5 * time.Minute // how long a claimed delivery is hidden from other workers
+)
+
+type (
+	WebhookService struct {
+		db     *pgxpool.Pool
+		client *http.Client
+	}
+
+	// delivery joined with where it's going
+	pendingWebhook struct {
+		payapi.WebhookDelivery
+		webhookUrl     string
+		webhookSecret  string
+		webhookVersion int
+	}
+)
+
+func NewWebhookService(db *pgxpool.Pool) *WebhookService {
+	return &WebhookService{
+		db: db,
+		client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+// how long to wait before the next attempt, given how many have been made
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+func (s *WebhookService) FindWebhookDeliveries(ctx context.Context, filter payapi.WebhookDeliveryFilter) ([]*payapi.WebhookDelivery, error) {
+	sql := `
+		SELECT id, platform_id, payment_id, withdrawal_id, event, payload, status, attempts, created_at, next_attempt_at, last_attempt_at, delivered_at, last_status_code, last_error
+		FROM webhook_deliveries
+		WHERE ($1::INT IS NULL OR payment_id = $1) AND ($2::INT IS NULL OR withdrawal_id = $2) AND ($3::INT IS NULL OR status = $3)
+		ORDER BY id ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.PaymentId, filter.WithdrawalId, filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*payapi.WebhookDelivery, 0)
+
+	for rows.Next() {
+		var d payapi.WebhookDelivery
+
+		err := rows.Scan(&d.ID, &d.PlatformId, &d.PaymentId, &d.WithdrawalId, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.CreatedAt, &d.NextAttemptAt, &d.LastAttemptAt, &d.DeliveredAt, &d.LastStatusCode, &d.LastError)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// claims due deliveries by pushing their next attempt out, so concurrent workers skip them
+func (s *WebhookService) claimPendingWebhooks(ctx context.Context, limit int) ([]*pendingWebhook, error) {
+	sql := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + make_interval(secs => $3)
+		FROM platforms p
+		WHERE p.id = d.platform_id AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.platform_id, d.event, d.payload, d.attempts, p.webhook_url, p.webhook_secret, d.webhook_version
+	`
+
+	rows, err := s.db.Query(ctx, sql, payapi.WebhookStatusPending, limit, webhookLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := make([]*pendingWebhook, 0)
+
+	for rows.Next() {
+		var p pendingWebhook
+
+		err := rows.Scan(&p.ID, &p.PlatformId, &p.Event, &p.Payload, &p.Attempts, &p.webhookUrl, &p.webhookSecret, &p.webhookVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, &p)
+	}
+
+	return pending, rows.Err()
+}
+
+// makes a single signed call, returns the status code (0 if there was no response)
+func (s *WebhookService) send(ctx context.Context, p *pendingWebhook) (int, error) {
+	timestamp := time.Now().Unix()
+
+	// legacy platforms are called the way they always were
+	method := "POST"
+	if p.webhookVersion == payapi.WebhookVersionLegacy {
+		method = "GET"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.webhookUrl, bytes.NewReader(p.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-PayAPI-Event", p.Event)
+	req.Header.Set("X-PayAPI-Delivery", strconv.Itoa(p.ID))
+	req.Header.Set("X-PayAPI-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-PayAPI-Signature", "sha256="+payapi.SignWebhookPayload(p.webhookSecret, timestamp, p.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("platform responded with HTTP %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+func (s *WebhookService) recordAttempt(ctx context.Context, p *pendingWebhook, statusCode int, sendErr error) error {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	attempts := p.Attempts + 1
+
+	if sendErr == nil {
+		sql := `
+			UPDATE webhook_deliveries
+			SET status = $1, attempts = $2, last_attempt_at = NOW(), delivered_at = NOW(), last_status_code = $3, last_error = NULL
+			WHERE id = $4
+		`
+
+		_, err := s.db.Exec(ctx, sql, payapi.WebhookStatusDelivered, attempts, code, p.ID)
+		return err
+	}
+
+	status := payapi.WebhookStatusPending
+	if attempts >= webhookMaxAttempts {
+		status = payapi.WebhookStatusFailed
+	}
+
+	sql := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, last_attempt_at = NOW(), next_attempt_at = NOW() + make_interval(secs => $3), last_status_code = $4, last_error = $5
+		WHERE id = $6
+	`
+
+	_, err := s.db.Exec(ctx, sql, status, attempts, webhookBackoff(attempts).Seconds(), code, sendErr.Error(), p.ID)
+	return err
+}
+
+func (s *WebhookService) DeliverPendingWebhooks(ctx context.Context, limit int) (int, error) {
+	pending, err := s.claimPendingWebhooks(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range pending {
+		statusCode, sendErr := s.send(ctx, p)
+		if sendErr != nil {
+			fmt.Printf("webhook delivery %d (%s) attempt %d failed err: %v\n", p.ID, p.Event, p.Attempts+1, sendErr)
+		}
+
+		err := s.recordAttempt(ctx, p, statusCode, sendErr)
+		if err != nil {
+			fmt.Printf("failed to record webhook delivery %d attempt err: %v\n", p.ID, err)
+		}
+	}
+
+	return len(pending), nil
+}
+
+// puts a webhook call in the outbox, in the same transaction as the change it reports so neither is saved without the other
+// it is sent (and retried) by WebhookService
+func enqueueWebhook(ctx context.Context, tx pgx.Tx, delivery *payapi.WebhookDelivery, version int, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	sql := `
+		INSERT INTO webhook_deliveries (platform_id, payment_id, withdrawal_id, event, payload, webhook_version, status, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, created_at, next_attempt_at
+	`
+
+	delivery.Payload = payload
+	delivery.Status = payapi.WebhookStatusPending
+
+	return tx.QueryRow(
+		ctx,
+		sql,
+		delivery.PlatformId,
+		delivery.PaymentId,
+		delivery.WithdrawalId,
+		delivery.Event,
+		delivery.Payload,
+		version,
+		delivery.Status,
+	).Scan(
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.NextAttemptAt,
+	)
+}
+
+func findWebhookVersion(ctx context.Context, tx pgx.Tx, platformId int) (int, error) {
+	var version int
+
+	err := tx.QueryRow(ctx, `SELECT webhook_version FROM platforms WHERE id = $1`, platformId).Scan(&version)
+
+	return version, err
+}
+
+// queues the platform's deposit webhook for a payment's new status, call before committing tx
+func enqueueDepositWebhook(ctx context.Context, tx pgx.Tx, status int, payment *payapi.Payment) error {
+	// `externalId` is the PayAPI payment ID (stored as `external_id` column on casino `deposits` table)
+	type depositRequest struct {
+		Event          string  `json:"event"`
+		ExternalId     int     `json:"externalId"`     // PayAPI payment ID
+		TransactionId  *string `json:"transactionId"`  // algorand txid, null unless completed
+		ReceivedAmount *uint64 `json:"receivedAmount"` // amount actually sent, null unless completed
+	}
+
+	type legacyDepositRequest struct {
+		ExternalId    int     `json:"externalId"`    // PayAPI payment ID
+		TransactionId *string `json:"transactionId"` // algorand txid
+	}
+
+	var event string
+
+	switch status {
+	case payapi.StatusCancelled:
+		event = payapi.WebhookEventDepositCancelled
+	case payapi.StatusCompleted:
+		event = payapi.WebhookEventDepositCompleted
+	case payapi.StatusExpired:
+		event = payapi.WebhookEventDepositExpired
+	default:
+		return nil
+	}
+
+	version, err := findWebhookVersion(ctx, tx, payment.PlatformId)
+	if err != nil {
+		return err
+	}
+
+	delivery := &payapi.WebhookDelivery{
+		PlatformId: payment.PlatformId,
+		PaymentId:  &payment.ID,
+		Event:      event,
+	}
+
+	var body interface{} = &depositRequest{
+		Event:          event,
+		ExternalId:     payment.ID,
+		TransactionId:  payment.TransactionID,
+		ReceivedAmount: payment.ReceivedAmount,
+	}
+
+	if version == payapi.WebhookVersionLegacy {
+		// only ever told about completed deposits
+		if status != payapi.StatusCompleted {
+			return nil
+		}
+
+		body = &legacyDepositRequest{
+			ExternalId:    payment.ID,
+			TransactionId: payment.TransactionID,
+		}
+	}
+
+	err = enqueueWebhook(ctx, tx, delivery, version, body)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s webhook for payment %d: %w", event, payment.ID, err)
+	}
+
+	return nil
+}
+
+// queues the platform's withdrawal webhook for a withdrawal's new status, call before committing tx
+// legacy platforms aren't sent withdrawal events
+func enqueueWithdrawalWebhook(ctx context.Context, tx pgx.Tx, status int, withdrawal *payapi.Withdrawal) error {
+	type withdrawalRequest struct {
+		Event         string  `json:"event"`
+		WithdrawalId  int     `json:"withdrawalId"`  // PayAPI withdrawal ID
+		ExternalId    int     `json:"externalId"`    // platform withdrawal ID
+		Status        int     `json:"status"`        // payapi.WithdrawalStatus*
+		TransactionId *string `json:"transactionId"` // algorand txid, once broadcast
+		FailureReason *string `json:"failureReason"` // set when status is failed
+	}
+
+	var event string
+
+	switch status {
+	case payapi.WithdrawalStatusBroadcast:
+		event = payapi.WebhookEventWithdrawalBroadcast
+	case payapi.WithdrawalStatusConfirmed:
+		event = payapi.WebhookEventWithdrawalConfirmed
+	case payapi.WithdrawalStatusFailed:
+		event = payapi.WebhookEventWithdrawalFailed
+	default:
+		return nil
+	}
+
+	version, err := findWebhookVersion(ctx, tx, withdrawal.PlatformId)
+	if err != nil {
+		return err
+	} else if version == payapi.WebhookVersionLegacy {
+		return nil
+	}
+
+	delivery := &payapi.WebhookDelivery{
+		PlatformId:   withdrawal.PlatformId,
+		WithdrawalId: &withdrawal.ID,
+		Event:        event,
+	}
+
+	err = enqueueWebhook(ctx, tx, delivery, version, &withdrawalRequest{
+		Event:         event,
+		WithdrawalId:  withdrawal.ID,
+		ExternalId:    withdrawal.ExternalId,
+		Status:        status,
+		TransactionId: withdrawal.TransactionID,
+		FailureReason: withdrawal.FailureReason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue %s webhook for withdrawal %d: %w", event, withdrawal.ID, err)
+	}
+
+	return nil
+}
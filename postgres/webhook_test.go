@@ -0,0 +1,222 @@
+package postgres_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestWebhookService_DeliverPendingWebhooks(t *testing.T) {
+	// ensure queued webhooks are signed, delivered and retried
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		calls := 0
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:    "Test Platform",
+			Active:  true,
+			Address: "AAAA",
+		}
+
+		// first call fails, second succeeds
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+
+			body, _ := io.ReadAll(r.Body)
+			timestamp, _ := strconv.ParseInt(r.Header.Get("X-PayAPI-Timestamp"), 10, 64)
+
+			if got, want := r.Header.Get("X-PayAPI-Signature"), "sha256="+payapi.SignWebhookPayload(platform.WebhookSecret, timestamp, body); got != want {
+				t.Errorf("signature=%v, want %v", got, want)
+			}
+
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		platform.WebhookUrl = server.URL
+
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		// platform must accept the asset
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paymentService := postgres.NewPaymentService(db.DB)
+		paymentService.PlatformService = platformService
+
+		payment := &payapi.Payment{
+			PlatformId: platform.ID,
+			Status:     payapi.StatusCreated,
+			Sender:     "AAAA",
+			AssetId:    1337,
+			Amount:     69,
+			ExternalId: 420,
+		}
+
+		err = paymentService.CreatePayment(ctx, payment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// queues a deposit.cancelled webhook
+		_, err = paymentService.CancelPayment(ctx, payment.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewWebhookService(db.DB)
+
+		n, err := s.DeliverPendingWebhooks(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("attempted=%v, want %v", n, 1)
+		}
+
+		deliveries, err := s.FindWebhookDeliveries(ctx, payapi.WebhookDeliveryFilter{PaymentId: &payment.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(deliveries) != 1 {
+			t.Fatalf("len(deliveries)=%v, want %v", len(deliveries), 1)
+		}
+
+		d := deliveries[0]
+
+		if d.Event != payapi.WebhookEventDepositCancelled {
+			t.Fatalf("Event=%v, want %v", d.Event, payapi.WebhookEventDepositCancelled)
+		} else if d.Status != payapi.WebhookStatusPending || d.Attempts != 1 {
+			t.Fatalf("Status=%v Attempts=%v, want pending after 1 attempt", d.Status, d.Attempts)
+		} else if d.LastStatusCode == nil || *d.LastStatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("LastStatusCode=%v, want %v", d.LastStatusCode, http.StatusServiceUnavailable)
+		}
+
+		// not due yet, backoff
+		n, err = s.DeliverPendingWebhooks(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 0 {
+			t.Fatalf("attempted=%v, want %v", n, 0)
+		}
+
+		_, err = db.DB.Exec(ctx, `UPDATE webhook_deliveries SET next_attempt_at = NOW()`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.DeliverPendingWebhooks(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deliveries, err = s.FindWebhookDeliveries(ctx, payapi.WebhookDeliveryFilter{PaymentId: &payment.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if d := deliveries[0]; d.Status != payapi.WebhookStatusDelivered || d.Attempts != 2 || d.DeliveredAt == nil {
+			t.Fatalf("Status=%v Attempts=%v, want delivered after 2 attempts", d.Status, d.Attempts)
+		}
+	})
+	t.Run("Legacy", func(t *testing.T) {
+		// legacy platforms are only called on completion, the way they always were
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		var method string
+		var body []byte
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:           "Test Platform",
+			Active:         true,
+			Address:        "AAAA",
+			WebhookUrl:     server.URL,
+			WebhookVersion: payapi.WebhookVersionLegacy,
+		}
+
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paymentService := postgres.NewPaymentService(db.DB)
+		paymentService.PlatformService = platformService
+
+		cancelled := &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 420}
+		completed := &payapi.Payment{PlatformId: platform.ID, Sender: "AAAA", AssetId: 1337, Amount: 69, ExternalId: 421}
+
+		for _, p := range []*payapi.Payment{cancelled, completed} {
+			err = paymentService.CreatePayment(ctx, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// nothing queued
+		_, err = paymentService.CancelPayment(ctx, cancelled.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = paymentService.HoldPaymentForReview(ctx, completed.ID, "TXID", 69)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = paymentService.ApprovePayment(ctx, completed.ID, "ok")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewWebhookService(db.DB)
+
+		n, err := s.DeliverPendingWebhooks(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Fatalf("attempted=%v, want %v", n, 1)
+		}
+
+		if method != http.MethodGet {
+			t.Fatalf("method=%v, want %v", method, http.MethodGet)
+		} else if want := `{"externalId":` + strconv.Itoa(completed.ID) + `,"transactionId":"TXID"}`; string(body) != want {
+			t.Fatalf("body=%s, want %s", body, want)
+		}
+	})
+}
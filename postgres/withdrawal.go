@@ -0,0 +1,432 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/algo"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var _ payapi.WithdrawalService = (*WithdrawalService)(nil)
+
+// every query returning a full withdrawal selects these, in this order
+const withdrawalColumns = `
+	id, platform_id, status, created_at, approved_at, signed_at, broadcast_at, confirmed_at, failed_at,
+	sender, receiver, asset_id, amount, transaction_id, last_valid_round, failure_reason, external_id
+`
+
+const (
+	withdrawalValidRounds = 200 // ~10 minutes, after which an unconfirmed withdrawal is failed
+
+	// withdrawals broadcast before last valid rounds were saved are given up on after this long
+	withdrawalConfirmTimeout = 2 * time.Hour
+)
+
+type WithdrawalService struct {
+	db              *pgxpool.Pool
+	PlatformService payapi.PlatformService
+	IndexerService  algo.IndexerService
+
+	// house account paying out withdrawals, only required to send
+	AccountService *algo.AccountService
+}
+
+func NewWithdrawalService(db *pgxpool.Pool) *WithdrawalService {
+	return &WithdrawalService{
+		db: db,
+	}
+}
+
+func scanWithdrawal(row pgx.Row) (*payapi.Withdrawal, error) {
+	w := &payapi.Withdrawal{}
+
+	err := row.Scan(
+		&w.ID,
+		&w.PlatformId,
+		&w.Status,
+		&w.CreatedAt,
+		&w.ApprovedAt,
+		&w.SignedAt,
+		&w.BroadcastAt,
+		&w.ConfirmedAt,
+		&w.FailedAt,
+		&w.Sender,
+		&w.Receiver,
+		&w.AssetId,
+		&w.Amount,
+		&w.TransactionID,
+		&w.LastValidRound,
+		&w.FailureReason,
+		&w.ExternalId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (s *WithdrawalService) FindWithdrawalByID(ctx context.Context, id int) (*payapi.Withdrawal, error) {
+	sql := `SELECT ` + withdrawalColumns + ` FROM withdrawals WHERE id = $1 LIMIT 1`
+
+	w, err := scanWithdrawal(s.db.QueryRow(ctx, sql, id))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (s *WithdrawalService) FindWithdrawals(ctx context.Context, filter payapi.WithdrawalFilter) ([]*payapi.Withdrawal, error) {
+	sql := `SELECT ` + withdrawalColumns + `
+		FROM withdrawals
+		WHERE ($1::INT IS NULL OR platform_id = $1) AND ($2::INT IS NULL OR status = $2)
+		ORDER BY created_at ASC
+	`
+
+	rows, err := s.db.Query(ctx, sql, filter.PlatformId, filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	withdrawals := make([]*payapi.Withdrawal, 0)
+
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		withdrawals = append(withdrawals, w)
+	}
+
+	return withdrawals, rows.Err()
+}
+
+func (s *WithdrawalService) CreateWithdrawal(ctx context.Context, withdrawal *payapi.Withdrawal) error {
+	// ensure withdrawal is valid
+	err := withdrawal.Validate()
+	if err != nil {
+		return err
+	}
+
+	platform, err := s.PlatformService.FindPlatformByID(ctx, withdrawal.PlatformId)
+	if err != nil {
+		return errors.New("failed to find platform")
+	}
+
+	if !platform.Active {
+		// platform is not currently accepting payments
+		return errors.New("platform is not currently active")
+	}
+
+	// only pay out in assets the platform takes
+	_, err = s.PlatformService.FindPlatformAsset(ctx, withdrawal.PlatformId, withdrawal.AssetId)
+	if err != nil {
+		return err
+	}
+
+	sql := `
+		INSERT INTO withdrawals (platform_id, status, created_at, receiver, asset_id, amount, external_id)
+		VALUES ($1, $2, NOW(), $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	err = s.db.QueryRow(
+		ctx,
+		sql,
+		withdrawal.PlatformId,
+		payapi.WithdrawalStatusRequested,
+		withdrawal.Receiver,
+		withdrawal.AssetId,
+		withdrawal.Amount,
+		withdrawal.ExternalId,
+	).Scan(
+		&withdrawal.ID,
+		&withdrawal.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	withdrawal.Status = payapi.WithdrawalStatusRequested
+
+	return nil
+}
+
+func (s *WithdrawalService) ApproveWithdrawal(ctx context.Context, id int) (*payapi.Withdrawal, error) {
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, approved_at = NOW()
+		WHERE id = $2 AND status = $3
+		RETURNING ` + withdrawalColumns
+
+	w, err := scanWithdrawal(s.db.QueryRow(ctx, sql, payapi.WithdrawalStatusApproved, id, payapi.WithdrawalStatusRequested))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("withdrawal is not awaiting approval")
+	}
+
+	return w, nil
+}
+
+func (s *WithdrawalService) SendWithdrawal(ctx context.Context, id int) (*payapi.Withdrawal, error) {
+	if s.AccountService == nil {
+		return nil, errors.New("no house account configured")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// claim the withdrawal first, whatever happens next it will never be sent again
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, signed_at = NOW(), sender = $2
+		WHERE id = $3 AND status = $4
+		RETURNING ` + withdrawalColumns
+
+	w, err := scanWithdrawal(tx.QueryRow(ctx, sql, payapi.WithdrawalStatusSigned, s.AccountService.AccountAddress, id, payapi.WithdrawalStatusApproved))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("withdrawal is not approved")
+	}
+
+	signed, err := s.AccountService.SignTransfer(ctx, algo.GroupTransfer{
+		Receiver: w.Receiver,
+		AssetId:  w.AssetId,
+		Amount:   w.Amount,
+		Note:     []byte(strconv.FormatInt(int64(w.ExternalId), 10)),
+	}, withdrawalValidRounds)
+	if err != nil {
+		// nothing was sent, still approved
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	// recorded with the claim, so whatever happens next the txid is checked before it could ever be failed
+	sql = `
+		UPDATE withdrawals
+		SET transaction_id = $1, last_valid_round = $2
+		WHERE id = $3
+	`
+
+	_, err = tx.Exec(ctx, sql, signed.TxIDs[0], signed.LastValidRound, w.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	w.TransactionID = &signed.TxIDs[0]
+	w.LastValidRound = &signed.LastValidRound
+
+	err = s.AccountService.SendSignedGroup(ctx, signed)
+	if err != nil {
+		// algod may still have taken it, left signed until it confirms or expires
+		return nil, fmt.Errorf("withdrawal %d signed as %s failed to broadcast, left signed: %w", w.ID, *w.TransactionID, err)
+	}
+
+	err = s.markWithdrawalBroadcast(ctx, w)
+	if err != nil {
+		// txn is already on its way and its txid saved, confirming works from signed too
+		fmt.Printf("err: %v\n", err)
+		return nil, fmt.Errorf("withdrawal %d sent as %s but failed to update", w.ID, *w.TransactionID)
+	}
+
+	return w, nil
+}
+
+func (s *WithdrawalService) markWithdrawalBroadcast(ctx context.Context, w *payapi.Withdrawal) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, broadcast_at = NOW()
+		WHERE id = $2 AND status = $3
+		RETURNING broadcast_at
+	`
+
+	err = tx.QueryRow(ctx, sql, payapi.WithdrawalStatusBroadcast, w.ID, payapi.WithdrawalStatusSigned).Scan(&w.BroadcastAt)
+	if err != nil {
+		return err
+	}
+
+	w.Status = payapi.WithdrawalStatusBroadcast
+
+	// call hook endpoint, if any
+	err = enqueueWithdrawalWebhook(ctx, tx, payapi.WithdrawalStatusBroadcast, w)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *WithdrawalService) ConfirmWithdrawal(ctx context.Context, id int) (*payapi.Withdrawal, error) {
+	w, err := s.FindWithdrawalByID(ctx, id)
+	if err != nil {
+		return nil, errors.New("withdrawal not found")
+	}
+
+	sent := w.Status == payapi.WithdrawalStatusSigned || w.Status == payapi.WithdrawalStatusBroadcast
+	if !sent || w.TransactionID == nil || w.Sender == nil || w.SignedAt == nil {
+		return nil, errors.New("withdrawal has not been sent")
+	}
+
+	// check payout and verify
+	ok, err := s.IndexerService.CheckTransaction(
+		ctx,
+		*w.TransactionID,
+		*w.Sender,
+		w.Receiver,
+		w.AssetId,
+		w.Amount,
+		w.SignedAt.Add(-1*time.Minute), // allow for clock drift between us and the network
+		time.Now().UTC().Add(1*time.Minute),
+		strconv.FormatInt(int64(w.ExternalId), 10),
+	)
+	if err != nil || !ok {
+		expired, eerr := s.withdrawalExpired(ctx, w)
+		if eerr != nil {
+			return nil, eerr
+		} else if expired {
+			return s.expireWithdrawal(ctx, w)
+		}
+
+		return nil, fmt.Errorf("withdrawal not yet confirmed: %v", err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, confirmed_at = NOW()
+		WHERE id = $2 AND status = ANY($3)
+		RETURNING confirmed_at
+	`
+
+	err = tx.QueryRow(ctx, sql, payapi.WithdrawalStatusConfirmed, w.ID, []int{payapi.WithdrawalStatusSigned, payapi.WithdrawalStatusBroadcast}).Scan(&w.ConfirmedAt)
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("failed to update")
+	}
+
+	w.Status = payapi.WithdrawalStatusConfirmed
+
+	// call hook endpoint, if any
+	err = enqueueWithdrawalWebhook(ctx, tx, payapi.WithdrawalStatusConfirmed, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, tx.Commit(ctx)
+}
+
+// the txn can never confirm once the indexer is past its last valid round without it
+func (s *WithdrawalService) withdrawalExpired(ctx context.Context, w *payapi.Withdrawal) (bool, error) {
+	if w.LastValidRound == nil {
+		// sent before last valid rounds were saved
+		return w.BroadcastAt != nil && time.Since(*w.BroadcastAt) > withdrawalConfirmTimeout, nil
+	}
+
+	indexed, err := s.IndexerService.LatestRound(ctx)
+	if err != nil {
+		return false, err
+	} else if indexed <= *w.LastValidRound {
+		return false, nil
+	}
+
+	_, err = s.IndexerService.GetTransfer(ctx, *w.TransactionID)
+	if errors.Is(err, algo.ErrTransactionNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// on chain but didn't match, left as is to be looked at by hand
+	return false, nil
+}
+
+func (s *WithdrawalService) expireWithdrawal(ctx context.Context, w *payapi.Withdrawal) (*payapi.Withdrawal, error) {
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, failure_reason = $2, failed_at = NOW()
+		WHERE id = $3 AND status = ANY($4)
+		RETURNING ` + withdrawalColumns
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	failed, err := scanWithdrawal(tx.QueryRow(ctx, sql, payapi.WithdrawalStatusFailed, payapi.ErrWithdrawalExpired.Error(), w.ID, []int{payapi.WithdrawalStatusSigned, payapi.WithdrawalStatusBroadcast}))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("failed to update")
+	}
+
+	// call hook endpoint, if any
+	err = enqueueWithdrawalWebhook(ctx, tx, payapi.WithdrawalStatusFailed, failed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return failed, payapi.ErrWithdrawalExpired
+}
+
+func (s *WithdrawalService) FailWithdrawal(ctx context.Context, id int, reason string) (*payapi.Withdrawal, error) {
+	// once signed a txn may be out there, only its expiry can fail it
+	sql := `
+		UPDATE withdrawals
+		SET status = $1, failure_reason = $2, failed_at = NOW()
+		WHERE id = $3 AND status = ANY($4)
+		RETURNING ` + withdrawalColumns
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	w, err := scanWithdrawal(tx.QueryRow(ctx, sql, payapi.WithdrawalStatusFailed, reason, id, []int{payapi.WithdrawalStatusRequested, payapi.WithdrawalStatusApproved}))
+	if err != nil {
+		fmt.Printf("err: %v\n", err)
+		return nil, errors.New("withdrawal has already been sent, confirmed or failed")
+	}
+
+	// call hook endpoint, if any
+	err = enqueueWithdrawalWebhook(ctx, tx, payapi.WithdrawalStatusFailed, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, tx.Commit(ctx)
+}
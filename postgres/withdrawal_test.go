@@ -0,0 +1,150 @@
+package postgres_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/algo-casino/payapi"
+	"github.com/algo-casino/payapi/postgres"
+)
+
+func TestWithdrawalService_CreateWithdrawal(t *testing.T) {
+	// ensure a withdrawal can be created and walks through approval
+
+	t.Run("OK", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{
+			Name:       "Test Platform",
+			Active:     true,
+			Address:    "AAAA",
+			WebhookUrl: "https://domain.to.nowhere/",
+		}
+
+		// create test platform for below test
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatalf("failed to create test platform err: %v\n", err)
+		}
+
+		// platform must accept the asset
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewWithdrawalService(db.DB)
+		s.PlatformService = platformService
+
+		withdrawal := &payapi.Withdrawal{
+			PlatformId: platform.ID,
+			Status:     payapi.WithdrawalStatusRequested,
+			Receiver:   "BBBB",
+			AssetId:    1337,
+			Amount:     69,
+			ExternalId: 420,
+		}
+
+		err = s.CreateWithdrawal(ctx, withdrawal)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := withdrawal.ID, 1; got != want {
+			t.Fatalf("ID=%v, want %v", got, want)
+		}
+
+		fetched, err := s.FindWithdrawalByID(ctx, withdrawal.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(withdrawal, fetched) {
+			t.Fatalf("mismatch: %#v != %#v", withdrawal, fetched)
+		}
+
+		approved, err := s.ApproveWithdrawal(ctx, withdrawal.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if got, want := approved.Status, payapi.WithdrawalStatusApproved; got != want {
+			t.Fatalf("Status=%v, want %v", got, want)
+		}
+
+		// can only approve once
+		_, err = s.ApproveWithdrawal(ctx, withdrawal.ID)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// cannot send without a house account
+		_, err = s.SendWithdrawal(ctx, withdrawal.ID)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("ErrFailSigned", func(t *testing.T) {
+		// a signed txn may still land, it can't be failed by hand
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		platformService := postgres.NewPlatformService(db.DB)
+
+		platform := &payapi.Platform{Name: "Test Platform", Active: true, Address: "AAAA", WebhookUrl: "https://domain.to.nowhere/"}
+
+		err := platformService.CreatePlatform(ctx, platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = platformService.SavePlatformAsset(ctx, &payapi.PlatformAsset{PlatformId: platform.ID, AssetId: 1337, Name: "TEST"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := postgres.NewWithdrawalService(db.DB)
+		s.PlatformService = platformService
+
+		withdrawal := &payapi.Withdrawal{PlatformId: platform.ID, Receiver: "BBBB", AssetId: 1337, Amount: 69, ExternalId: 420}
+
+		err = s.CreateWithdrawal(ctx, withdrawal)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.DB.Exec(ctx, `UPDATE withdrawals SET status = $1, signed_at = NOW(), sender = 'AAAA', transaction_id = 'TXID', last_valid_round = 1000 WHERE id = $2`, payapi.WithdrawalStatusSigned, withdrawal.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.FailWithdrawal(ctx, withdrawal.ID, "by hand")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		fetched, err := s.FindWithdrawalByID(ctx, withdrawal.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if fetched.Status != payapi.WithdrawalStatusSigned || *fetched.LastValidRound != 1000 {
+			t.Fatalf("unexpected withdrawal: %+v", fetched)
+		}
+	})
+
+	t.Run("ErrWithdrawalRequired", func(t *testing.T) {
+		db := MustOpenDatabase(t)
+		defer MustCloseDatabase(t, db)
+
+		ctx := context.Background()
+
+		s := postgres.NewWithdrawalService(db.DB)
+
+		err := s.CreateWithdrawal(ctx, &payapi.Withdrawal{})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// Package reward splits a profit between stakers in whole base units
+//
+// amounts are worked out exactly with big.Rat and rounded with the largest remainder method,
+// so what's paid out, the house fee and anything unallocated always add up to the profit
+package reward
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// basis points in 100%
+const MaxBps uint64 = 10000
+
+type (
+	// how a profit is split
+	Policy struct {
+		// cut of the profit the house keeps, in basis points
+		HouseFeeBps uint64 `json:"houseFeeBps"`
+
+		// smallest amount worth paying out, stakers that would get less are left out
+		// and their part goes to everyone else
+		MinPayout uint64 `json:"minPayout"`
+	}
+
+	// a staker's claim on the profit
+	Share struct {
+		Key    string   // address, also breaks ties so the result doesn't depend on the order of shares
+		Weight *big.Rat // anything proportional to holdings, e.g. chip equivalent
+	}
+
+	Allocation struct {
+		Key    string
+		Weight *big.Rat
+
+		// fraction of the distributable profit Weight is worth, before rounding
+		Quota *big.Rat
+
+		Amount uint64
+	}
+
+	// Profit = HouseFee + Unallocated + sum of allocation amounts, always
+	Result struct {
+		Profit        uint64
+		HouseFee      uint64
+		Distributable uint64 // Profit less HouseFee
+
+		// distributable profit nobody qualified for, only non zero when there are no allocations
+		Unallocated uint64
+
+		// in the order of the shares, stakers below MinPayout and zero weights are left out
+		Allocations []*Allocation
+	}
+)
+
+var (
+	ErrInvalidFee    = errors.New("house fee cannot be more than 100%")
+	ErrInvalidWeight = errors.New("weight must be zero or more")
+	ErrDuplicateKey  = errors.New("duplicate share key")
+)
+
+func (p Policy) Validate() error {
+	if p.HouseFeeBps > MaxBps {
+		return ErrInvalidFee
+	}
+
+	return nil
+}
+
+// policy set by STAKING_HOUSE_FEE_BPS and STAKING_MIN_PAYOUT, no fee or minimum unless set
+// every binary working out staking results loads it here so they can't disagree
+func PolicyFromEnv() (Policy, error) {
+	var policy Policy
+
+	for _, e := range []struct {
+		env string
+		v   *uint64
+	}{
+		{"STAKING_HOUSE_FEE_BPS", &policy.HouseFeeBps},
+		{"STAKING_MIN_PAYOUT", &policy.MinPayout},
+	} {
+		if s := os.Getenv(e.env); s != "" {
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid %s: %w", e.env, err)
+			}
+			*e.v = n
+		}
+	}
+
+	return policy, policy.Validate()
+}
+
+// house's cut of profit, rounded down
+func (p Policy) HouseFee(profit uint64) uint64 {
+	fee := new(big.Int).SetUint64(profit)
+	fee.Mul(fee, new(big.Int).SetUint64(p.HouseFeeBps))
+	fee.Quo(fee, new(big.Int).SetUint64(MaxBps))
+
+	return fee.Uint64()
+}
+
+// splits profit between shares by weight, see Result for what adds up
+func Allocate(profit uint64, shares []Share, policy Policy) (*Result, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+
+	// only positive weights take part
+	live := make([]Share, 0, len(shares))
+
+	for _, s := range shares {
+		if seen[s.Key] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, s.Key)
+		} else if s.Weight == nil || s.Weight.Sign() < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWeight, s.Key)
+		}
+		seen[s.Key] = true
+
+		if s.Weight.Sign() > 0 {
+			live = append(live, s)
+		}
+	}
+
+	res := &Result{
+		Profit:      profit,
+		HouseFee:    policy.HouseFee(profit),
+		Allocations: make([]*Allocation, 0),
+	}
+	res.Distributable = profit - res.HouseFee
+
+	for len(live) > 0 {
+		quotas, amounts := largestRemainder(res.Distributable, live)
+
+		// smallest weight paid under the minimum, amounts never go down as weight goes up
+		var cutoff *big.Rat
+		for i, s := range live {
+			if amounts[i] < policy.MinPayout && (cutoff == nil || s.Weight.Cmp(cutoff) < 0) {
+				cutoff = s.Weight
+			}
+		}
+
+		if cutoff == nil {
+			for i, s := range live {
+				res.Allocations = append(res.Allocations, &Allocation{
+					Key:    s.Key,
+					Weight: s.Weight,
+					Quota:  quotas[i],
+					Amount: amounts[i],
+				})
+			}
+
+			return res, nil
+		}
+
+		// drop the smallest stakers that missed out, equal weights go together, then try again with more for everyone else
+		kept := make([]Share, 0, len(live))
+		for _, s := range live {
+			if s.Weight.Cmp(cutoff) > 0 {
+				kept = append(kept, s)
+			}
+		}
+		live = kept
+	}
+
+	res.Unallocated = res.Distributable
+
+	return res, nil
+}
+
+// total split by weight, everyone gets their quota rounded down and what's left over goes
+// one each to the largest fractional parts (ties to the smaller key)
+func largestRemainder(total uint64, shares []Share) ([]*big.Rat, []uint64) {
+	sum := new(big.Rat)
+	for _, s := range shares {
+		sum.Add(sum, s.Weight)
+	}
+
+	t := new(big.Rat).SetInt(new(big.Int).SetUint64(total))
+
+	quotas := make([]*big.Rat, len(shares))
+	amounts := make([]uint64, len(shares))
+	remainders := make([]*big.Rat, len(shares))
+
+	allocated := uint64(0)
+
+	for i, s := range shares {
+		quotas[i] = new(big.Rat).Quo(s.Weight, sum)
+
+		exact := new(big.Rat).Mul(t, quotas[i])
+		floor := new(big.Int).Quo(exact.Num(), exact.Denom())
+
+		amounts[i] = floor.Uint64()
+		remainders[i] = exact.Sub(exact, new(big.Rat).SetInt(floor))
+
+		allocated += amounts[i]
+	}
+
+	order := make([]int, len(shares))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if c := remainders[i].Cmp(remainders[j]); c != 0 {
+			return c > 0
+		}
+		return shares[i].Key < shares[j].Key
+	})
+
+	// less than one per share is left over
+	for n := uint64(0); n < total-allocated; n++ {
+		amounts[order[n]]++
+	}
+
+	return quotas, amounts
+}
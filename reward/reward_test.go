@@ -0,0 +1,333 @@
+package reward_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/algo-casino/payapi/reward"
+)
+
+// random profit, policy and stakers for property tests
+type scenario struct {
+	Profit uint64
+	Policy reward.Policy
+	Shares []reward.Share
+}
+
+func (scenario) Generate(r *rand.Rand, size int) reflect.Value {
+	sc := scenario{
+		Policy: reward.Policy{HouseFeeBps: uint64(r.Intn(int(reward.MaxBps) + 1))},
+	}
+
+	// small, large and the very largest profits
+	switch r.Intn(3) {
+	case 0:
+		sc.Profit = uint64(r.Intn(1000))
+	case 1:
+		sc.Profit = r.Uint64() >> r.Intn(64)
+	case 2:
+		sc.Profit = math.MaxUint64 - uint64(r.Intn(10))
+	}
+
+	if r.Intn(2) == 0 {
+		sc.Policy.MinPayout = uint64(r.Intn(100))
+	}
+
+	n := r.Intn(size + 1)
+
+	for i := 0; i < n; i++ {
+		// fractional weights, zeros and plenty of equal weights
+		weight := big.NewRat(int64(r.Intn(50)), int64(r.Intn(9)+1))
+
+		sc.Shares = append(sc.Shares, reward.Share{Key: fmt.Sprintf("ADDR%d", i), Weight: weight})
+	}
+
+	return reflect.ValueOf(sc)
+}
+
+func allocate(t *testing.T, sc scenario) *reward.Result {
+	res, err := reward.Allocate(sc.Profit, sc.Shares, sc.Policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+func TestAllocate_SumsToProfit(t *testing.T) {
+	f := func(sc scenario) bool {
+		res := allocate(t, sc)
+
+		total := new(big.Int).SetUint64(res.HouseFee)
+		total.Add(total, new(big.Int).SetUint64(res.Unallocated))
+
+		for _, a := range res.Allocations {
+			total.Add(total, new(big.Int).SetUint64(a.Amount))
+		}
+
+		if total.Cmp(new(big.Int).SetUint64(sc.Profit)) != 0 {
+			t.Logf("total=%v, want %v", total, sc.Profit)
+			return false
+		}
+
+		// the house only keeps what's distributable when nobody qualified
+		return res.Distributable == sc.Profit-res.HouseFee && (res.Unallocated == 0 || len(res.Allocations) == 0)
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate_HouseFee(t *testing.T) {
+	f := func(sc scenario) bool {
+		res := allocate(t, sc)
+
+		// fee is rounded down, never more than the policy's cut
+		exact := new(big.Rat).SetFrac(
+			new(big.Int).Mul(new(big.Int).SetUint64(sc.Profit), new(big.Int).SetUint64(sc.Policy.HouseFeeBps)),
+			new(big.Int).SetUint64(reward.MaxBps),
+		)
+		fee := new(big.Rat).SetInt(new(big.Int).SetUint64(res.HouseFee))
+
+		diff := new(big.Rat).Sub(exact, fee)
+
+		return diff.Sign() >= 0 && diff.Cmp(big.NewRat(1, 1)) < 0
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate_WithinOneOfQuota(t *testing.T) {
+	f := func(sc scenario) bool {
+		res := allocate(t, sc)
+
+		distributable := new(big.Rat).SetInt(new(big.Int).SetUint64(res.Distributable))
+
+		for _, a := range res.Allocations {
+			exact := new(big.Rat).Mul(distributable, a.Quota)
+
+			diff := new(big.Rat).Sub(new(big.Rat).SetInt(new(big.Int).SetUint64(a.Amount)), exact)
+			if diff.Abs(diff).Cmp(big.NewRat(1, 1)) >= 0 {
+				t.Logf("%s amount=%d, exact %v", a.Key, a.Amount, exact.FloatString(6))
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate_MinPayout(t *testing.T) {
+	f := func(sc scenario) bool {
+		res := allocate(t, sc)
+
+		paid := make(map[string]bool)
+
+		for _, a := range res.Allocations {
+			if a.Amount < sc.Policy.MinPayout {
+				return false
+			}
+			paid[a.Key] = true
+		}
+
+		// anyone left out didn't stake more than someone paid
+		for _, s := range sc.Shares {
+			if paid[s.Key] {
+				continue
+			}
+
+			for _, a := range res.Allocations {
+				if s.Weight.Cmp(a.Weight) >= 0 {
+					t.Logf("%s left out with weight %v, %s paid with %v", s.Key, s.Weight, a.Key, a.Weight)
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate_Monotonic(t *testing.T) {
+	f := func(sc scenario) bool {
+		res := allocate(t, sc)
+
+		for _, a := range res.Allocations {
+			for _, b := range res.Allocations {
+				if a.Weight.Cmp(b.Weight) > 0 && a.Amount < b.Amount {
+					t.Logf("%s weight %v paid %d, %s weight %v paid %d", a.Key, a.Weight, a.Amount, b.Key, b.Weight, b.Amount)
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate_OrderIndependent(t *testing.T) {
+	f := func(sc scenario, seed int64) bool {
+		res := allocate(t, sc)
+
+		shuffled := append([]reward.Share(nil), sc.Shares...)
+		rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		other, err := reward.Allocate(sc.Profit, shuffled, sc.Policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		amounts := make(map[string]uint64)
+		for _, a := range res.Allocations {
+			amounts[a.Key] = a.Amount
+		}
+
+		if len(other.Allocations) != len(res.Allocations) {
+			return false
+		}
+
+		for _, a := range other.Allocations {
+			if amt, ok := amounts[a.Key]; !ok || amt != a.Amount {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	t.Run("LargestRemainder", func(t *testing.T) {
+		// thirds of 100, the spare unit goes to the smallest key
+		res, err := reward.Allocate(100, []reward.Share{
+			{Key: "C", Weight: big.NewRat(1, 1)},
+			{Key: "A", Weight: big.NewRat(1, 1)},
+			{Key: "B", Weight: big.NewRat(1, 1)},
+		}, reward.Policy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []uint64{33, 34, 33}
+		for i, a := range res.Allocations {
+			if a.Amount != want[i] {
+				t.Fatalf("%s Amount=%v, want %v", a.Key, a.Amount, want[i])
+			}
+		}
+	})
+
+	t.Run("HouseFeeAndMinPayout", func(t *testing.T) {
+		// 10% fee leaves 900, C's 9 would be under the minimum so goes to A and B
+		res, err := reward.Allocate(1000, []reward.Share{
+			{Key: "A", Weight: big.NewRat(600, 1)},
+			{Key: "B", Weight: big.NewRat(390, 1)},
+			{Key: "C", Weight: big.NewRat(10, 1)},
+		}, reward.Policy{HouseFeeBps: 1000, MinPayout: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.HouseFee != 100 {
+			t.Fatalf("HouseFee=%v, want %v", res.HouseFee, 100)
+		} else if len(res.Allocations) != 2 {
+			t.Fatalf("len(Allocations)=%v, want %v", len(res.Allocations), 2)
+		} else if res.Allocations[0].Amount != 545 {
+			t.Fatalf("A Amount=%v, want %v", res.Allocations[0].Amount, 545)
+		} else if res.Allocations[1].Amount != 355 {
+			t.Fatalf("B Amount=%v, want %v", res.Allocations[1].Amount, 355)
+		}
+	})
+
+	t.Run("NoneQualify", func(t *testing.T) {
+		res, err := reward.Allocate(10, []reward.Share{
+			{Key: "A", Weight: big.NewRat(1, 1)},
+			{Key: "B", Weight: big.NewRat(1, 1)},
+		}, reward.Policy{MinPayout: 6})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Allocations) != 0 {
+			t.Fatalf("len(Allocations)=%v, want %v", len(res.Allocations), 0)
+		} else if res.Unallocated != 10 {
+			t.Fatalf("Unallocated=%v, want %v", res.Unallocated, 10)
+		}
+	})
+
+	t.Run("ErrInvalidFee", func(t *testing.T) {
+		_, err := reward.Allocate(10, nil, reward.Policy{HouseFeeBps: reward.MaxBps + 1})
+		if !errors.Is(err, reward.ErrInvalidFee) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrInvalidWeight", func(t *testing.T) {
+		_, err := reward.Allocate(10, []reward.Share{{Key: "A", Weight: big.NewRat(-1, 1)}}, reward.Policy{})
+		if !errors.Is(err, reward.ErrInvalidWeight) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ErrDuplicateKey", func(t *testing.T) {
+		_, err := reward.Allocate(10, []reward.Share{
+			{Key: "A", Weight: big.NewRat(1, 1)},
+			{Key: "A", Weight: big.NewRat(2, 1)},
+		}, reward.Policy{})
+		if !errors.Is(err, reward.ErrDuplicateKey) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("STAKING_HOUSE_FEE_BPS", "500")
+	t.Setenv("STAKING_MIN_PAYOUT", "")
+
+	policy, err := reward.PolicyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	} else if want := (reward.Policy{HouseFeeBps: 500}); policy != want {
+		t.Fatalf("policy=%+v, want %+v", policy, want)
+	}
+
+	t.Setenv("STAKING_HOUSE_FEE_BPS", "10001")
+
+	_, err = reward.PolicyFromEnv()
+	if !errors.Is(err, reward.ErrInvalidFee) {
+		t.Fatalf("err=%v, want %v", err, reward.ErrInvalidFee)
+	}
+
+	t.Setenv("STAKING_HOUSE_FEE_BPS", "five")
+
+	_, err = reward.PolicyFromEnv()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -3,6 +3,7 @@ package stake
 import (
 	"context"
 	"database/sql"
+	"sort"
 	"time"
 )
 
@@ -35,6 +36,18 @@ type (
 		Entries       []*LeaderboardEntry `json:"entries"`
 	}
 
+	// gross gaming revenue of one game type in one currency on one UTC day
+	GameProfit struct {
+		Day      time.Time `json:"day"`
+		GameType string    `json:"gameType"` // games.gameable_type, eg Packages\GameDice\Models\Dice
+		Currency string    `json:"currency"`
+
+		BetCount uint64  `json:"betCount"`
+		Bet      float64 `json:"bet"`
+		Win      float64 `json:"win"`
+		Profit   float64 `json:"profit"` // bet less win
+	}
+
 	StakeService struct {
 		db *sql.DB
 
@@ -115,7 +128,7 @@ func (s *StakeService) GetTopTenWagered(ctx context.Context, startTime, endTime
 
 func (s *StakeService) GetGrossProfitForRange(ctx context.Context, startTime, endTime time.Time) (float64, error) {
 	sql := `
-		select SUM(bet) - SUM(win) AS ggr from games
+		select COALESCE(SUM(bet) - SUM(win), 0) AS ggr from games
 		where games.status = 1
 		and games.created_at between ? and ?
 		and exists (select * from accounts where games.account_id = accounts.id
@@ -135,3 +148,89 @@ func (s *StakeService) GetGrossProfitForRange(ctx context.Context, startTime, en
 
 	return profit, nil
 }
+
+func (s *StakeService) GetGrossProfitBreakdownForRange(ctx context.Context, startTime, endTime time.Time) ([]*GameProfit, error) {
+	sql := `
+		select DATE_FORMAT(games.created_at, '%Y-%m-%d') AS day, games.gameable_type, COALESCE(accounts.currency_code, ''),
+		COUNT(*) AS bet_count, COALESCE(SUM(games.bet), 0) AS bet_total, COALESCE(SUM(games.win), 0) AS win_total
+		from games
+		join accounts on games.account_id = accounts.id
+		where games.status = 1
+		and games.created_at between ? and ?
+		and exists (select * from users where accounts.user_id = users.id)
+		group by day, games.gameable_type, accounts.currency_code
+`
+
+	// max 15 seconds so we don't lock up the entire casino forever
+	queryCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(queryCtx, sql, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := make([]*GameProfit, 0)
+
+	for rows.Next() {
+		var gp GameProfit
+		var day string
+
+		err = rows.Scan(&day, &gp.GameType, &gp.Currency, &gp.BetCount, &gp.Bet, &gp.Win)
+		if err != nil {
+			return nil, err
+		}
+
+		gp.Day, err = time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, err
+		}
+
+		gp.Profit = gp.Bet - gp.Win
+
+		breakdown = append(breakdown, &gp)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// ordered so snapshots compare
+	sort.Slice(breakdown, func(i, j int) bool {
+		a, b := breakdown[i], breakdown[j]
+		if !a.Day.Equal(b.Day) {
+			return a.Day.Before(b.Day)
+		} else if a.GameType != b.GameType {
+			return a.GameType < b.GameType
+		}
+		return a.Currency < b.Currency
+	})
+
+	return breakdown, nil
+}
+
+// profit of the breakdown from gameTypes only, every game when there are none
+func GrossProfit(breakdown []*GameProfit, gameTypes []string) float64 {
+	profit := float64(0)
+
+	for _, gp := range breakdown {
+		if len(gameTypes) > 0 && !contains(gameTypes, gp.GameType) {
+			continue
+		}
+
+		profit += gp.Profit
+	}
+
+	return profit
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,6 +3,8 @@ package payapi
 import (
 	"context"
 	"time"
+
+	"github.com/algo-casino/payapi/stake"
 )
 
 type (
@@ -11,14 +13,72 @@ type (
 		StakingPeriodID int       `json:"stakingPeriodId"`
 		CreatedAt       time.Time `json:"createdAt"`
 
+		// only from the period's funding games when it has any
 		Profit float64 `json:"profit"`
+
+		// every game by type, currency and day, null for snapshots taken before it was kept
+		Breakdown []*stake.GameProfit `json:"breakdown"`
+	}
+
+	StakeProfitSnapshotFilter struct {
+		StakingPeriodId *int       `json:"stakingPeriodId"`
+		From            *time.Time `json:"from"`
+		To              *time.Time `json:"to"`
+	}
+
+	// gross gaming revenue of one UTC day of a period, days outside the period are cut to it
+	StakeProfitDay struct {
+		Day        time.Time `json:"day"`
+		Profit     float64   `json:"profit"`
+		Cumulative float64   `json:"cumulative"` // since the period began, this day included
 	}
 )
 
+// thins snapshots ordered by time out for charting
+// with an interval only the last snapshot of each interval since the first is kept
+// with maxPoints at most that many are kept, evenly spread, the first and last always among them
+func DownsampleProfitSnapshots(snapshots []*StakeProfitSnapshot, interval time.Duration, maxPoints int) []*StakeProfitSnapshot {
+	if interval > 0 && len(snapshots) > 0 {
+		start := snapshots[0].CreatedAt
+		kept := make([]*StakeProfitSnapshot, 0)
+
+		for i, snap := range snapshots {
+			bucket := snap.CreatedAt.Sub(start) / interval
+
+			// last of its bucket
+			if i+1 == len(snapshots) || snapshots[i+1].CreatedAt.Sub(start)/interval != bucket {
+				kept = append(kept, snap)
+			}
+		}
+
+		snapshots = kept
+	}
+
+	if maxPoints <= 0 || len(snapshots) <= maxPoints {
+		return snapshots
+	} else if maxPoints == 1 {
+		return snapshots[len(snapshots)-1:]
+	}
+
+	kept := make([]*StakeProfitSnapshot, 0, maxPoints)
+
+	for i := 0; i < maxPoints; i++ {
+		kept = append(kept, snapshots[i*(len(snapshots)-1)/(maxPoints-1)])
+	}
+
+	return kept
+}
+
 type StakeProfitSnapshotService interface {
 	// find last known profit for period
 	GetLastKnownProfitForPeriod(ctx context.Context, stakingPeriodId int) (*StakeProfitSnapshot, error)
 
+	// find snapshots, ordered by time
+	FindStakeProfitSnapshots(ctx context.Context, filter StakeProfitSnapshotFilter) ([]*StakeProfitSnapshot, error)
+
+	// gross gaming revenue of each day of a period so far from its funding games, from the casino, ordered by day
+	GetDailyGrossProfitForPeriod(ctx context.Context, stakingPeriodId int) ([]*StakeProfitDay, error)
+
 	// Create, return nil on success
 	CreateStakeProfitSnapshot(ctx context.Context, stakingPeriod *StakingPeriod) (*StakeProfitSnapshot, error)
 }
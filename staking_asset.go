@@ -0,0 +1,151 @@
+package payapi
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// how an asset is valued in chips when results are calculated
+const (
+	StakingPriceSourceFixed     = "fixed"      // Weight chips per whole token
+	StakingPriceSourceChipRatio = "chip_ratio" // the period's ChipRatio chips per whole token, times Weight
+)
+
+type (
+	// an asset that can be committed to house staking
+	StakingAsset struct {
+		ID          int     `json:"id"`
+		AssetId     uint64  `json:"assetId"`
+		Name        string  `json:"name"`
+		PoolAddress *string `json:"poolAddress"` // liquidity pool the token belongs to, if any
+		Decimals    int     `json:"decimals"`
+
+		// chip equivalence, see PriceSource
+		Weight      float64 `json:"weight"`
+		PriceSource string  `json:"priceSource"`
+
+		// NFT holders have their whole balance committed by CreateAutoStake
+		AutoStake bool `json:"autoStake"`
+
+		// new commitments can include it, existing ones are still checked either way
+		Active bool `json:"active"`
+
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	StakingAssetFilter struct {
+		Active *bool `json:"active"`
+	}
+
+	// chips one whole token of a pooled asset was worth, from its pool's reserves
+	// recorded when a period is created and at each of its check runs
+	StakingAssetRatio struct {
+		ID                int    `json:"id"`
+		StakingPeriodId   int    `json:"stakingPeriodId"`
+		StakingCheckRunId *int   `json:"stakingCheckRunId"` // nil when recorded at period creation
+		AssetId           uint64 `json:"assetId"`
+
+		Ratio float64 `json:"ratio"` // used in place of the period's ChipRatio
+
+		// pool state it was derived from
+		PoolAddress     string `json:"poolAddress"`
+		Round           uint64 `json:"round"`
+		ChipReserve     uint64 `json:"chipReserve"`     // in base units
+		LiquidityIssued uint64 `json:"liquidityIssued"` // in base units
+
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	StakingAssetRatioFilter struct {
+		StakingPeriodId *int    `json:"stakingPeriodId"`
+		AssetId         *uint64 `json:"assetId"`
+	}
+)
+
+func (a *StakingAsset) Validate() error {
+	if a.AssetId == 0 {
+		return errors.New("assetId cannot be zero")
+	} else if a.Name == "" {
+		return errors.New("name cannot be empty")
+	} else if a.Decimals < 0 || a.Decimals > 19 {
+		return errors.New("decimals must be between 0 and 19")
+	} else if a.Weight < 0 {
+		return errors.New("weight cannot be negative")
+	} else if a.PriceSource != StakingPriceSourceFixed && a.PriceSource != StakingPriceSourceChipRatio {
+		return errors.New("invalid priceSource")
+	}
+
+	return nil
+}
+
+// chips amount (in base units) is worth, chipRatio is the staking period's
+// exact, so results don't depend on float rounding
+func (a *StakingAsset) ChipEquivalent(amount uint64, chipRatio float64) *big.Rat {
+	return a.ChipValue(amount, decimalRat(chipRatio))
+}
+
+// chips amount (in base units) is worth at ratio chips per whole token, ignored unless priced by chip ratio
+func (a *StakingAsset) ChipValue(amount uint64, ratio *big.Rat) *big.Rat {
+	whole := new(big.Rat).SetFrac(new(big.Int).SetUint64(amount), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.Decimals)), nil))
+
+	value := whole.Mul(whole, decimalRat(a.Weight))
+
+	if a.PriceSource == StakingPriceSourceChipRatio {
+		value.Mul(value, ratio)
+	}
+
+	return value
+}
+
+// mean of recorded ratios, nil if there are none
+func MeanStakingAssetRatio(ratios []*StakingAssetRatio) *big.Rat {
+	if len(ratios) == 0 {
+		return nil
+	}
+
+	sum := new(big.Rat)
+	for _, r := range ratios {
+		sum.Add(sum, decimalRat(r.Ratio))
+	}
+
+	return sum.Quo(sum, big.NewRat(int64(len(ratios)), 1))
+}
+
+// the decimal f was written as, 0.1 is 1/10 rather than the nearest float64
+func decimalRat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+
+	return r
+}
+
+type StakingAssetService interface {
+	// Find assets in the registry, ordered as they're checked
+	FindStakingAssets(ctx context.Context, filter StakingAssetFilter) ([]*StakingAsset, error)
+
+	// Find a registered asset by its algorand asset id
+	FindStakingAssetByAssetID(ctx context.Context, assetId uint64) (*StakingAsset, error)
+
+	// Add an asset to the registry, asset parameter will be updated upon success
+	CreateStakingAsset(ctx context.Context, asset *StakingAsset) error
+
+	// Update name, pool, weighting and flags, the asset id and decimals are fixed once registered
+	UpdateStakingAsset(ctx context.Context, asset *StakingAsset) error
+
+	// Find recorded chip ratios, ordered by time
+	FindStakingAssetRatios(ctx context.Context, filter StakingAssetRatioFilter) ([]*StakingAssetRatio, error)
+
+	// Record chip ratios, ratios parameter will be updated upon success
+	CreateStakingAssetRatios(ctx context.Context, ratios []*StakingAssetRatio) error
+}
+
+type StakingPricingService interface {
+	// Chip ratio of every asset priced by chip ratio that has a pool, from the pool's reserves now
+	// ratios are returned unsaved without a staking period, pools that can't be read are skipped
+	PriceStakingAssets(ctx context.Context) ([]*StakingAssetRatio, error)
+}
@@ -0,0 +1,110 @@
+package payapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// what earns an address a boost
+const (
+	StakingBoostHoldAsset          = "hold_asset"          // holding at least MinAmount of AssetIds together when the result is worked out
+	StakingBoostConsecutivePeriods = "consecutive_periods" // eligible in MinPeriods periods in a row, up to and including this one
+)
+
+// multipliers are in basis points, this is 1x
+const StakingBoostBaseBps = 10000
+
+type (
+	// multiplies the weight of every address it applies to, rules applying together multiply
+	StakingBoostRule struct {
+		Name          string `json:"name"`
+		Type          string `json:"type"`
+		MultiplierBps uint64 `json:"multiplierBps"` // eg 11000 for 1.1x
+
+		// hold_asset
+		AssetIds  []uint64 `json:"assetIds"`
+		MinAmount uint64   `json:"minAmount"` // in base units, 1 when zero
+
+		// consecutive_periods
+		MinPeriods int `json:"minPeriods"`
+	}
+
+	// a boost as applied to a result item
+	StakingBoost struct {
+		Name          string `json:"name"`
+		MultiplierBps uint64 `json:"multiplierBps"`
+	}
+)
+
+func (r *StakingBoostRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("boost rule needs a name")
+	} else if r.MultiplierBps < StakingBoostBaseBps {
+		return errors.New("boost multiplier can't be below 1x")
+	}
+
+	switch r.Type {
+	case StakingBoostHoldAsset:
+		if len(r.AssetIds) == 0 {
+			return errors.New("hold_asset boost needs an asset")
+		}
+	case StakingBoostConsecutivePeriods:
+		if r.MinPeriods < 2 {
+			return errors.New("consecutive_periods boost needs at least 2 periods")
+		}
+	default:
+		return errors.New("invalid boost rule type")
+	}
+
+	return nil
+}
+
+// boosts applied to staking results, STAKING_BOOST_RULES is a json list of StakingBoostRule, none unless set
+// every binary working out staking results loads them here so they can't disagree
+// eg [{"name":"staking nft","type":"hold_asset","multiplierBps":11000,"assetIds":[1032365802]},
+// {"name":"refund nft","type":"hold_asset","multiplierBps":10500,"assetIds":[797090353,797095358]},
+// {"name":"3 periods","type":"consecutive_periods","multiplierBps":11000,"minPeriods":3}]
+func StakingBoostRulesFromEnv() ([]StakingBoostRule, error) {
+	rules := make([]StakingBoostRule, 0)
+
+	v := os.Getenv("STAKING_BOOST_RULES")
+	if v == "" {
+		return rules, nil
+	}
+
+	err := json.Unmarshal([]byte(v), &rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid STAKING_BOOST_RULES: %w", err)
+	}
+
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid staking boost rule %q: %w", rule.Name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// minimum amount held, at least one base unit
+func (r *StakingBoostRule) MinHeld() uint64 {
+	if r.MinAmount == 0 {
+		return 1
+	}
+
+	return r.MinAmount
+}
+
+// weight times every boost's multiplier
+func BoostedWeight(weight *big.Rat, boosts []*StakingBoost) *big.Rat {
+	boosted := new(big.Rat).Set(weight)
+
+	for _, b := range boosts {
+		boosted.Mul(boosted, big.NewRat(int64(b.MultiplierBps), StakingBoostBaseBps))
+	}
+
+	return boosted
+}
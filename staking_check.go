@@ -0,0 +1,73 @@
+package payapi
+
+import "context"
+
+type (
+	// what a commitment check found, nothing is saved in a dry run
+	StakingCheckReport struct {
+		StakingPeriodId int  `json:"stakingPeriodId"`
+		DryRun          bool `json:"dryRun"`
+
+		Commitments    int `json:"commitments"`    // total for the period
+		EligibleBefore int `json:"eligibleBefore"` // eligible when the check began
+		EligibleAfter  int `json:"eligibleAfter"`  // eligible once changes are applied
+
+		// every commitment against what its address holds, ordered by commitment id
+		Verifications []*CommitmentVerification `json:"verifications"`
+
+		// commitments made ineligible, or that would be
+		Changes []*EligibilityChange `json:"changes"`
+
+		// holdings and ratios seen, ID is only set once saved
+		Run *StakingCheckRun `json:"run"`
+
+		// failures the check carried on past
+		Warnings []string `json:"warnings"`
+	}
+
+	// a commitment checked against what its address holds, each committed asset on its own
+	CommitmentVerification struct {
+		StakingCommitmentId int                  `json:"stakingCommitmentId"`
+		Address             string               `json:"address"`
+		Eligible            bool                 `json:"eligible"` // before the check
+		Met                 bool                 `json:"met"`      // every committed asset held
+		Assets              []*AssetVerification `json:"assets"`   // ordered by asset id
+	}
+
+	AssetVerification struct {
+		AssetId   uint64 `json:"assetId"`
+		Name      string `json:"name"`
+		Committed uint64 `json:"committed"` // in base units
+		Held      uint64 `json:"held"`      // in base units
+		Met       bool   `json:"met"`
+	}
+
+	EligibilityChange struct {
+		Commitment *StakingCommitment `json:"commitment"` // as it was before the change
+		Event      *EligibilityEvent  `json:"event"`
+		Applied    bool               `json:"applied"`
+	}
+
+	// a result as it would be created now against the one saved, if any
+	StakingResultPreview struct {
+		Result  *StakingResult         `json:"result"`
+		Current *StakingResult         `json:"current"`
+		Changes []*StakingRewardChange `json:"changes"`
+	}
+
+	// an address whose reward differs between the saved result and the preview, ordered by address
+	StakingRewardChange struct {
+		Address string `json:"address"`
+		Current uint64 `json:"current"` // in base units, zero without a saved result
+		Preview uint64 `json:"preview"` // in base units
+	}
+)
+
+type StakingCheckService interface {
+	// Check every commitment of a period holds what it committed, making those that don't ineligible
+	// dryRun leaves eligibility as it is and saves no check run
+	CheckStakingCommitments(ctx context.Context, stakingPeriodId int, dryRun bool) (*StakingCheckReport, error)
+
+	// Work out the result of a period against its saved one, nothing is saved
+	PreviewStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*StakingResultPreview, error)
+}
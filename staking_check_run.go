@@ -0,0 +1,130 @@
+package payapi
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// how committed amounts are credited when a staking result is calculated
+const (
+	StakingWeightingCommitment = "commitment" // full committed amount of eligible commitments, nothing otherwise
+	StakingWeightingAverage    = "average"    // time weighted average balance seen by check runs
+	StakingWeightingMinimum    = "minimum"    // lowest balance seen by check runs
+)
+
+var ErrInvalidStakingWeighting = errors.New("invalid staking weighting")
+
+type (
+	// one pass of the commitment check, records what every committed address held
+	StakingCheckRun struct {
+		ID              int       `json:"id"`
+		StakingPeriodId int       `json:"stakingPeriodId"`
+		CreatedAt       time.Time `json:"createdAt"`
+
+		Holdings []*StakingHolding `json:"holdings,omitempty"`
+
+		// pooled assets priced at the run
+		Ratios []*StakingAssetRatio `json:"ratios,omitempty"`
+	}
+
+	// balance of a committed asset at a check run, zero when none was held
+	StakingHolding struct {
+		StakingCheckRunId int       `json:"stakingCheckRunId"`
+		Address           string    `json:"address"`
+		AssetId           uint64    `json:"assetId"`
+		Amount            uint64    `json:"amount"` // in base units
+		CreatedAt         time.Time `json:"createdAt"`
+	}
+
+	StakingCheckRunFilter struct {
+		StakingPeriodId *int `json:"stakingPeriodId"`
+	}
+
+	StakingHoldingFilter struct {
+		StakingPeriodId *int    `json:"stakingPeriodId"`
+		Address         *string `json:"address"`
+	}
+)
+
+func ValidateStakingWeighting(weighting string) error {
+	switch weighting {
+	case StakingWeightingCommitment, StakingWeightingAverage, StakingWeightingMinimum:
+		return nil
+	}
+
+	return ErrInvalidStakingWeighting
+}
+
+// amount of committed credited by weighting, from one address' holdings of the asset ordered by time
+// balances over the committed amount count as the committed amount
+// each holding stands until the next one, the first from begin and the last until end
+func WeightedStakingAmount(weighting string, committed uint64, holdings []*StakingHolding, begin, end time.Time) uint64 {
+	if weighting == StakingWeightingCommitment {
+		return committed
+	} else if len(holdings) == 0 {
+		return 0
+	}
+
+	capped := func(h *StakingHolding) uint64 {
+		if h.Amount > committed {
+			return committed
+		}
+		return h.Amount
+	}
+
+	if weighting == StakingWeightingMinimum {
+		min := committed
+		for _, h := range holdings {
+			if amount := capped(h); amount < min {
+				min = amount
+			}
+		}
+		return min
+	}
+
+	total := new(big.Int)
+	duration := new(big.Int)
+
+	for i, h := range holdings {
+		from := h.CreatedAt
+		if i == 0 {
+			from = begin
+		}
+
+		to := end
+		if i+1 < len(holdings) {
+			to = holdings[i+1].CreatedAt
+		}
+
+		seconds := int64(to.Sub(from) / time.Second)
+		if seconds <= 0 {
+			continue
+		}
+
+		total.Add(total, new(big.Int).Mul(new(big.Int).SetUint64(capped(h)), big.NewInt(seconds)))
+		duration.Add(duration, big.NewInt(seconds))
+	}
+
+	// every check at the same moment, nothing to weight by
+	if duration.Sign() == 0 {
+		for _, h := range holdings {
+			total.Add(total, new(big.Int).SetUint64(capped(h)))
+		}
+		duration.SetInt64(int64(len(holdings)))
+	}
+
+	return total.Quo(total, duration).Uint64()
+}
+
+type StakingCheckRunService interface {
+	// Find check runs, without holdings, ordered by time
+	FindStakingCheckRuns(ctx context.Context, filter StakingCheckRunFilter) ([]*StakingCheckRun, error)
+
+	// Find recorded holdings, ordered by address, asset then time
+	FindStakingHoldings(ctx context.Context, filter StakingHoldingFilter) ([]*StakingHolding, error)
+
+	// Record a check run with its holdings and ratios, run parameter will be updated upon success
+	CreateStakingCheckRun(ctx context.Context, run *StakingCheckRun) error
+}
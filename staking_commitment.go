@@ -2,9 +2,19 @@ package payapi
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 )
 
+// who changed a commitment's eligibility
+const (
+	EligibilitySourceCheck = "check" // commitment check run found less held than committed
+	EligibilitySourceAdmin = "admin"
+)
+
+var ErrStakingCommitmentNotFound = errors.New("staking commitment not found")
+
 type (
 	StakingCommitment struct {
 		ID              int        `json:"id"`
@@ -13,40 +23,112 @@ type (
 		CreatedAt       time.Time  `json:"createdAt"`
 		UpdatedAt       *time.Time `json:"updatedAt"`
 
-		// how much are they going to commit?
-		ChipCommitment        uint64 `json:"chipCommitment"`
-		LiquidityCommitment   uint64 `json:"liquidityCommitment"`
-		LiquidityCommitmentV2 uint64 `json:"liquidityCommitmentV2"` // TM v2 pool
-
-		// new liquid concensus targets
-		CAlgoCommitment uint64 `json:"cAlgoCommitment"`
-		TAlgoCommitment uint64 `json:"tAlgoCommitment"`
-		MAlgoCommitment uint64 `json:"mAlgoCommitment"`
-		XAlgoCommitment uint64 `json:"xAlgoCommitment"`
+		// how much are they going to commit? one item per staking asset
+		Assets []*StakingCommitmentItem `json:"assets"`
 
 		// Eligible for rewards?
 		Eligible bool `json:"eligible"`
 	}
 
+	// amount of a registered staking asset held for the period
+	StakingCommitmentItem struct {
+		AssetId uint64 `json:"assetId"`
+		Amount  uint64 `json:"amount"` // in base units
+	}
+
+	// a change to a commitment's eligibility, and why
+	EligibilityEvent struct {
+		ID                  int    `json:"id"`
+		StakingCommitmentId int    `json:"stakingCommitmentId"`
+		Eligible            bool   `json:"eligible"` // eligibility after the change
+		Source              string `json:"source"`
+		Reason              string `json:"reason"`
+
+		// what the check saw, set when a check run made the change
+		StakingCheckRunId *int    `json:"stakingCheckRunId"`
+		AssetId           *uint64 `json:"assetId"`
+		Committed         *uint64 `json:"committed"` // in base units
+		Balance           *uint64 `json:"balance"`   // in base units
+
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	EligibilityEventFilter struct {
+		StakingCommitmentId *int    `json:"stakingCommitmentId"`
+		StakingPeriodId     *int    `json:"stakingPeriodId"`
+		AlgorandAddress     *string `json:"algorandAddress"`
+	}
+
 	StakingCommitmentFilter struct {
-		StakingPeriodId *int `json:"stakingPeriodId"`
+		StakingPeriodId *int    `json:"stakingPeriodId"`
+		AlgorandAddress *string `json:"algorandAddress"`
 	}
 )
 
+// amount committed of assetId, zero if none
+func (sc *StakingCommitment) AssetAmount(assetId uint64) uint64 {
+	for _, item := range sc.Assets {
+		if item.AssetId == assetId {
+			return item.Amount
+		}
+	}
+
+	return 0
+}
+
+func (e *EligibilityEvent) Validate() error {
+	if e.Source != EligibilitySourceCheck && e.Source != EligibilitySourceAdmin {
+		return errors.New("invalid eligibility source")
+	} else if e.Reason == "" {
+		return errors.New("reason cannot be empty")
+	}
+
+	return nil
+}
+
+// checks each asset is only committed once, zero amounts are dropped
+func (sc *StakingCommitment) ValidateAssets() error {
+	seen := make(map[uint64]bool, len(sc.Assets))
+	items := make([]*StakingCommitmentItem, 0, len(sc.Assets))
+
+	for _, item := range sc.Assets {
+		if item == nil {
+			return errors.New("invalid asset commitment")
+		} else if seen[item.AssetId] {
+			return fmt.Errorf("asset %d committed more than once", item.AssetId)
+		}
+		seen[item.AssetId] = true
+
+		if item.Amount > 0 {
+			items = append(items, item)
+		}
+	}
+
+	sc.Assets = items
+
+	return nil
+}
+
 type StakingCommitmentService interface {
 
-	// find
+	// find, by period and/or address
 	FindStakingCommitments(ctx context.Context, filter StakingCommitmentFilter) ([]*StakingCommitment, error)
 
 	// Find a payment by ID, returns object
 	FindStakingCommitmentByID(ctx context.Context, id int) (*StakingCommitment, error)
 
 	// Create, return nil on success
+	// every asset must be active in the staking asset registry
 	CreateStakingCommitment(ctx context.Context, stakingCommitment *StakingCommitment) error
 
 	// update, eg change commitment during reg period
+	// assets are replaced as a whole
 	UpdateStakingCommitment(ctx context.Context, stakingCommitment *StakingCommitment) error
 
-	// change eligibility
-	UpdateEligibility(ctx context.Context, id int, eligible bool) (*StakingCommitment, error)
+	// change eligibility to event.Eligible, recording event with it
+	// nothing is recorded when eligibility is already event.Eligible
+	UpdateEligibility(ctx context.Context, id int, event *EligibilityEvent) (*StakingCommitment, error)
+
+	// find eligibility changes, ordered by time
+	FindEligibilityEvents(ctx context.Context, filter EligibilityEventFilter) ([]*EligibilityEvent, error)
 }
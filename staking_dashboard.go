@@ -0,0 +1,56 @@
+package payapi
+
+import (
+	"context"
+)
+
+type (
+	// an address' part in house staking, across every period it committed to
+	StakingDashboard struct {
+		Address string                    `json:"address"`
+		Periods []*StakingDashboardPeriod `json:"periods"`
+	}
+
+	StakingDashboardPeriod struct {
+		StakingPeriod *StakingPeriod     `json:"stakingPeriod"`
+		Commitment    *StakingCommitment `json:"commitment"`
+
+		// committed against held on chain now
+		Assets []*StakingDashboardAsset `json:"assets"`
+
+		// every check of the commitment, ordered by time
+		Checks []*StakingDashboardCheck `json:"checks"`
+
+		// why the commitment was disqualified or reinstated, ordered by time
+		Eligibility []*EligibilityEvent `json:"eligibility"`
+
+		// until there's a result, the reward if the latest profit snapshot were final
+		ProjectedProfit *StakeProfitSnapshot `json:"projectedProfit"`
+		ProjectedReward *StakingResultItem   `json:"projectedReward"`
+
+		// once there's a result
+		Reward *StakingResultItem `json:"reward"`
+		Payout *StakingPayout     `json:"payout"`
+	}
+
+	StakingDashboardAsset struct {
+		AssetId   uint64 `json:"assetId"`
+		Name      string `json:"name"`
+		Committed uint64 `json:"committed"` // in base units
+		Held      uint64 `json:"held"`      // in base units, on chain now
+	}
+
+	// a check run's view of one committed asset
+	StakingDashboardCheck struct {
+		*StakingHolding
+
+		Committed uint64 `json:"committed"`
+		Met       bool   `json:"met"`
+		Reason    string `json:"reason,omitempty"` // why the commitment wasn't met
+	}
+)
+
+type StakingDashboardService interface {
+	// Everything about address' staking, periods it never committed to are left out
+	GetStakingDashboard(ctx context.Context, address string) (*StakingDashboard, error)
+}
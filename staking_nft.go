@@ -2,11 +2,95 @@ package payapi
 
 import (
 	"context"
+	"errors"
 )
 
-type ()
+// what auto staking does to a commitment the holder already has
+const (
+	AutoStakeModeMerge   = "merge"   // only adds auto staked assets the holder hasn't committed themselves
+	AutoStakeModeReplace = "replace" // sets every auto staked asset to what the policy allows
+)
+
+type (
+	// who is auto staked and how much
+	AutoStakePolicy struct {
+		Collections []*AutoStakeCollection `json:"collections"`
+		Mode        string                 `json:"mode"`
+
+		// most of an auto staked asset committed per NFT counted, in base units by asset id
+		// the whole balance is committed for assets without a cap
+		CapPerNft map[uint64]uint64 `json:"capPerNft"`
+	}
+
+	// holding any of AssetIds gets an address auto staked
+	AutoStakeCollection struct {
+		Name     string   `json:"name"`
+		AssetIds []uint64 `json:"assetIds"`
+
+		// each NFT held counts this many times, once when zero
+		Multiplier uint64 `json:"multiplier"`
+
+		// most NFTs of the collection counted per holder, all of them when zero
+		MaxNfts uint64 `json:"maxNfts"`
+	}
+
+	AutoStakeReport struct {
+		StakingPeriodId int    `json:"stakingPeriodId"`
+		Mode            string `json:"mode"`
+
+		Created []*AutoStakeEntry `json:"created"`
+		Updated []*AutoStakeEntry `json:"updated"`
+		Skipped []*AutoStakeSkip  `json:"skipped"`
+	}
+
+	AutoStakeEntry struct {
+		Address string                   `json:"address"`
+		Nfts    uint64                   `json:"nfts"`   // counted, after multipliers and caps
+		Assets  []*StakingCommitmentItem `json:"assets"` // the commitment as saved
+	}
+
+	AutoStakeSkip struct {
+		Address string `json:"address"`
+		Reason  string `json:"reason"`
+	}
+)
+
+func (p *AutoStakePolicy) Validate() error {
+	if p.Mode != AutoStakeModeMerge && p.Mode != AutoStakeModeReplace {
+		return errors.New("invalid auto stake mode")
+	} else if len(p.Collections) == 0 {
+		return errors.New("auto stake policy needs a collection")
+	}
+
+	for _, c := range p.Collections {
+		if len(c.AssetIds) == 0 {
+			return errors.New("auto stake collection needs an asset")
+		}
+	}
+
+	return nil
+}
+
+// NFTs counted for an address holding balances of a collection's assets, by asset id
+func (c *AutoStakeCollection) Count(balances map[uint64]uint64) uint64 {
+	held := uint64(0)
+	for _, id := range c.AssetIds {
+		held += balances[id]
+	}
+
+	if c.MaxNfts > 0 && held > c.MaxNfts {
+		held = c.MaxNfts
+	}
+
+	if c.Multiplier > 0 {
+		held *= c.Multiplier
+	}
+
+	return held
+}
 
 type StakingNftService interface {
-	// Create, return nil on success
-	CreateAutoStake(ctx context.Context, stakingPeriodId int) error
+	// Commit auto staked assets of every NFT holder to a period as the policy says
+	// failures for single holders are reported as skipped, not returned
+	CreateAutoStake(ctx context.Context, stakingPeriodId int) (*AutoStakeReport, error)
 }
@@ -0,0 +1,83 @@
+package payapi
+
+import (
+	"context"
+	"time"
+)
+
+// staking rewards are paid out in CHIPS
+const StakingRewardAssetId uint64 = 388592191
+
+// payout lifecycle
+// pending -> sent -> confirmed
+// a sent payout whose group expired without confirming is failed, failed payouts go back to pending when retried
+const (
+	StakingPayoutStatusPending   int = 0
+	StakingPayoutStatusSent      int = 1 // signed and broadcast in a group, txid and last valid round recorded
+	StakingPayoutStatusConfirmed int = 2
+	StakingPayoutStatusFailed    int = 3 // never landed, safe to send again
+)
+
+type (
+	// reward owed to one address from a staking result
+	StakingPayout struct {
+		ID              int `json:"id"`
+		StakingPeriodId int `json:"stakingPeriodId"`
+		StakingResultId int `json:"stakingResultId"`
+
+		Address string `json:"address"`
+		AssetId uint64 `json:"assetId"`
+		Amount  uint64 `json:"amount"` // in base units
+
+		Status   int `json:"status"`
+		Attempts int `json:"attempts"` // groups it has been sent in
+
+		// latest attempt
+		GroupID        *string `json:"groupId"`
+		TransactionID  *string `json:"txid"`
+		LastValidRound *uint64 `json:"lastValidRound"`
+		FailureReason  *string `json:"failureReason"`
+
+		CreatedAt   time.Time  `json:"createdAt"`
+		SentAt      *time.Time `json:"sentAt"`
+		ConfirmedAt *time.Time `json:"confirmedAt"`
+		FailedAt    *time.Time `json:"failedAt"`
+	}
+
+	StakingPayoutFilter struct {
+		StakingPeriodId *int    `json:"stakingPeriodId"`
+		Status          *int    `json:"status"`
+		Address         *string `json:"address"`
+	}
+
+	// what a distribution run did
+	StakingDistribution struct {
+		StakingPeriodId int `json:"stakingPeriodId"`
+
+		Created   int `json:"created"`   // payouts queued from the result this run
+		Confirmed int `json:"confirmed"` // sent payouts found on chain
+		Failed    int `json:"failed"`    // payouts that failed this run
+		Retried   int `json:"retried"`   // failed payouts put back to pending
+		Sent      int `json:"sent"`      // payouts broadcast
+		Groups    int `json:"groups"`    // groups broadcast
+
+		// payouts of the period not yet confirmed, after this run
+		Remaining int `json:"remaining"`
+
+		// payouts that need looking at by hand, e.g. a txid that doesn't match what was sent
+		Warnings []string `json:"warnings"`
+	}
+)
+
+type StakingPayoutService interface {
+	// Find payouts, ordered by id
+	FindStakingPayouts(ctx context.Context, filter StakingPayoutFilter) ([]*StakingPayout, error)
+
+	// Queue the period's staking result for payout, safe to call repeatedly
+	// creates a pending payout per rewarded address (once) and puts failed payouts back to pending
+	QueueStakingPayouts(ctx context.Context, stakingPeriodId int) (*StakingDistribution, error)
+
+	// Pay out queued payouts from the house account, safe to call repeatedly
+	// checks sent payouts on chain, retries failed ones a few times, then sends pending payouts in groups of up to 16
+	DistributeStakingPayouts(ctx context.Context, stakingPeriodId int) (*StakingDistribution, error)
+}
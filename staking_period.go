@@ -2,9 +2,28 @@ package payapi
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// period lifecycle, follows from the timestamps until an admin closes it
+// scheduled -> registration -> commitment -> settling -> settled
+const (
+	StakingPeriodStatusScheduled    = "scheduled"    // registration hasn't begun, can still be edited
+	StakingPeriodStatusRegistration = "registration" // commitments can be made
+	StakingPeriodStatusCommitment   = "commitment"   // registration over, commitments are being held
+	StakingPeriodStatusSettling     = "settling"     // commitment over, its result can be created
+	StakingPeriodStatusSettled      = "settled"      // closed once it had a result
+)
+
+var (
+	ErrStakingPeriodNotFound    = errors.New("staking period not found")
+	ErrStakingPeriodNotEditable = errors.New("staking period can only be edited before registration begins")
+	ErrStakingPeriodNotSettling = errors.New("staking period commitment has not ended or it is already settled")
+	ErrStakingPeriodNoResult    = errors.New("staking period has no result")
+	ErrStakingResultExists      = errors.New("staking period already has a result")
+)
+
 type (
 	StakingPeriod struct {
 		ID int `json:"id"`
@@ -19,12 +38,60 @@ type (
 
 		// How many chips = 1 LP token at time of creation
 		ChipRatio float64 `json:"chipRatio"`
+
+		// game types (casino gameable_type) whose revenue funds rewards, every game when empty
+		FundingGames []string `json:"fundingGames"`
+
+		// set when settled
+		ClosedAt *time.Time `json:"closedAt"`
+
+		// one of StakingPeriodStatus*, as of when it was fetched
+		Status string `json:"status"`
 	}
 
 	StakingPeriodFilter struct {
 	}
 )
 
+// timestamps must be set and in order, registration can run right up to the commitment
+func (sp *StakingPeriod) Validate() error {
+	if sp.RegistrationBegin.IsZero() || sp.RegistrationEnd.IsZero() || sp.CommitmentBegin.IsZero() || sp.CommitmentEnd.IsZero() {
+		return errors.New("registration and commitment times are required")
+	} else if !sp.RegistrationBegin.Before(sp.RegistrationEnd) {
+		return errors.New("registrationBegin must be before registrationEnd")
+	} else if sp.CommitmentBegin.Before(sp.RegistrationEnd) {
+		return errors.New("commitmentBegin cannot be before registrationEnd")
+	} else if !sp.CommitmentBegin.Before(sp.CommitmentEnd) {
+		return errors.New("commitmentBegin must be before commitmentEnd")
+	} else if sp.ChipRatio <= 0 {
+		return errors.New("chipRatio must be more than zero")
+	}
+
+	for _, g := range sp.FundingGames {
+		if g == "" {
+			return errors.New("fundingGames can't have an empty game type")
+		}
+	}
+
+	return nil
+}
+
+// status of the period at t
+func (sp *StakingPeriod) StatusAt(t time.Time) string {
+	switch {
+	case sp.ClosedAt != nil:
+		return StakingPeriodStatusSettled
+	case t.Before(sp.RegistrationBegin):
+		return StakingPeriodStatusScheduled
+	case t.Before(sp.RegistrationEnd):
+		return StakingPeriodStatusRegistration
+	case t.Before(sp.CommitmentEnd):
+		return StakingPeriodStatusCommitment
+	}
+
+	return StakingPeriodStatusSettling
+}
+
 type StakingPeriodService interface {
 	// find
 	FindStakingPeriods(ctx context.Context, filter StakingPeriodFilter) ([]*StakingPeriod, error)
@@ -34,4 +101,10 @@ type StakingPeriodService interface {
 
 	// Create, return nil on success
 	CreateStakingPeriod(ctx context.Context, stakingPeriod *StakingPeriod) error
+
+	// Change times, chip ratio and funding games, only while scheduled
+	UpdateStakingPeriod(ctx context.Context, stakingPeriod *StakingPeriod) error
+
+	// Settle a period once its result has been created
+	CloseStakingPeriod(ctx context.Context, id int) (*StakingPeriod, error)
 }
@@ -2,22 +2,39 @@ package payapi
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/algo-casino/payapi/reward"
 )
 
+var ErrStakingResultNotFound = errors.New("staking result not found")
+
 type (
 	StakingResultItem struct {
 		Address string  `json:"address"`
-		Percent float64 `json:"percent"`
-		Reward  float64 `json:"reward"`
+		Percent float64 `json:"percent"` // of the distributable profit, for display
+		Reward  uint64  `json:"reward"`  // in base units, rewards, house fee and unallocated add up to Profit
+
+		// multipliers applied to the address' weight
+		Boosts []*StakingBoost `json:"boosts,omitempty"`
 	}
 
 	StakingResult struct {
 		ID              int                  `json:"id"`
 		StakingPeriodId int                  `json:"stakingPeriodId"`
 		Profit          uint64               `json:"profit"`
+		HouseFee        uint64               `json:"houseFee"`
+		Unallocated     uint64               `json:"unallocated"` // kept by the house when nobody qualified for a reward
+		Weighting       string               `json:"weighting"`   // how committed amounts were credited
+		AssetRatios     map[uint64]float64   `json:"assetRatios"` // chips per whole token pooled assets were valued at, from their pools
 		Results         []*StakingResultItem `json:"results"`
 		CreatedAt       time.Time            `json:"created_at"`
+
+		// what the result was worked out with, as it was then, nil for results saved before they were recorded
+		Policy       *reward.Policy       `json:"policy"`       // house fee and minimum payout
+		FundingGames []string             `json:"fundingGames"` // the period's, every game's when empty
+		Inputs       *StakingExportInputs `json:"inputs"`       // only set once saved
 	}
 
 	StakingResultFilter struct {
@@ -34,6 +51,10 @@ type StakingResultService interface {
 	// Find a payment by ID, returns object
 	FindStakingResultByID(ctx context.Context, id int) (*StakingResult, error)
 
+	// Work out a result as it would be created now, without saving it, eg for projections
+	CalculateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*StakingResult, error)
+
 	// Create, return nil on success
-	CreateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64) (*StakingResult, error)
+	// weighting is one of StakingWeighting*, average and minimum need check runs recorded for the period
+	CreateStakingResult(ctx context.Context, stakingPeriodId int, totalProfit uint64, weighting string) (*StakingResult, error)
 }
@@ -0,0 +1,140 @@
+package payapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/algo-casino/payapi/reward"
+)
+
+var ErrNoSigningKey = errors.New("no house key to sign with")
+
+type (
+	// canonical form of a saved staking result, the house signs its json encoding
+	// fields are encoded in order, rewards by address, map keys sorted as encoding/json does, times in UTC
+	StakingResultExport struct {
+		StakingResultId int                    `json:"stakingResultId"`
+		StakingPeriod   *StakingExportPeriod   `json:"stakingPeriod"`
+		Profit          uint64                 `json:"profit"`
+		HouseFee        uint64                 `json:"houseFee"`
+		Unallocated     uint64                 `json:"unallocated"`
+		Weighting       string                 `json:"weighting"`
+		Policy          *reward.Policy         `json:"policy"` // null for results saved before policies were recorded
+		AssetRatios     map[uint64]float64     `json:"assetRatios"`
+		Rewards         []*StakingExportReward `json:"rewards"`
+		Inputs          *StakingExportInputs   `json:"inputs"`
+		CreatedAt       time.Time              `json:"createdAt"`
+	}
+
+	StakingExportPeriod struct {
+		ID                int       `json:"id"`
+		RegistrationBegin time.Time `json:"registrationBegin"`
+		RegistrationEnd   time.Time `json:"registrationEnd"`
+		CommitmentBegin   time.Time `json:"commitmentBegin"`
+		CommitmentEnd     time.Time `json:"commitmentEnd"`
+		ChipRatio         float64   `json:"chipRatio"`
+		FundingGames      []string  `json:"fundingGames"` // as the result was worked out, empty for every game
+	}
+
+	StakingExportReward struct {
+		Address string          `json:"address"`
+		Reward  uint64          `json:"reward"` // in base units
+		Boosts  []*StakingBoost `json:"boosts"` // in rule order
+	}
+
+	// hex sha256 of the canonical json of what the result was worked out from
+	// saved with the result, later changes to its inputs (e.g. reinstating a commitment) don't change its export
+	StakingExportInputs struct {
+		Commitments string `json:"commitments"` // ordered by id, with their assets by asset id
+		Holdings    string `json:"holdings"`    // every check run's, ordered by address, asset then time
+		AssetRatios string `json:"assetRatios"` // pooled asset prices, ordered by time
+	}
+
+	// the exact bytes signed and who signed them
+	// Signature is base64 ed25519 over "MX" followed by Document, as Algorand wallets sign data
+	SignedStakingResultExport struct {
+		Document  json.RawMessage `json:"document"`
+		Signer    string          `json:"signer"`
+		Signature string          `json:"signature"`
+	}
+)
+
+// what of a commitment goes into the inputs hash, leaves out timestamps
+type stakingInputCommitment struct {
+	ID       int                      `json:"id"`
+	Address  string                   `json:"address"`
+	Eligible bool                     `json:"eligible"`
+	Assets   []*StakingCommitmentItem `json:"assets"`
+}
+
+// hashes what the result of a period is worked out from, each list as ordered by its service
+func HashStakingInputs(commitments []*StakingCommitment, holdings []*StakingHolding, ratios []*StakingAssetRatio) (*StakingExportInputs, error) {
+	ecs := make([]*stakingInputCommitment, 0, len(commitments))
+	for _, c := range commitments {
+		ecs = append(ecs, &stakingInputCommitment{
+			ID:       c.ID,
+			Address:  c.AlgorandAddress,
+			Eligible: c.Eligible,
+			Assets:   c.Assets,
+		})
+	}
+
+	// copies in UTC, the caller's are left as they are
+	hs := make([]StakingHolding, 0, len(holdings))
+	for _, h := range holdings {
+		hc := *h
+		hc.CreatedAt = h.CreatedAt.UTC()
+		hs = append(hs, hc)
+	}
+
+	rs := make([]StakingAssetRatio, 0, len(ratios))
+	for _, r := range ratios {
+		rc := *r
+		rc.CreatedAt = r.CreatedAt.UTC()
+		rs = append(rs, rc)
+	}
+
+	inputs := &StakingExportInputs{}
+
+	var err error
+
+	inputs.Commitments, err = hashJSON(ecs)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs.Holdings, err = hashJSON(hs)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs.AssetRatios, err = hashJSON(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	return inputs, nil
+}
+
+func hashJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type StakingExportService interface {
+	// Build the canonical export of a saved result
+	ExportStakingResult(ctx context.Context, stakingResultId int) (*StakingResultExport, error)
+
+	// Encode and sign an export with the house key, ErrNoSigningKey when none is configured
+	SignStakingResultExport(ctx context.Context, export *StakingResultExport) (*SignedStakingResultExport, error)
+}
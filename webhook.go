@@ -0,0 +1,73 @@
+package payapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookStatusPending   int = 0
+	WebhookStatusDelivered int = 1
+	WebhookStatusFailed    int = 2 // gave up after too many attempts
+)
+
+// event names sent in the X-PayAPI-Event header and the `event` payload field
+const (
+	WebhookEventDepositCompleted    = "deposit.completed"
+	WebhookEventDepositCancelled    = "deposit.cancelled"
+	WebhookEventDepositExpired      = "deposit.expired"
+	WebhookEventWithdrawalBroadcast = "withdrawal.broadcast"
+	WebhookEventWithdrawalConfirmed = "withdrawal.confirmed"
+	WebhookEventWithdrawalFailed    = "withdrawal.failed"
+)
+
+type WebhookDelivery struct {
+	ID           int  `json:"id"`
+	PlatformId   int  `json:"platformId"`
+	PaymentId    *int `json:"paymentId"`
+	WithdrawalId *int `json:"withdrawalId"`
+
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+
+	Status         int        `json:"status"`
+	Attempts       int        `json:"attempts"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastAttemptAt  *time.Time `json:"lastAttemptAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+	LastStatusCode *int       `json:"lastStatusCode"`
+	LastError      *string    `json:"lastError"`
+}
+
+type WebhookDeliveryFilter struct {
+	PaymentId    *int `json:"paymentId"`
+	WithdrawalId *int `json:"withdrawalId"`
+	Status       *int `json:"status"`
+}
+
+type WebhookService interface {
+	// delivery log, oldest first
+	FindWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*WebhookDelivery, error)
+
+	// Attempt up to `limit` deliveries that are due, failures are rescheduled with backoff
+	// returns how many deliveries were attempted
+	DeliverPendingWebhooks(ctx context.Context, limit int) (int, error)
+}
+
+// Signs a webhook body with the platforms secret
+// platforms verify the X-PayAPI-Signature header by computing the same value
+// hex(HMAC-SHA256(secret, timestamp + "." + body))
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
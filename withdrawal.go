@@ -0,0 +1,91 @@
+package payapi
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrWithdrawalExpired = errors.New("withdrawal txn expired without confirming")
+
+// withdrawal lifecycle
+// requested -> approved -> signed -> broadcast -> confirmed
+// requested and approved can be failed by hand, signed and broadcast only fail once their txn has expired
+const (
+	WithdrawalStatusRequested int = 0
+	WithdrawalStatusApproved  int = 1
+	WithdrawalStatusSigned    int = 2 // claimed and signed by the worker, txid recorded, may or may not have reached the network
+	WithdrawalStatusBroadcast int = 3 // sent to the network, waiting for confirmation
+	WithdrawalStatusConfirmed int = 4
+	WithdrawalStatusFailed    int = 5
+)
+
+type Withdrawal struct {
+	ID         int `json:"id"`
+	PlatformId int `json:"platformId"`
+
+	Status      int        `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ApprovedAt  *time.Time `json:"approvedAt"`
+	SignedAt    *time.Time `json:"signedAt"`
+	BroadcastAt *time.Time `json:"broadcastAt"`
+	ConfirmedAt *time.Time `json:"confirmedAt"`
+	FailedAt    *time.Time `json:"failedAt"`
+
+	Sender   *string `json:"sender"`   // algorand address of the house account that paid out (set once signed)
+	Receiver string  `json:"receiver"` // algorand address of who's going to receive the payout
+	AssetId  uint64  `json:"assetId"`  // algorand asset id, or zero for network token
+	Amount   uint64  `json:"amount"`   // amount in uint64
+
+	TransactionID  *string `json:"txid"`           // algorand txid, set once signed
+	LastValidRound *uint64 `json:"lastValidRound"` // the txn can never be confirmed after this round
+	FailureReason  *string `json:"failureReason"`  // why the withdrawal failed, if it did
+
+	ExternalId int `json:"externalId"` // ID of withdrawal on platforms internal storage (sent as the txn note)
+}
+
+func (w *Withdrawal) Validate() error {
+	if w.PlatformId <= 0 {
+		return errors.New("platformId cannot be <= 0")
+	} else if w.Status < WithdrawalStatusRequested || w.Status > WithdrawalStatusFailed {
+		return errors.New("invalid status")
+	} else if w.Amount <= 0 || w.Receiver == "" {
+		return errors.New("invalid transaction parameters")
+	} else if w.ExternalId <= 0 {
+		return errors.New("externalId cannot be <= 0")
+	}
+
+	return nil
+}
+
+type WithdrawalService interface {
+	// group
+	FindWithdrawals(ctx context.Context, filter WithdrawalFilter) ([]*Withdrawal, error)
+
+	// Find a withdrawal by ID, returns object
+	FindWithdrawalByID(ctx context.Context, id int) (*Withdrawal, error)
+
+	// Create withdrawal in the requested state
+	// returns error on failure, withdrawal parameter will be updated upon success
+	CreateWithdrawal(ctx context.Context, withdrawal *Withdrawal) error
+
+	// Approve a requested withdrawal so it can be paid out
+	ApproveWithdrawal(ctx context.Context, id int) (*Withdrawal, error)
+
+	// Sign and broadcast an approved withdrawal from the house account
+	// the txid is saved with the claim (signed) before sending so it can never be sent twice
+	// a failed broadcast leaves it signed, ConfirmWithdrawal settles it either way
+	SendWithdrawal(ctx context.Context, id int) (*Withdrawal, error)
+
+	// Check a signed or broadcast withdrawal has been confirmed on the network (via indexer)
+	// once the indexer is past its last valid round without the txn it is failed, returning ErrWithdrawalExpired
+	ConfirmWithdrawal(ctx context.Context, id int) (*Withdrawal, error)
+
+	// Mark a withdrawal that hasn't been sent as failed (will notify platform via webhook call)
+	FailWithdrawal(ctx context.Context, id int, reason string) (*Withdrawal, error)
+}
+
+type WithdrawalFilter struct {
+	PlatformId *int `json:"platformId"`
+	Status     *int `json:"status"`
+}